@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gately/internal/auth"
+	"gately/internal/config"
+	"gately/internal/dal"
+	"github.com/spf13/cobra"
+)
+
+// apikeyCmd groups the commands that manage API keys.
+// They open the same store as the server, configured through the same flags and env vars.
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage the API keys of the management API",
+	Long: `Creates, lists and revokes API keys. Keys are stored hashed next to the URL mappings.
+In embedded mode the store file is locked by a running server, so stop it first.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// The arguments are fine by now. Errors from the store need no usage text
+		cmd.SilenceUsage = true
+		return bindEnvVarsToFlags(cmd)
+	},
+}
+
+var apikeyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API key. The key is printed once and cannot be recovered",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		owner, _ := cmd.Flags().GetString("owner")
+		name, _ := cmd.Flags().GetString("name")
+		admin, _ := cmd.Flags().GetBool("admin")
+		workspace, _ := cmd.Flags().GetString("workspace")
+
+		return withStores(cmd, func(ctx context.Context, stores *dal.Stores) error {
+			if workspace != dal.DefaultWorkspace {
+				if _, err := stores.Workspaces.GetWorkspace(ctx, workspace); err != nil {
+					return fmt.Errorf("Unable to find workspace %s. Err=%w", workspace, err)
+				}
+			}
+
+			raw, key, err := auth.New(stores.Keys).CreateKey(ctx, owner, name, workspace, admin)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("\nCreated API key %s for %s\n%s\n", key.Id, key.Owner, raw)
+			return nil
+		})
+	},
+}
+
+var apikeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all API keys",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStores(cmd, func(ctx context.Context, stores *dal.Stores) error {
+			keys, err := auth.New(stores.Keys).ListKeys(ctx)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "\nID\tWORKSPACE\tOWNER\tNAME\tADMIN\tCREATED\tREVOKED")
+			for _, key := range keys {
+				revoked := "-"
+				if key.RevokedTs != 0 {
+					revoked = formatTs(key.RevokedTs)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n",
+					key.Id, displayWorkspace(key.Workspace), key.Owner, key.Name, key.Admin, formatTs(key.CreatedTs), revoked)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+var apikeyRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke an API key. Running servers accept it for up to a minute longer",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStores(cmd, func(ctx context.Context, stores *dal.Stores) error {
+			if err := auth.New(stores.Keys).RevokeKey(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("\nRevoked API key %s\n", args[0])
+			return nil
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(apikeyCmd)
+	apikeyCmd.AddCommand(apikeyCreateCmd, apikeyListCmd, apikeyRevokeCmd)
+	addStoreFlags(apikeyCmd.PersistentFlags())
+
+	apikeyCreateCmd.Flags().StringP("owner", "o", "", "Owner of the links created with the key")
+	apikeyCreateCmd.Flags().StringP("name", "n", "", "What the key is used for")
+	apikeyCreateCmd.Flags().BoolP("admin", "", false, "Allow the key to manage the links of every owner in its workspace")
+	apikeyCreateCmd.Flags().StringP("workspace", "w", dal.DefaultWorkspace,
+		"Workspace of the key, created with 'gately workspace create'. The default workspace if empty")
+	_ = apikeyCreateCmd.MarkFlagRequired("owner")
+}
+
+// withStores opens the configured store for the duration of fn
+func withStores(cmd *cobra.Command, fn func(ctx context.Context, stores *dal.Stores) error) error {
+	cfg := loadConfig(cmd)
+	if cfg.StoreDriver == config.StoreDriverMemory {
+		return fmt.Errorf("The in-memory store only lives inside the server. Use GATELY_ADMIN_API_KEY instead")
+	}
+
+	stores, err := dal.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stores.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return fn(ctx, stores)
+}
+
+func formatTs(ts int64) string {
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+// displayWorkspace names the default workspace, which has an empty id
+func displayWorkspace(id string) string {
+	if id == dal.DefaultWorkspace {
+		return "-"
+	}
+	return id
+}
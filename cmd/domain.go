@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"gately/internal/dal"
+	"gately/internal/service"
+	"github.com/spf13/cobra"
+)
+
+// domainCmd groups the commands that manage custom domains.
+// Like apikey, they open the same store as the server.
+var domainCmd = &cobra.Command{
+	Use:   "domain",
+	Short: "Manage the custom domains that short urls are served from",
+	Long: `Registers and lists custom domains, such as go.acme.com. Each domain belongs to a workspace,
+or to the default one, and its short codes are unique on that domain only.
+Point the DNS of the domain at gately. Running servers pick up a new domain within a minute.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// The arguments are fine by now. Errors from the store need no usage text
+		cmd.SilenceUsage = true
+		return bindEnvVarsToFlags(cmd)
+	},
+}
+
+var domainAddCmd = &cobra.Command{
+	Use:   "add <host>",
+	Short: "Register a custom domain",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		workspace, _ := cmd.Flags().GetString("workspace")
+		scheme, _ := cmd.Flags().GetString("scheme")
+
+		domain, err := service.NewDomain(args[0], workspace, scheme)
+		if err != nil {
+			return err
+		}
+		return withStores(cmd, func(ctx context.Context, stores *dal.Stores) error {
+			if workspace != dal.DefaultWorkspace {
+				if _, err := stores.Workspaces.GetWorkspace(ctx, workspace); err != nil {
+					return fmt.Errorf("Unable to find workspace %s. Err=%w", workspace, err)
+				}
+			}
+			if err := stores.Domains.AddDomain(ctx, domain); err != nil {
+				return err
+			}
+			fmt.Printf("\nRegistered domain %s\n", domain.Host)
+			return nil
+		})
+	},
+}
+
+var domainListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all custom domains",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStores(cmd, func(ctx context.Context, stores *dal.Stores) error {
+			domains, err := stores.Domains.ListDomains(ctx)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "\nHOST\tWORKSPACE\tSCHEME\tCREATED")
+			for _, domain := range domains {
+				scheme := domain.Scheme
+				if scheme == "" {
+					scheme = "https"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+					domain.Host, displayWorkspace(domain.Workspace), scheme, formatTs(domain.CreatedTs))
+			}
+			return w.Flush()
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(domainCmd)
+	domainCmd.AddCommand(domainAddCmd, domainListCmd)
+	addStoreFlags(domainCmd.PersistentFlags())
+
+	domainAddCmd.Flags().StringP("workspace", "w", dal.DefaultWorkspace,
+		"Workspace whose links may use the domain. The default workspace if empty")
+	domainAddCmd.Flags().StringP("scheme", "", "", "Scheme of the short urls on the domain, http or https. https if empty")
+}
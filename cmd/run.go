@@ -7,9 +7,13 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"gately/internal/app"
+	"gately/internal/canonical"
 	"gately/internal/config"
+	"gately/internal/dal"
+	"gately/internal/service"
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -40,23 +44,15 @@ var runCmd = &cobra.Command{
 		}
 		return nil
 	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Final config combining both flags and env vars
-		finalConf := viper.New()
-
-		if err := finalConf.BindPFlags(cmd.Flags()); err != nil {
-			fmt.Println("Unable to map flags to config")
-		}
-
-		// Convert Config map to config struct
-		err := mapstructure.Decode(finalConf.AllSettings(), &appConfig)
-		if err != nil {
-			fmt.Println("Unable to unmarshall configs")
+		appConfig = loadConfig(cmd)
+		if err := appConfig.Check(); err != nil {
+			return err
 		}
-		fmt.Printf("Final Conf %+v", appConfig)
 
 		app.Run(appConfig)
-
+		return nil
 	},
 }
 
@@ -67,20 +63,122 @@ func init() {
 	// Passwords and usernames should come only from env vars.
 	runCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	runCmd.Flags().StringP("port", "p", "8080", "Gately application port")
-	runCmd.Flags().StringP("redis-host", "r", "redis:6379", "Redis host")
+	runCmd.Flags().StringP("metrics-port", "", "9090",
+		"Port of the Prometheus /metrics endpoint, kept off the application port. Leave empty to turn metrics off")
+	addStoreFlags(runCmd.Flags())
+	runCmd.Flags().StringP("short-code-generator", "", config.ShortCodeRandom,
+		"How short codes are generated. One of random, counter, hashids")
+	runCmd.Flags().IntP("short-code-length", "", service.DefaultShortCodeLength,
+		"Length of random short codes. Minimum length for counter and hashids codes")
+	runCmd.Flags().StringP("short-code-alphabet", "", service.Base62Alphabet,
+		"Characters that short codes are made of")
+	runCmd.Flags().StringP("short-code-salt", "", "", "")
+	_ = runCmd.Flags().MarkHidden("short-code-salt")
+	runCmd.Flags().DurationP("expiry-sweep-interval", "", time.Hour,
+		"How often expired links are purged from the store. 0 disables purging")
+	runCmd.Flags().DurationP("expired-retention", "", 7*24*time.Hour,
+		"How long expired links are kept, answering 410 Gone, before they are purged")
+	runCmd.Flags().IntP("click-queue-size", "", 10000,
+		"How many clicks may wait to be counted. Clicks beyond that are dropped")
+	runCmd.Flags().IntP("click-workers", "", 2, "Workers that aggregate and write hit counts")
+	runCmd.Flags().IntP("click-batch-size", "", 500, "Number of clicks after which they are written")
+	runCmd.Flags().DurationP("click-flush-interval", "", time.Second,
+		"Longest time clicks are held before they are written")
+	// Secret, so it comes from GATELY_CLICK_IP_SALT like the DB credentials
+	runCmd.Flags().StringP("click-ip-salt", "", "", "")
+	_ = runCmd.Flags().MarkHidden("click-ip-salt")
+	runCmd.Flags().BoolP("auth", "", true,
+		"Require an API key for the management API. The redirects are always public")
+	// Secret, so it comes from GATELY_ADMIN_API_KEY
+	runCmd.Flags().StringP("admin-api-key", "", "", "")
+	_ = runCmd.Flags().MarkHidden("admin-api-key")
+	runCmd.Flags().IntP("create-rate-limit", "", 60,
+		"Short urls each API key may create per create-rate-window. 0 disables the limit")
+	runCmd.Flags().DurationP("create-rate-window", "", time.Minute, "Window of the create rate limit")
+	runCmd.Flags().IntP("redirect-rate-limit", "", 600,
+		"Redirects each client IP may request per redirect-rate-window. 0 disables the limit")
+	runCmd.Flags().DurationP("redirect-rate-window", "", time.Minute, "Window of the redirect rate limit")
+	runCmd.Flags().StringSliceP("trusted-proxies", "", nil,
+		"CIDRs of the reverse proxies whose X-Forwarded-For header names the client IP. "+
+			"Without any, the client IP is the address of the connection")
+	runCmd.Flags().IntP("default-redirect-type", "", service.DefaultRedirectType,
+		"Redirect status of links that do not set their own. One of 301, 302, 307, 308")
+	runCmd.Flags().StringP("dedupe-policy", "", string(dal.DedupeReject),
+		"What creating a link to an already shortened long url does in workspaces without their own policy. "+
+			"One of reject, return-existing, allow-duplicates")
+	runCmd.Flags().StringP("public-base-url", "", "",
+		"Where short urls are served from, e.g. https://gate.ly. Defaults to http://localhost:<port>")
+	runCmd.Flags().StringSliceP("url-schemes", "", canonical.DefaultSchemes,
+		"Schemes that long urls may have. Others, such as javascript:, are rejected")
+	runCmd.Flags().BoolP("url-sort-query", "", false,
+		"Sort the query parameters of long urls, so that their order does not make another URL")
+	runCmd.Flags().BoolP("url-strip-tracking-params", "", false,
+		"Drop utm_* and click id parameters such as fbclid and gclid from long urls")
+	runCmd.Flags().BoolP("url-strip-www", "", true,
+		"Treat www.example.com and example.com as the same host")
+	runCmd.Flags().StringP("redis-host", "r", "redis:6379", "Redis host. Leave empty to only use the in-memory cache")
 	runCmd.Flags().StringP("redis-user", "", "", "")
 	_ = runCmd.Flags().MarkHidden("redis-user")
 	runCmd.Flags().StringP("redis-pass", "", "", "")
 	_ = runCmd.Flags().MarkHidden("redis-pass")
-	runCmd.Flags().StringP("mongo-host", "c", "mongo:27017", "MongoDB host")
-	runCmd.Flags().StringP("mongo-db-name", "", "testDB",
+}
+
+// addStoreFlags defines the flags that select and connect to the backing store.
+// They are shared by every command that opens the store.
+func addStoreFlags(flags *pflag.FlagSet) {
+	flags.StringP("store", "", config.StoreDriverMongo,
+		"Backing store for URL mappings. One of mongo, postgres, bolt, memory")
+	flags.BoolP("embedded", "", false,
+		"Run as a single binary with an on-disk store and no Redis or MongoDB")
+	flags.StringP("embedded-path", "", "gately.db",
+		"File that stores URL mappings in embedded mode")
+	flags.StringP("mongo-host", "c", "mongo:27017", "MongoDB host")
+	flags.StringP("mongo-db-name", "", "testDB",
 		"Database that stores URL mappings in MongoDB")
-	runCmd.Flags().StringP("mongo-collection-name", "", "testCollection",
+	flags.StringP("mongo-collection-name", "", "testCollection",
 		"Mongo Collection that stores URL mappings in MongoDB")
-	runCmd.Flags().StringP("mongo-user", "", "", "")
-	_ = runCmd.Flags().MarkHidden("mongo-user")
-	runCmd.Flags().StringP("mongo-pass", "", "", "")
-	_ = runCmd.Flags().MarkHidden("mongo-pass")
+	flags.StringP("mongo-user", "", "", "")
+	_ = flags.MarkHidden("mongo-user")
+	flags.StringP("mongo-pass", "", "", "")
+	_ = flags.MarkHidden("mongo-pass")
+	flags.StringP("postgres-host", "", "postgres:5432", "PostgreSQL host")
+	flags.StringP("postgres-db-name", "", "gately",
+		"Database that stores URL mappings in PostgreSQL")
+	flags.StringP("postgres-sslmode", "", "disable", "PostgreSQL sslmode")
+	flags.StringP("postgres-user", "", "", "")
+	_ = flags.MarkHidden("postgres-user")
+	flags.StringP("postgres-pass", "", "", "")
+	_ = flags.MarkHidden("postgres-pass")
+}
+
+// loadConfig decodes the flags of cmd, which already carry the env vars, into an AppConfig
+func loadConfig(cmd *cobra.Command) config.AppConfig {
+	var cfg config.AppConfig
+
+	finalConf := viper.New()
+	if err := finalConf.BindPFlags(cmd.Flags()); err != nil {
+		fmt.Println("Unable to map flags to config")
+	}
+
+	// Convert Config map to config struct
+	// Duration flags come through as strings and need a decode hook
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     &cfg,
+	})
+	if err == nil {
+		err = decoder.Decode(finalConf.AllSettings())
+	}
+	if err != nil {
+		fmt.Println("Unable to unmarshall configs")
+	}
+	if cfg.Embedded {
+		// Embedded mode needs no external services.
+		// URL mappings live in a local BoltDB file and only the in-memory cache is used
+		cfg.StoreDriver = config.StoreDriverBolt
+		cfg.RedisHost = ""
+	}
+	return cfg
 }
 
 // Bind each cmdline flag to its corresponding environment variable
@@ -95,7 +193,6 @@ func bindEnvVarsToFlags(cmd *cobra.Command) error {
 		envVarSuffix := strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
 		envVar := fmt.Sprintf("%s_%s", envPrefix, envVarSuffix)
 		err := v.BindEnv(f.Name, envVar)
-		fmt.Println(v.GetString(f.Name))
 		if err != nil {
 			fmt.Println("Unable to parse environment variable")
 			os.Exit(-1)
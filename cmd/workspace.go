@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"gately/internal/dal"
+	"gately/internal/service"
+	"github.com/spf13/cobra"
+)
+
+// workspaceCmd groups the commands that manage workspaces.
+// Like apikey, they open the same store as the server.
+var workspaceCmd = &cobra.Command{
+	Use:   "workspace",
+	Short: "Manage the workspaces that API keys and links belong to",
+	Long: `Creates, updates and lists workspaces. Each workspace has its own links, metrics and link quota,
+and long urls are only deduplicated within a workspace, according to its dedupe policy.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// The arguments are fine by now. Errors from the store need no usage text
+		cmd.SilenceUsage = true
+		return bindEnvVarsToFlags(cmd)
+	},
+}
+
+var workspaceCreateCmd = &cobra.Command{
+	Use:   "create <id>",
+	Short: "Create a workspace",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, _ := cmd.Flags().GetString("name")
+		prefix, _ := cmd.Flags().GetString("short-code-prefix")
+		maxLinks, _ := cmd.Flags().GetInt64("max-links")
+		policy, _ := cmd.Flags().GetString("dedupe-policy")
+
+		ws, err := service.NewWorkspace(args[0], name, prefix, maxLinks, dal.DedupePolicy(policy))
+		if err != nil {
+			return err
+		}
+		return withStores(cmd, func(ctx context.Context, stores *dal.Stores) error {
+			if err := stores.Workspaces.AddWorkspace(ctx, ws); err != nil {
+				return err
+			}
+			fmt.Printf("\nCreated workspace %s\n", ws.Id)
+			return nil
+		})
+	},
+}
+
+var workspaceUpdateCmd = &cobra.Command{
+	Use:   "update <id>",
+	Short: "Change the settings of a workspace",
+	Long: `Changes the settings given as flags and leaves the others as they are.
+A new short code prefix only applies to links created from then on.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStores(cmd, func(ctx context.Context, stores *dal.Stores) error {
+			ws, err := stores.Workspaces.GetWorkspace(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			flags := cmd.Flags()
+			if flags.Changed("name") {
+				ws.Name, _ = flags.GetString("name")
+			}
+			if flags.Changed("short-code-prefix") {
+				ws.ShortCodePrefix, _ = flags.GetString("short-code-prefix")
+			}
+			if flags.Changed("max-links") {
+				ws.MaxLinks, _ = flags.GetInt64("max-links")
+			}
+			if flags.Changed("dedupe-policy") {
+				policy, _ := flags.GetString("dedupe-policy")
+				ws.DedupePolicy = dal.DedupePolicy(policy)
+			}
+			if err := service.CheckWorkspace(ws); err != nil {
+				return err
+			}
+
+			if err := stores.Workspaces.UpdateWorkspace(ctx, ws); err != nil {
+				return err
+			}
+			fmt.Printf("\nUpdated workspace %s\n", ws.Id)
+			return nil
+		})
+	},
+}
+
+var workspaceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all workspaces",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStores(cmd, func(ctx context.Context, stores *dal.Stores) error {
+			workspaces, err := stores.Workspaces.ListWorkspaces(ctx)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "\nID\tNAME\tPREFIX\tLINKS\tMAX LINKS\tDEDUPE POLICY\tCREATED")
+			for _, ws := range workspaces {
+				links, err := stores.Urls.CountUrlEntries(ctx, ws.Id)
+				if err != nil {
+					return err
+				}
+				maxLinks := "-"
+				if ws.MaxLinks > 0 {
+					maxLinks = fmt.Sprint(ws.MaxLinks)
+				}
+				policy := string(ws.DedupePolicy)
+				if policy == "" {
+					policy = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+					ws.Id, ws.Name, ws.ShortCodePrefix, links, maxLinks, policy, formatTs(ws.CreatedTs))
+			}
+			return w.Flush()
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(workspaceCmd)
+	workspaceCmd.AddCommand(workspaceCreateCmd, workspaceUpdateCmd, workspaceListCmd)
+	addStoreFlags(workspaceCmd.PersistentFlags())
+
+	// create and update share their settings
+	for _, c := range []*cobra.Command{workspaceCreateCmd, workspaceUpdateCmd} {
+		c.Flags().StringP("name", "n", "", "Display name of the workspace")
+		c.Flags().StringP("short-code-prefix", "", "",
+			"Prepended to every short code of the workspace, aliases included, e.g. acme-")
+		c.Flags().Int64P("max-links", "", 0, "Most links the workspace may have. 0 means no limit")
+		c.Flags().StringP("dedupe-policy", "", "",
+			"What creating a link to an already shortened long url does. One of reject, return-existing "+
+				"or allow-duplicates. Empty means the server's dedupe-policy")
+	}
+}
@@ -1,35 +1,122 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"gately/internal/config"
 	"gately/internal/controller"
+	"gately/internal/telemetry"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// How long in-flight requests and queued clicks get to finish on shutdown
+const shutdownTimeout = 15 * time.Second
+
 func Run(cfg config.AppConfig) {
 
-	ctrlr := controller.New(cfg)
+	metrics := telemetry.New()
+	ctrlr := controller.New(cfg, metrics)
 
 	if ctrlr == nil {
 		panic("Unable to instantiate Application Controller")
 	}
 	e := echo.New()
+	// Every error is answered with a controller.ErrorResponse
+	e.HTTPErrorHandler = controller.HTTPErrorHandler
+	// Client IPs are only taken from X-Forwarded-For behind trusted proxies
+	e.IPExtractor = controller.IPExtractor(cfg.TrustedProxies)
+
+	// Tag every request, so that an error reported by a client can be found in the logs
+	e.Use(middleware.RequestID())
 
+	// Observe every request, including the ones that panic
+	e.Use(metrics.Middleware())
 	// Try to recover from all panics
 	e.Use(middleware.Recover())
 
+	// Redirect to a real URL given a shortURL. Public, unlike the management API
+	e.GET("/:urlId", ctrlr.RedirectUrl, ctrlr.LimitRedirects())
+
+	api := e.Group("/api/v1")
+	if cfg.Auth {
+		// Every management route needs an API key
+		api.Use(ctrlr.Authenticate)
+	} else {
+		log.Printf("Authentication is disabled. Anyone can manage every link")
+	}
+
 	// Create a short url
-	e.POST("/api/v1/urls", ctrlr.CreateUrlMapping)
-	// Redirect to a real URL given a shortURL
-	e.GET("/:urlId", ctrlr.RedirectUrl)
+	api.POST("/urls", ctrlr.CreateUrlMapping, ctrlr.LimitCreates())
+	// Retarget a mapped URL or change its expiry
+	api.PATCH("/urls/:urlId", ctrlr.UpdateUrlMapping)
+	// Every destination a mapped URL has had
+	api.GET("/urls/:urlId/history", ctrlr.GetUrlHistory)
+	// Clicks on a mapped URL per time bucket
+	api.GET("/urls/:urlId/stats", ctrlr.GetUrlStats)
+	// Point a mapped URL back to a previous destination
+	api.POST("/urls/:urlId/rollback", ctrlr.RollbackUrlMapping)
 	// Delete a mapped URL
-	e.DELETE("/api/v1/urls/:urlId", ctrlr.DeleteUrlMapping)
+	api.DELETE("/urls/:urlId", ctrlr.DeleteUrlMapping)
 	// Get URL access metrics
-	e.GET("/api/v1/metrics", ctrlr.GetUrlMetrics)
+	api.GET("/metrics", ctrlr.GetUrlMetrics)
 	// Start server
 	address := fmt.Sprintf(":%s", cfg.Port)
-	e.Logger.Fatal(e.Start(address))
+	go func() {
+		if err := e.Start(address); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+	// Prometheus metrics of the server itself. On a port of their own, as every host
+	// that reaches the application port, custom domains included, is public
+	metricsServer := newMetricsServer(cfg.MetricsPort, metrics)
+	if metricsServer != nil {
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Unable to serve metrics. Err=%v", err)
+			}
+		}()
+	}
+
+	// Wait for a termination signal, then stop taking requests and
+	// flush the clicks that are still queued
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Unable to shut down the server cleanly. Err=%v", err)
+	}
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(shutdownCtx)
+	}
+	if err := ctrlr.Close(shutdownCtx); err != nil {
+		log.Printf("Unable to flush queued clicks. Err=%v", err)
+	}
+}
+
+// newMetricsServer serves /metrics on port. It returns nil when metrics are turned off
+func newMetricsServer(port string, metrics *telemetry.Metrics) *http.Server {
+	if port == "" {
+		log.Printf("No metrics port configured. Prometheus metrics are turned off")
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%s", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
 }
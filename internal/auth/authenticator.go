@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gately/internal/dal"
+)
+
+// Authenticated keys are remembered for this long, so that not every request
+// hits the store. It is also how long a revoked key may keep working.
+const keyCacheTTL = time.Minute
+
+// Principal of the key configured through WithAdminKey
+const adminKeyId = "admin"
+
+var (
+	ErrInvalidApiKey = errors.New("Invalid API key")
+	ErrRevokedApiKey = errors.New("The API key has been revoked")
+)
+
+type cachedKey struct {
+	key     *dal.ApiKey
+	expires time.Time
+}
+
+// Authenticator issues API keys and checks the keys of incoming requests
+type Authenticator struct {
+	store dal.KeyStore
+	// Hash of a key that is accepted as an admin without being in the store
+	adminHash string
+
+	mu    sync.Mutex
+	cache map[string]cachedKey
+	// Clock of the key cache, replaced in tests
+	now func() time.Time
+}
+
+// Option configures an Authenticator
+type Option func(a *Authenticator)
+
+// WithAdminKey accepts key as an admin key of the default workspace. It bootstraps
+// a deployment that has no keys yet, and is the only way in for the in-memory store.
+func WithAdminKey(key string) Option {
+	return func(a *Authenticator) {
+		if key != "" {
+			a.adminHash = hashSecret(key)
+		}
+	}
+}
+
+func New(store dal.KeyStore, opts ...Option) *Authenticator {
+	a := &Authenticator{store: store, cache: make(map[string]cachedKey), now: time.Now}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// CreateKey issues a key for owner in the given workspace. The returned raw key is shown once and never stored.
+func (a *Authenticator) CreateKey(ctx context.Context, owner, name, workspace string, admin bool) (string, *dal.ApiKey, error) {
+	if owner == "" {
+		return "", nil, errors.New("An API key needs an owner")
+	}
+
+	raw, id, secret, err := generateKey()
+	if err != nil {
+		return "", nil, err
+	}
+	key := &dal.ApiKey{
+		Id:        id,
+		Hash:      hashSecret(secret),
+		Owner:     owner,
+		Name:      name,
+		Admin:     admin,
+		Workspace: workspace,
+		CreatedTs: a.now().Unix(),
+	}
+	if err := a.store.AddApiKey(ctx, key); err != nil {
+		return "", nil, err
+	}
+	log.Printf("Created API key %s for %s", id, owner)
+	return raw, key, nil
+}
+
+func (a *Authenticator) ListKeys(ctx context.Context) ([]*dal.ApiKey, error) {
+	return a.store.ListApiKeys(ctx)
+}
+
+func (a *Authenticator) RevokeKey(ctx context.Context, id string) error {
+	if err := a.store.RevokeApiKey(ctx, id, a.now().Unix()); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	delete(a.cache, id)
+	a.mu.Unlock()
+	log.Printf("Revoked API key %s", id)
+	return nil
+}
+
+// Authenticate checks a raw key and returns the principal it belongs to
+func (a *Authenticator) Authenticate(ctx context.Context, raw string) (*Principal, error) {
+	if a.adminHash != "" && subtle.ConstantTimeCompare([]byte(hashSecret(raw)), []byte(a.adminHash)) == 1 {
+		return &Principal{KeyId: adminKeyId, Owner: adminKeyId, Admin: true}, nil
+	}
+
+	id, secret, ok := parseKey(raw)
+	if !ok {
+		return nil, ErrInvalidApiKey
+	}
+
+	key, err := a.lookup(ctx, id)
+	if errors.Is(err, dal.ErrApiKeyNotFound) {
+		return nil, ErrInvalidApiKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to look up API key %s. Err=%w", id, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.Hash)) != 1 {
+		return nil, ErrInvalidApiKey
+	}
+	if key.RevokedTs != 0 {
+		return nil, ErrRevokedApiKey
+	}
+	return &Principal{KeyId: key.Id, Owner: key.Owner, Admin: key.Admin, Workspace: key.Workspace}, nil
+}
+
+func (a *Authenticator) lookup(ctx context.Context, id string) (*dal.ApiKey, error) {
+	now := a.now()
+
+	a.mu.Lock()
+	cached, ok := a.cache[id]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.key, nil
+	}
+
+	key, err := a.store.GetApiKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.cache[id] = cachedKey{key: key, expires: now.Add(keyCacheTTL)}
+	a.mu.Unlock()
+	return key, nil
+}
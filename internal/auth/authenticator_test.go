@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gately/internal/dal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a manual clock for the key cache
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestAuthenticator(store dal.KeyStore, opts ...Option) (*Authenticator, *clock) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	a := New(store, opts...)
+	a.now = c.Now
+	return a, c
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAuthenticator(dal.NewMemoryKeyStore())
+
+	raw, key, err := a.CreateKey(ctx, "alice", "ci", "team-a", false)
+	require.NoError(t, err)
+	assert.NotEqual(t, raw, key.Hash)
+
+	p, err := a.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{KeyId: key.Id, Owner: "alice", Workspace: "team-a"}, p)
+
+	id, secret, _ := parseKey(raw)
+	for _, invalid := range []string{"", "garbage", "gk_" + id + "_wrong" + secret, "gk_unknown_" + secret} {
+		_, err := a.Authenticate(ctx, invalid)
+		assert.ErrorIs(t, err, ErrInvalidApiKey, invalid)
+	}
+
+	_, _, err = a.CreateKey(ctx, "", "ci", "team-a", false)
+	assert.Error(t, err)
+}
+
+func TestAuthenticateAdminKey(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAuthenticator(dal.NewMemoryKeyStore(), WithAdminKey("bootstrap-secret"))
+
+	p, err := a.Authenticate(ctx, "bootstrap-secret")
+	require.NoError(t, err)
+	assert.True(t, p.Admin)
+	assert.Equal(t, adminKeyId, p.KeyId)
+
+	_, err = a.Authenticate(ctx, "bootstrap-secreT")
+	assert.ErrorIs(t, err, ErrInvalidApiKey)
+
+	// Without an admin key, an empty key must not match an empty hash
+	a, _ = newTestAuthenticator(dal.NewMemoryKeyStore(), WithAdminKey(""))
+	_, err = a.Authenticate(ctx, "")
+	assert.ErrorIs(t, err, ErrInvalidApiKey)
+}
+
+func TestRevokeKey(t *testing.T) {
+	ctx := context.Background()
+	store := dal.NewMemoryKeyStore()
+	a, _ := newTestAuthenticator(store)
+
+	raw, key, err := a.CreateKey(ctx, "alice", "ci", dal.DefaultWorkspace, false)
+	require.NoError(t, err)
+	_, err = a.Authenticate(ctx, raw)
+	require.NoError(t, err)
+
+	// The instance that revokes the key forgets it right away
+	require.NoError(t, a.RevokeKey(ctx, key.Id))
+	_, err = a.Authenticate(ctx, raw)
+	assert.ErrorIs(t, err, ErrRevokedApiKey)
+}
+
+func TestRevokedKeyExpiresFromCache(t *testing.T) {
+	ctx := context.Background()
+	store := dal.NewMemoryKeyStore()
+	a, clock := newTestAuthenticator(store)
+	other, _ := newTestAuthenticator(store)
+
+	raw, key, err := a.CreateKey(ctx, "alice", "ci", dal.DefaultWorkspace, false)
+	require.NoError(t, err)
+	_, err = a.Authenticate(ctx, raw)
+	require.NoError(t, err)
+
+	// Revoked through another instance, the key keeps working here until its cache entry expires
+	require.NoError(t, other.RevokeKey(ctx, key.Id))
+	clock.now = clock.now.Add(keyCacheTTL - time.Second)
+	_, err = a.Authenticate(ctx, raw)
+	assert.NoError(t, err)
+
+	clock.now = clock.now.Add(time.Second)
+	_, err = a.Authenticate(ctx, raw)
+	assert.ErrorIs(t, err, ErrRevokedApiKey)
+}
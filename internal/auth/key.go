@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+const (
+	// Keys look like gk_<id>_<secret>. The prefix makes leaked keys easy to scan for
+	keyPrefix    = "gk"
+	keyIdLength  = 12
+	secretLength = 32
+	keyAlphabet  = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+func randomString(length int) (string, error) {
+	max := big.NewInt(int64(len(keyAlphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = keyAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// generateKey returns a new random key together with its id and secret
+func generateKey() (raw, id, secret string, err error) {
+	if id, err = randomString(keyIdLength); err != nil {
+		return "", "", "", err
+	}
+	if secret, err = randomString(secretLength); err != nil {
+		return "", "", "", err
+	}
+	return keyPrefix + "_" + id + "_" + secret, id, secret, nil
+}
+
+// parseKey splits a key into its id and secret
+func parseKey(raw string) (id, secret string, ok bool) {
+	parts := strings.Split(raw, "_")
+	if len(parts) != 3 || parts[0] != keyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// hashSecret is what is stored in place of the secret. The secrets are long and
+// random, so a fast hash suffices. Nothing is gained from a password hash here.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKey(t *testing.T) {
+	raw, id, secret, err := generateKey()
+	require.NoError(t, err)
+	assert.Equal(t, "gk_"+id+"_"+secret, raw)
+	assert.Len(t, id, keyIdLength)
+	assert.Len(t, secret, secretLength)
+	for _, c := range id + secret {
+		assert.True(t, strings.ContainsRune(keyAlphabet, c), "%q is not in the key alphabet", c)
+	}
+
+	parsedId, parsedSecret, ok := parseKey(raw)
+	require.True(t, ok)
+	assert.Equal(t, id, parsedId)
+	assert.Equal(t, secret, parsedSecret)
+
+	other, _, _, err := generateKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, raw, other)
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		raw        string
+		id, secret string
+		ok         bool
+	}{
+		{raw: "gk_abc_def", id: "abc", secret: "def", ok: true},
+		{raw: ""},
+		{raw: "gk_abc"},
+		{raw: "gk__def"},
+		{raw: "gk_abc_"},
+		{raw: "xx_abc_def"},
+		{raw: "GK_abc_def"},
+		{raw: "gk_abc_def_ghi"},
+		{raw: "Bearer gk_abc_def"},
+	}
+	for _, tt := range tests {
+		id, secret, ok := parseKey(tt.raw)
+		assert.Equal(t, tt.ok, ok, tt.raw)
+		assert.Equal(t, tt.id, id, tt.raw)
+		assert.Equal(t, tt.secret, secret, tt.raw)
+	}
+}
+
+func TestHashSecret(t *testing.T) {
+	assert.Equal(t, hashSecret("secret"), hashSecret("secret"))
+	assert.NotEqual(t, hashSecret("secret"), hashSecret("Secret"))
+	// Hex of a sha256, never the secret itself
+	assert.Len(t, hashSecret("secret"), 64)
+	assert.NotContains(t, hashSecret("secret"), "secret")
+}
+
+func TestCanManage(t *testing.T) {
+	alice := &Principal{KeyId: "k1", Owner: "alice"}
+	admin := &Principal{KeyId: "k2", Owner: "ops", Admin: true}
+
+	assert.True(t, alice.CanManage("alice"))
+	assert.False(t, alice.CanManage("bob"))
+	// Links from before API keys have no owner, only admins may change them
+	assert.False(t, alice.CanManage(""))
+	assert.True(t, admin.CanManage("bob"))
+	assert.True(t, admin.CanManage(""))
+}
@@ -0,0 +1,31 @@
+package auth
+
+import "context"
+
+// Principal is the owner of the API key a request was made with
+type Principal struct {
+	KeyId string
+	Owner string
+	Admin bool
+	// The principal only sees the links of its workspace
+	Workspace string
+}
+
+// CanManage reports whether the principal may modify or delete a link of the given owner
+// in its workspace
+func (p *Principal) CanManage(owner string) bool {
+	return p.Admin || (owner != "" && owner == p.Owner)
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx that carries p
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of an authenticated request
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
@@ -0,0 +1,415 @@
+// Package canonical brings long urls into one canonical form, so that
+// spellings of the same URL are stored, and deduplicated, as one.
+package canonical
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrInvalidUrl       = errors.New("Malformed URL")
+	ErrSchemeNotAllowed = errors.New("The URL scheme is not allowed")
+)
+
+// Schemes that long urls may have unless configured otherwise
+var DefaultSchemes = []string{"http", "https"}
+
+// Ports that are implied by the scheme and therefore dropped
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// Query parameters that only tell analytics where a click came from.
+// Parameters starting with utm_ are tracking parameters as well.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"gbraid":  true,
+	"wbraid":  true,
+	"msclkid": true,
+	"yclid":   true,
+	"twclid":  true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_gl":     true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"mkt_tok": true,
+}
+
+// Host names are converted to their ASCII form as DNS resolves them
+var hostProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+)
+
+type Canonicalizer struct {
+	schemes map[string]bool
+	// Scheme of urls that come without one, e.g. example.com/docs
+	defaultScheme  string
+	sortQuery      bool
+	stripTracking  bool
+	stripWwwPrefix bool
+}
+
+type Option func(c *Canonicalizer)
+
+// WithSchemes replaces the schemes that urls may have. Schemes are case insensitive
+func WithSchemes(schemes ...string) Option {
+	return func(c *Canonicalizer) {
+		c.schemes = make(map[string]bool, len(schemes))
+		for _, scheme := range schemes {
+			c.schemes[strings.ToLower(strings.TrimSpace(scheme))] = true
+		}
+	}
+}
+
+// WithSortedQuery orders query parameters by name. Values of a repeated
+// parameter keep their order, as some servers depend on it.
+func WithSortedQuery() Option {
+	return func(c *Canonicalizer) {
+		c.sortQuery = true
+	}
+}
+
+// WithoutTrackingParams drops utm_* and click id parameters such as fbclid and gclid
+func WithoutTrackingParams() Option {
+	return func(c *Canonicalizer) {
+		c.stripTracking = true
+	}
+}
+
+// WithoutWwwPrefix treats www.example.com and example.com as the same host
+func WithoutWwwPrefix() Option {
+	return func(c *Canonicalizer) {
+		c.stripWwwPrefix = true
+	}
+}
+
+func New(opts ...Option) *Canonicalizer {
+	c := &Canonicalizer{defaultScheme: "https"}
+	WithSchemes(DefaultSchemes...)(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Canonicalize validates raw and returns its canonical form. It
+//   - adds https:// to urls without a scheme and rejects schemes that are not allowed
+//   - rejects user info such as user:password@, which hides the real host
+//   - lowercases the scheme and host, and converts international host names to punycode
+//   - drops the port implied by the scheme
+//   - resolves . and .. path segments and normalizes percent-encoding
+//   - optionally drops tracking parameters and sorts the query
+//
+// Canonicalize is idempotent, so canonical urls are left as they are.
+func (c *Canonicalizer) Canonicalize(raw string) (string, error) {
+
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("The URL is empty. Err=%w", ErrInvalidUrl)
+	}
+	raw, err := c.withScheme(raw)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%v. Err=%w", err, ErrInvalidUrl)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if !c.schemes[scheme] {
+		return "", fmt.Errorf("Scheme %q is not allowed. Err=%w", scheme, ErrSchemeNotAllowed)
+	}
+	if u.Opaque != "" {
+		return "", fmt.Errorf("The URL has no host. Err=%w", ErrInvalidUrl)
+	}
+	// https://google.com@evil.example goes to evil.example, while it reads as google.com
+	if u.User != nil {
+		return "", fmt.Errorf("The URL has user info. Err=%w", ErrInvalidUrl)
+	}
+
+	host, err := c.canonicalHost(scheme, u)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	b.WriteString(host)
+	b.WriteString(canonicalPath(u.EscapedPath()))
+	if query := c.canonicalQuery(u.RawQuery); query != "" {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+	if fragment := u.EscapedFragment(); fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(normalizeEscapes(fragment))
+	}
+	return b.String(), nil
+}
+
+// withScheme adds the default scheme to urls that come without one.
+// A prefix such as javascript: is a scheme, while example.com:8080 is a host and port.
+func (c *Canonicalizer) withScheme(raw string) (string, error) {
+
+	if strings.HasPrefix(raw, "//") {
+		return c.defaultScheme + ":" + raw, nil
+	}
+	if i := strings.IndexByte(raw, ':'); i > 0 && isScheme(raw[:i]) {
+		rest := raw[i+1:]
+		if strings.HasPrefix(rest, "//") || !startsWithPort(rest) {
+			return raw, nil
+		}
+	}
+	return c.defaultScheme + "://" + raw, nil
+}
+
+// isScheme reports whether s has the syntax of a URL scheme, per RFC 3986 section 3.1
+func isScheme(s string) bool {
+	for i, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case i > 0 && ('0' <= r && r <= '9' || r == '+' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// startsWithPort reports whether s, what follows the first ':', is a port and maybe a path
+func startsWithPort(s string) bool {
+	end := strings.IndexAny(s, "/?#")
+	if end < 0 {
+		end = len(s)
+	}
+	if end == 0 {
+		return false
+	}
+	for _, r := range s[:end] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Canonicalizer) canonicalHost(scheme string, u *url.URL) (string, error) {
+
+	name, port := u.Hostname(), u.Port()
+	if name == "" {
+		return "", fmt.Errorf("The URL has no host. Err=%w", ErrInvalidUrl)
+	}
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("Invalid port %q. Err=%w", port, ErrInvalidUrl)
+		}
+		// Leading zeros do not make another port
+		port = strconv.Itoa(n)
+		if defaultPorts[scheme] == port {
+			port = ""
+		}
+	}
+
+	if ip := net.ParseIP(name); ip != nil {
+		if ip.To4() == nil {
+			name = "[" + ip.String() + "]"
+		} else {
+			name = ip.String()
+		}
+	} else {
+		// A fully qualified name with a trailing dot is the same host
+		ascii, err := hostProfile.ToASCII(strings.TrimSuffix(name, "."))
+		if err != nil || !utf8.ValidString(name) || !validAsciiHost(ascii) {
+			return "", fmt.Errorf("Invalid host %q. Err=%w", name, ErrInvalidUrl)
+		}
+		name = ascii
+		if c.stripWwwPrefix {
+			for strings.HasPrefix(name, "www.") && strings.Contains(name[len("www."):], ".") {
+				name = name[len("www."):]
+			}
+		}
+	}
+
+	if port != "" {
+		return name + ":" + port, nil
+	}
+	return name, nil
+}
+
+// validAsciiHost reports whether host is a name that ToASCII leaves as it is.
+// Names that only map to punycode, such as U+FFFD, are rejected.
+func validAsciiHost(host string) bool {
+	if host == "" || strings.HasPrefix(host, ".") || strings.HasSuffix(host, ".") || strings.Contains(host, "..") {
+		return false
+	}
+	again, err := hostProfile.ToASCII(host)
+	return err == nil && again == host
+}
+
+// canonicalPath resolves the dot segments of an escaped path, per RFC 3986 section 5.2.4.
+// The root path is dropped, so that example.com and example.com/ are the same.
+func canonicalPath(path string) string {
+
+	if path == "" || path == "/" {
+		return ""
+	}
+	segments := strings.Split(normalizeEscapes(path), "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+
+	resolved := strings.Join(out, "/")
+	if !strings.HasPrefix(resolved, "/") {
+		resolved = "/" + resolved
+	}
+	if resolved == "/" {
+		return ""
+	}
+	return resolved
+}
+
+// canonicalQuery drops tracking parameters and sorts the parameters if configured.
+// Parameters are kept as they are written otherwise, since servers differ in how
+// they read e.g. a + or a repeated name.
+func (c *Canonicalizer) canonicalQuery(query string) string {
+
+	if query == "" {
+		return ""
+	}
+	params := strings.Split(query, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+		param = normalizeEscapes(escapeQueryParam(param))
+		if c.stripTracking && isTrackingParam(paramName(param)) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if c.sortQuery {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return paramName(kept[i]) < paramName(kept[j])
+		})
+	}
+	return strings.Join(kept, "&")
+}
+
+// escapeQueryParam percent-encodes what may not appear in a query as it is, such as
+// spaces and non-ASCII characters. url.Parse leaves the query as it was written.
+func escapeQueryParam(param string) string {
+
+	var b strings.Builder
+	b.Grow(len(param))
+	for i := 0; i < len(param); i++ {
+		c := param[i]
+		switch {
+		case c == '%' && i+2 < len(param) && isHex(param[i+1]) && isHex(param[i+2]):
+			b.WriteByte(c)
+		case c <= ' ' || c >= 0x7f || strings.IndexByte("%\"<>\\^`{|}", c) >= 0:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+// normalizeEscapes uppercases percent-encodings and decodes those of unreserved
+// characters, per RFC 3986 section 6.2.2. Other characters are left alone.
+func normalizeEscapes(s string) string {
+
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,222 @@
+package clicks
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gately/internal/dal"
+	"gately/internal/uniques"
+)
+
+const (
+	defaultQueueSize     = 10000
+	defaultWorkers       = 2
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+	flushTimeout         = 10 * time.Second
+)
+
+// Pipeline records clicks off the request path.
+// Redirects enqueue events into a bounded buffer. Workers aggregate them per short url
+// and write the counts to the UrlStore in bulk, once a batch is full or the flush
+// interval has passed. The events themselves are appended to the ClickStore, and
+// visitor fingerprints are added to the unique visitor sketches, if configured.
+// Events are dropped, and counted, when the buffer is full.
+type Pipeline struct {
+	store         dal.UrlStore
+	clickStore    dal.ClickStore
+	visitors      uniques.Counter
+	queueSize     int
+	workers       int
+	batchSize     int
+	flushInterval time.Duration
+
+	queue   chan *dal.ClickEvent
+	mu      sync.RWMutex
+	closed  bool
+	wg      sync.WaitGroup
+	dropped atomic.Int64
+}
+
+type Option func(p *Pipeline)
+
+func New(opts ...Option) *Pipeline {
+	p := &Pipeline{
+		queueSize:     defaultQueueSize,
+		workers:       defaultWorkers,
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.queue = make(chan *dal.ClickEvent, p.queueSize)
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.run()
+	}
+	return p
+}
+
+// Record enqueues a click without blocking.
+// It returns false when the event was dropped because the buffer is full or the pipeline is closed.
+func (p *Pipeline) Record(e *dal.ClickEvent) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if !p.closed {
+		select {
+		case p.queue <- e:
+			return true
+		default:
+		}
+	}
+	p.dropped.Add(1)
+	return false
+}
+
+// Dropped is the number of clicks that were never recorded because of overload
+func (p *Pipeline) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// QueueDepth is the number of clicks waiting to be aggregated
+func (p *Pipeline) QueueDepth() int {
+	return len(p.queue)
+}
+
+// Close stops accepting clicks and waits until every queued click has been flushed,
+// or until ctx is done.
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Printf("Click pipeline drained. Dropped=%d", p.Dropped())
+		return nil
+	case <-ctx.Done():
+		log.Printf("Click pipeline did not drain in time. Queued=%d", p.QueueDepth())
+		return ctx.Err()
+	}
+}
+
+// batch is what a worker has aggregated since its last flush
+type batch struct {
+	counts map[string]dal.HitCount
+	events []*dal.ClickEvent
+}
+
+func newBatch() *batch {
+	return &batch{counts: make(map[string]dal.HitCount)}
+}
+
+func (b *batch) add(e *dal.ClickEvent) {
+	count := b.counts[e.ShortUrl]
+	count.Hits++
+	if e.Ts > count.LastAccessed {
+		count.LastAccessed = e.Ts
+	}
+	b.counts[e.ShortUrl] = count
+	b.events = append(b.events, e)
+}
+
+func (p *Pipeline) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	b := newBatch()
+	for {
+		select {
+		case e, ok := <-p.queue:
+			if !ok {
+				// Closed and drained
+				p.flush(b)
+				return
+			}
+			b.add(e)
+
+			if len(b.events) >= p.batchSize {
+				p.flush(b)
+				b = newBatch()
+			}
+		case <-ticker.C:
+			if len(b.events) > 0 {
+				p.flush(b)
+				b = newBatch()
+			}
+		}
+	}
+}
+
+func (p *Pipeline) flush(b *batch) {
+	if len(b.events) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	if err := p.store.UpdateUrlHitCounts(ctx, b.counts); err != nil {
+		log.Printf("Unable to flush hit counts for %d short URLs. Err=%v", len(b.counts), err)
+	}
+	if p.clickStore != nil {
+		if err := p.clickStore.AddClickEvents(ctx, b.events); err != nil {
+			log.Printf("Unable to flush %d click events. Err=%v", len(b.events), err)
+		}
+	}
+	if p.visitors != nil {
+		p.flushVisitors(ctx, b.events)
+	}
+}
+
+// visitorDay groups the visitors of a short url on one UTC day
+type visitorDay struct {
+	shortUrl string
+	day      int64
+}
+
+const secondsPerDay = 24 * 3600
+
+func (p *Pipeline) flushVisitors(ctx context.Context, events []*dal.ClickEvent) {
+	fingerprints := make(map[visitorDay][]string)
+	for _, e := range events {
+		fp := fingerprint(e)
+		if fp == "" {
+			continue
+		}
+		key := visitorDay{shortUrl: e.ShortUrl, day: e.Ts - e.Ts%secondsPerDay}
+		fingerprints[key] = append(fingerprints[key], fp)
+	}
+
+	for key, fps := range fingerprints {
+		if err := p.visitors.Add(ctx, key.shortUrl, time.Unix(key.day, 0), fps...); err != nil {
+			log.Printf("Unable to count unique visitors of %s. Err=%v", key.shortUrl, err)
+		}
+	}
+}
+
+// fingerprint identifies the visitor behind a click by its hashed IP and user agent.
+// Clicks without an IP hash cannot be told apart and yield an empty fingerprint.
+func fingerprint(e *dal.ClickEvent) string {
+	if e.IpHash == "" {
+		return ""
+	}
+	return e.IpHash + "|" + e.UserAgent
+}
@@ -0,0 +1,62 @@
+package clicks
+
+import (
+	"time"
+
+	"gately/internal/dal"
+	"gately/internal/uniques"
+)
+
+func WithUrlStore(store dal.UrlStore) Option {
+	return func(p *Pipeline) {
+		p.store = store
+	}
+}
+
+// WithClickStore keeps every click event, not just the hit counts
+func WithClickStore(store dal.ClickStore) Option {
+	return func(p *Pipeline) {
+		p.clickStore = store
+	}
+}
+
+// WithUniqueCounter counts the unique visitors of every short url
+func WithUniqueCounter(counter uniques.Counter) Option {
+	return func(p *Pipeline) {
+		p.visitors = counter
+	}
+}
+
+// WithQueueSize bounds how many clicks may wait to be aggregated
+func WithQueueSize(size int) Option {
+	return func(p *Pipeline) {
+		if size > 0 {
+			p.queueSize = size
+		}
+	}
+}
+
+func WithWorkers(workers int) Option {
+	return func(p *Pipeline) {
+		if workers > 0 {
+			p.workers = workers
+		}
+	}
+}
+
+// WithBatchSize is the number of clicks after which a worker flushes
+func WithBatchSize(size int) Option {
+	return func(p *Pipeline) {
+		if size > 0 {
+			p.batchSize = size
+		}
+	}
+}
+
+func WithFlushInterval(interval time.Duration) Option {
+	return func(p *Pipeline) {
+		if interval > 0 {
+			p.flushInterval = interval
+		}
+	}
+}
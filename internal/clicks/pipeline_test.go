@@ -0,0 +1,140 @@
+package clicks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gately/internal/dal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flushStore hands the hit counts of every flush to the test. Other UrlStore methods are not used by the pipeline
+type flushStore struct {
+	dal.UrlStore
+	flushes chan map[string]dal.HitCount
+	// Flushes wait for it when set, to hold a worker
+	release chan struct{}
+}
+
+func newFlushStore() *flushStore {
+	return &flushStore{flushes: make(chan map[string]dal.HitCount, 100)}
+}
+
+func (s *flushStore) UpdateUrlHitCounts(ctx context.Context, counts map[string]dal.HitCount) error {
+	s.flushes <- counts
+	if s.release != nil {
+		<-s.release
+	}
+	return nil
+}
+
+func (s *flushStore) nextFlush(t *testing.T) map[string]dal.HitCount {
+	t.Helper()
+	select {
+	case counts := <-s.flushes:
+		return counts
+	case <-time.After(2 * time.Second):
+		t.Fatal("No flush happened")
+		return nil
+	}
+}
+
+func (s *flushStore) noFlush(t *testing.T) {
+	t.Helper()
+	select {
+	case counts := <-s.flushes:
+		t.Fatalf("Unexpected flush of %v", counts)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func click(shortUrl string, ts int64) *dal.ClickEvent {
+	return &dal.ClickEvent{ShortUrl: shortUrl, Ts: ts}
+}
+
+func TestPipelineFlushesFullBatches(t *testing.T) {
+	store := newFlushStore()
+	p := New(WithUrlStore(store), WithWorkers(1), WithBatchSize(3), WithFlushInterval(time.Hour))
+	defer func() { _ = p.Close(context.Background()) }()
+
+	p.Record(click("a", 10))
+	p.Record(click("b", 11))
+	store.noFlush(t)
+
+	p.Record(click("a", 12))
+	assert.Equal(t, map[string]dal.HitCount{
+		"a": {Hits: 2, LastAccessed: 12},
+		"b": {Hits: 1, LastAccessed: 11},
+	}, store.nextFlush(t))
+}
+
+func TestPipelineFlushesOnInterval(t *testing.T) {
+	store := newFlushStore()
+	p := New(WithUrlStore(store), WithWorkers(1), WithBatchSize(100), WithFlushInterval(20*time.Millisecond))
+	defer func() { _ = p.Close(context.Background()) }()
+
+	p.Record(click("a", 10))
+	assert.Equal(t, map[string]dal.HitCount{"a": {Hits: 1, LastAccessed: 10}}, store.nextFlush(t))
+}
+
+func TestPipelineCloseDrainsQueuedClicks(t *testing.T) {
+	store := newFlushStore()
+	clickStore := dal.NewMemoryClickStore()
+	p := New(WithUrlStore(store), WithClickStore(clickStore), WithWorkers(2), WithBatchSize(100), WithFlushInterval(time.Hour))
+
+	for ts := int64(1); ts <= 5; ts++ {
+		require.True(t, p.Record(click("a", ts)))
+	}
+	require.NoError(t, p.Close(context.Background()))
+
+	// Each worker flushes what it has, so the hits may be split over two flushes
+	var hits int64
+	for len(store.flushes) > 0 {
+		hits += (<-store.flushes)["a"].Hits
+	}
+	assert.Equal(t, int64(5), hits)
+
+	events, err := clickStore.GetClickEvents(context.Background(), "a", 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, events, 5)
+	assert.Zero(t, p.Dropped())
+}
+
+func TestPipelineCountsDroppedClicks(t *testing.T) {
+	store := newFlushStore()
+	store.release = make(chan struct{})
+	p := New(WithUrlStore(store), WithWorkers(1), WithQueueSize(1), WithBatchSize(1), WithFlushInterval(time.Hour))
+
+	// The worker takes the first click and is held in its flush
+	require.True(t, p.Record(click("a", 1)))
+	store.nextFlush(t)
+
+	// The second click fills the buffer, the third does not fit
+	assert.True(t, p.Record(click("a", 2)))
+	assert.False(t, p.Record(click("a", 3)))
+	assert.Equal(t, int64(1), p.Dropped())
+
+	close(store.release)
+	require.NoError(t, p.Close(context.Background()))
+	assert.Equal(t, int64(1), store.nextFlush(t)["a"].Hits)
+
+	// Clicks after Close are dropped as well
+	assert.False(t, p.Record(click("a", 4)))
+	assert.Equal(t, int64(2), p.Dropped())
+}
+
+func TestPipelineCloseGivesUpAfterDeadline(t *testing.T) {
+	store := newFlushStore()
+	store.release = make(chan struct{})
+	defer close(store.release)
+	p := New(WithUrlStore(store), WithWorkers(1), WithBatchSize(1), WithFlushInterval(time.Hour))
+
+	p.Record(click("a", 1))
+	store.nextFlush(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Close(ctx), context.DeadlineExceeded)
+}
@@ -1,17 +1,127 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported backing stores for URL mappings
+const (
+	StoreDriverMongo    = "mongo"
+	StoreDriverMemory   = "memory"
+	StoreDriverPostgres = "postgres"
+	StoreDriverBolt     = "bolt"
+)
+
+// Supported short code generators
+const (
+	ShortCodeRandom  = "random"
+	ShortCodeCounter = "counter"
+	ShortCodeHashids = "hashids"
+)
+
 type AppConfig struct {
-	Port                string `mapstructure:"port"`
-	RedisHost           string `mapstructure:"redis-host"`
-	RedisPass           string `mapstructure:"redis-pass"`
-	MongoHost           string `mapstructure:"mongo-host"`
-	MongoUser           string `mapstructure:"mongo-user"`
-	MongoPass           string `mapstructure:"mongo-pass"`
-	MongoDbName         string `mapstructure:"mongo-db-name"`
-	MongoCollectionName string `mapstructure:"mongo-collection-name"`
+	Port                string        `mapstructure:"port"`
+	MetricsPort         string        `mapstructure:"metrics-port"`
+	StoreDriver         string        `mapstructure:"store"`
+	Embedded            bool          `mapstructure:"embedded"`
+	EmbeddedPath        string        `mapstructure:"embedded-path"`
+	RedisHost           string        `mapstructure:"redis-host"`
+	RedisPass           string        `mapstructure:"redis-pass"`
+	MongoHost           string        `mapstructure:"mongo-host"`
+	MongoUser           string        `mapstructure:"mongo-user"`
+	MongoPass           string        `mapstructure:"mongo-pass"`
+	MongoDbName         string        `mapstructure:"mongo-db-name"`
+	MongoCollectionName string        `mapstructure:"mongo-collection-name"`
+	PostgresHost        string        `mapstructure:"postgres-host"`
+	PostgresUser        string        `mapstructure:"postgres-user"`
+	PostgresPass        string        `mapstructure:"postgres-pass"`
+	PostgresDbName      string        `mapstructure:"postgres-db-name"`
+	PostgresSslMode     string        `mapstructure:"postgres-sslmode"`
+	ShortCodeGenerator  string        `mapstructure:"short-code-generator"`
+	ShortCodeLength     int           `mapstructure:"short-code-length"`
+	ShortCodeAlphabet   string        `mapstructure:"short-code-alphabet"`
+	ShortCodeSalt       string        `mapstructure:"short-code-salt"`
+	ExpirySweepInterval time.Duration `mapstructure:"expiry-sweep-interval"`
+	ExpiredRetention    time.Duration `mapstructure:"expired-retention"`
+	ClickQueueSize      int           `mapstructure:"click-queue-size"`
+	ClickWorkers        int           `mapstructure:"click-workers"`
+	ClickBatchSize      int           `mapstructure:"click-batch-size"`
+	ClickFlushInterval  time.Duration `mapstructure:"click-flush-interval"`
+	ClickIpSalt         string        `mapstructure:"click-ip-salt"`
+	Auth                bool          `mapstructure:"auth"`
+	AdminApiKey         string        `mapstructure:"admin-api-key"`
+	CreateRateLimit     int           `mapstructure:"create-rate-limit"`
+	CreateRateWindow    time.Duration `mapstructure:"create-rate-window"`
+	RedirectRateLimit   int           `mapstructure:"redirect-rate-limit"`
+	RedirectRateWindow  time.Duration `mapstructure:"redirect-rate-window"`
+	TrustedProxies      []string      `mapstructure:"trusted-proxies"`
+	DefaultRedirectType int           `mapstructure:"default-redirect-type"`
+	DedupePolicy        string        `mapstructure:"dedupe-policy"`
+	PublicBaseUrl       string        `mapstructure:"public-base-url"`
+	UrlSchemes          []string      `mapstructure:"url-schemes"`
+	UrlSortQuery        bool          `mapstructure:"url-sort-query"`
+	UrlStripTracking    bool          `mapstructure:"url-strip-tracking-params"`
+	UrlStripWww         bool          `mapstructure:"url-strip-www"`
+}
+
+var ErrInvalidConfig = errors.New("Invalid configuration")
+
+// Check rejects settings that the server cannot start with
+func (cfg AppConfig) Check() error {
+
+	if cfg.PublicBaseUrl != "" {
+		if err := checkBaseUrl(cfg.PublicBaseUrl); err != nil {
+			return fmt.Errorf("public-base-url %q %v. Err=%w", cfg.PublicBaseUrl, err, ErrInvalidConfig)
+		}
+	}
+	if cfg.MetricsPort != "" && cfg.MetricsPort == cfg.Port {
+		return fmt.Errorf("metrics-port must differ from port, so that metrics stay private. Err=%w", ErrInvalidConfig)
+	}
+	if len(cfg.UrlSchemes) == 0 {
+		return fmt.Errorf("url-schemes must allow at least one scheme. Err=%w", ErrInvalidConfig)
+	}
+	for _, cidr := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("trusted-proxies %q is not a CIDR such as 10.0.0.0/8. Err=%w", cidr, ErrInvalidConfig)
+		}
+	}
+	return nil
 }
 
-func (cfg AppConfig) Check() bool {
+// BaseUrl is where the links of the default domain are served from. Without a
+// public-base-url, that is this server on localhost, e.g. http://localhost:8080
+func (cfg AppConfig) BaseUrl() string {
+	if cfg.PublicBaseUrl != "" {
+		return strings.TrimSuffix(cfg.PublicBaseUrl, "/")
+	}
+	return "http://localhost:" + cfg.Port
+}
 
-	return true
+// checkBaseUrl makes sure that short codes can be appended to base, e.g. https://gate.ly
+func checkBaseUrl(base string) error {
+	u, err := url.Parse(base)
+	if err != nil {
+		return errors.New("is not a URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("must start with http:// or https://")
+	}
+	if u.Host == "" || u.Hostname() == "" {
+		return errors.New("has no host")
+	}
+	if u.User != nil || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" || u.Opaque != "" {
+		return errors.New("may only have a scheme, a host, a port and a path")
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return errors.New("has an invalid port")
+		}
+	}
+	return nil
 }
@@ -7,136 +7,450 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"gately/internal/auth"
+	"gately/internal/canonical"
+	"gately/internal/clicks"
 	"gately/internal/config"
 	"gately/internal/dal"
 	"gately/internal/multicache"
+	"gately/internal/ratelimit"
 	"gately/internal/service"
+	"gately/internal/telemetry"
+	"gately/internal/uniques"
 	"github.com/labstack/echo/v4"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type AppController struct {
-	uss *service.UrlShorteningService
+	uss    *service.UrlShorteningService
+	auth   *auth.Authenticator
+	clicks *clicks.Pipeline
+	// Rate limits of the create and redirect routes
+	limiter       ratelimit.Limiter
+	createLimit   ratelimit.Limit
+	redirectLimit ratelimit.Limit
+	// Short urls of the default domain start with it, e.g. https://gate.ly
+	baseUrl string
+	// Stops background jobs such as the expiry sweeper
+	stop        context.CancelFunc
+	closeStores func() error
 }
 
 type (
 	UrlMappingResponse struct {
-		LongUrl  string `json:"long_url"`
-		ShortUrl string `json:"short_url"`
-		Ts       string `json:"time"`
+		LongUrl   string     `json:"long_url"`
+		ShortUrl  string     `json:"short_url"`
+		Ts        string     `json:"time"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		// Omitted when the link uses the server default
+		RedirectType int `json:"redirect_type,omitempty"`
 	}
 
 	UrlMappingRequest struct {
 		LongUrl string `json:"long_url"`
+		// Optional vanity short code, e.g. "spring-sale"
+		Alias string `json:"alias,omitempty"`
+		// Optional absolute expiry in RFC 3339 format
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		// Optional lifetime in seconds, up to a century. Mutually exclusive with ExpiresAt
+		TtlSeconds int64 `json:"ttl_seconds,omitempty"`
+		// Optional redirect status, one of 301, 302, 307 and 308. The server default if absent
+		RedirectType int `json:"redirect_type,omitempty"`
+		// Optional custom domain of the workspace, e.g. go.acme.com. The default domain if absent
+		Domain string `json:"domain,omitempty"`
+	}
+
+	// Absent fields are left unchanged
+	UrlMappingUpdateRequest struct {
+		LongUrl    *string    `json:"long_url,omitempty"`
+		ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+		TtlSeconds int64      `json:"ttl_seconds,omitempty"`
+		// Removes the expiry of the link
+		NeverExpires bool `json:"never_expires,omitempty"`
+		// 0 reverts to the server default
+		RedirectType *int `json:"redirect_type,omitempty"`
+	}
+
+	UrlRollbackRequest struct {
+		// Version to restore, as listed by the history endpoint
+		Version int `json:"version"`
+	}
+
+	UrlHistoryResponse struct {
+		ShortUrl  string               `json:"short_url"`
+		ShortLink string               `json:"short_link"`
+		Versions  []service.UrlVersion `json:"versions"`
+	}
+
+	// UrlEntryResponse is a stored URL mapping together with its full short url
+	UrlEntryResponse struct {
+		*dal.UrlMappingEntry
+		ShortLink string `json:"short_link"`
 	}
 )
 
-type MetricsResponse struct {
-	metrics []*dal.UrlMappingEntry
-}
+const (
+	// Header that names who makes a change, for the history of a short url
+	actorHeader = "X-Actor"
+
+	// Range of the stats endpoint when from is not given
+	defaultStatsRange = 7 * 24 * time.Hour
+
+	// How long clients may remember a permanent redirect. Bounded, so that a
+	// retargeted link reaches everyone eventually
+	permanentRedirectMaxAge = 24 * time.Hour
+
+	// Upper bound of ttl_seconds, a century, so that the expiry cannot overflow
+	maxTtlSeconds = 100 * 365 * 24 * 60 * 60
+)
+
+type MetricsResponse = service.MetricsPage
 
-func New(cfg config.AppConfig) *AppController {
+func New(cfg config.AppConfig, metrics *telemetry.Metrics) *AppController {
 
 	// Instantiate our multicache
 	// This follows a dual layered caching strategy
-	cache := multicache.New(cfg)
-
-	// Instantiate MongoDB Client
-	// MongoDB is our source of truth for all URL mappings
-	// This is a read heavy application and MongoDB is best suited for read heavy apps
-	mongoURI := fmt.Sprintf("%s://%s", "mongodb", cfg.MongoHost)
+	redisClient := multicache.NewRedisClient(cfg)
+	cache := multicache.New(redisClient)
+	metrics.RegisterCache(cache)
+
+	// Unique visitors and rate limits are counted in Redis when it is there, so that all instances share them
+	var visitors uniques.Counter = uniques.NewMemoryCounter()
+	limiter := ratelimit.NewMemoryLimiter()
+	if redisClient != nil {
+		visitors = uniques.NewRedisCounter(redisClient)
+		limiter = ratelimit.NewRedisLimiter(redisClient)
+	}
 
-	mongoClient, err := mongo.Connect(context.TODO(),
-		options.Client().ApplyURI(mongoURI),
-	)
+	stores, err := dal.Open(cfg, dal.WithBootstrap())
 	if err != nil {
 		// Ok to panic as we are still in application bootstrap
 		panic(err)
 	}
+	urlStore := metrics.InstrumentUrlStore(stores.Urls)
+	clickStore := stores.Clicks
 
-	// Try to ping MongoDB to test connectivity
-	if err := mongoClient.Ping(context.TODO(), readpref.Primary()); err != nil {
+	generator, err := newShortCodeGenerator(cfg)
+	if err != nil {
 		// Ok to panic as we are still in application bootstrap
 		panic(err)
 	}
-
-	if err := mongoClient.Database(cfg.MongoDbName).CreateCollection(context.TODO(), cfg.MongoCollectionName, nil); err != nil {
-		log.Fatalf("Unable to create MongoDB collection. Err=%v", err)
+	if err := service.CheckRedirectType(cfg.DefaultRedirectType); err != nil {
+		panic(err)
+	}
+	if err := service.CheckDedupePolicy(dal.DedupePolicy(cfg.DedupePolicy)); err != nil {
+		panic(err)
 	}
 
-	log.Printf("Successfully created MongoDB collection to store URLs")
-	urlStore := dal.New(dal.WithMongoClient(mongoClient), dal.WithDatabase(cfg.MongoDbName), dal.WithTable(cfg.MongoCollectionName))
+	// Clicks are recorded in the background, off the redirect path
+	pipeline := clicks.New(
+		clicks.WithUrlStore(urlStore),
+		clicks.WithClickStore(clickStore),
+		clicks.WithUniqueCounter(visitors),
+		clicks.WithQueueSize(cfg.ClickQueueSize),
+		clicks.WithWorkers(cfg.ClickWorkers),
+		clicks.WithBatchSize(cfg.ClickBatchSize),
+		clicks.WithFlushInterval(cfg.ClickFlushInterval),
+	)
+	metrics.RegisterClickPipeline(pipeline)
 
 	urlServ := service.New(
 		service.WithMultiCache(cache),
 		service.WithUrlStore(urlStore),
+		service.WithClickStore(clickStore),
+		service.WithUniqueCounter(visitors),
+		service.WithShortCodeGenerator(generator),
+		service.WithClickPipeline(pipeline),
+		service.WithWorkspaceStore(stores.Workspaces),
+		service.WithDomainStore(stores.Domains),
+		service.WithDefaultRedirectType(cfg.DefaultRedirectType),
+		service.WithDedupePolicy(dal.DedupePolicy(cfg.DedupePolicy)),
+		service.WithCanonicalizer(newCanonicalizer(cfg)),
+		service.WithIpHashSalt(cfg.ClickIpSalt),
 	)
-	fmt.Print("Successfully connected to MongoDB and Redis")
-	return &AppController{uss: urlServ}
+
+	ctx, stop := context.WithCancel(context.Background())
+	if cfg.ExpirySweepInterval > 0 {
+		go urlServ.RunExpirySweeper(ctx, cfg.ExpirySweepInterval, cfg.ExpiredRetention)
+	}
+
+	fmt.Print("Successfully connected to the URL store and cache")
+	return &AppController{
+		uss:           urlServ,
+		auth:          auth.New(stores.Keys, auth.WithAdminKey(cfg.AdminApiKey)),
+		clicks:        pipeline,
+		limiter:       limiter,
+		createLimit:   ratelimit.Limit{Requests: cfg.CreateRateLimit, Window: cfg.CreateRateWindow},
+		redirectLimit: ratelimit.Limit{Requests: cfg.RedirectRateLimit, Window: cfg.RedirectRateWindow},
+		baseUrl:       cfg.BaseUrl(),
+		stop:          stop,
+		closeStores:   stores.Close,
+	}
+}
+
+// Close stops background jobs, flushes the clicks that are still queued and closes the stores
+func (ctrlr *AppController) Close(ctx context.Context) error {
+	ctrlr.stop()
+	if err := ctrlr.clicks.Close(ctx); err != nil {
+		return err
+	}
+	return ctrlr.closeStores()
+}
+
+// newShortCodeGenerator builds the ShortCodeGenerator selected by cfg.ShortCodeGenerator
+func newShortCodeGenerator(cfg config.AppConfig) (service.ShortCodeGenerator, error) {
+
+	switch cfg.ShortCodeGenerator {
+	case config.ShortCodeRandom, "":
+		return service.NewRandomCodeGenerator(cfg.ShortCodeAlphabet, cfg.ShortCodeLength)
+	case config.ShortCodeCounter:
+		return service.NewCounterCodeGenerator(cfg.ShortCodeAlphabet, cfg.ShortCodeLength)
+	case config.ShortCodeHashids:
+		return service.NewHashidsCodeGenerator(cfg.ShortCodeAlphabet, cfg.ShortCodeSalt, cfg.ShortCodeLength)
+	default:
+		return nil, fmt.Errorf("Unknown short code generator %q", cfg.ShortCodeGenerator)
+	}
+}
+
+// newCanonicalizer applies the long url settings of cfg
+func newCanonicalizer(cfg config.AppConfig) *canonical.Canonicalizer {
+	opts := []canonical.Option{canonical.WithSchemes(cfg.UrlSchemes...)}
+	if cfg.UrlSortQuery {
+		opts = append(opts, canonical.WithSortedQuery())
+	}
+	if cfg.UrlStripTracking {
+		opts = append(opts, canonical.WithoutTrackingParams())
+	}
+	if cfg.UrlStripWww {
+		opts = append(opts, canonical.WithoutWwwPrefix())
+	}
+	return canonical.New(opts...)
 }
 
 // CreateUrlMapping godoc
 // @Summary Create a short URL
 // @Produce json
 // @Param data body UrlMappingRequest true "URL mapping request"
-// @Success 200 {object} UrlMappingResponse
+// @Success 201 {object} UrlMappingResponse
+// @Success 200 {object} UrlMappingResponse "The existing short URL, under the return-existing dedupe policy"
+// @Header 201 {string} Location "The fully qualified short URL"
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "The alias is already taken, or the URL is already mapped"
 // @Router /api/v1/urls [post]
 func (ctrlr *AppController) CreateUrlMapping(c echo.Context) error {
 
 	var req UrlMappingRequest
 	err := c.Bind(&req)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "bad request")
+		return errInvalidBody
+	}
+
+	sanitized, err := ctrlr.uss.CanonicalizeUrl(req.LongUrl)
+	if err != nil {
+		return err
+	}
+	expiresAt, err := resolveExpiry(req.ExpiresAt, req.TtlSeconds)
+	if err != nil {
+		return err
+	}
+
+	entry, created, err := ctrlr.uss.CreateUrlMapping(c.Request().Context(), sanitized, service.MappingOptions{
+		Alias:        req.Alias,
+		ExpiresAt:    expiresAt,
+		RedirectType: req.RedirectType,
+		Domain:       req.Domain,
+	})
+
+	if err != nil {
+		log.Printf("Unable to create a URL mapping for %s. Err = %v", sanitized, err)
+		return err
+	}
+	link := ctrlr.shortLink(c, entry.ShortUrl)
+
+	// An existing mapping is returned as it is stored, with its own expiry and redirect type
+	resp := &UrlMappingResponse{
+		LongUrl:      entry.LongUrl,
+		ShortUrl:     link,
+		Ts:           time.Now().String(),
+		RedirectType: entry.RedirectType,
+	}
+	if entry.ExpiresAt != 0 {
+		expiry := time.Unix(entry.ExpiresAt, 0).UTC()
+		resp.ExpiresAt = &expiry
+	}
+	c.Response().Header().Set(echo.HeaderLocation, link)
+
+	if !created {
+		log.Printf("Returning existing URL mapping : %+v ", resp)
+		return c.JSONPretty(http.StatusOK, resp, "  ")
 	}
+	log.Printf("Successfully created URL mapping : %+v ", resp)
+	return c.JSONPretty(http.StatusCreated, resp, "  ")
 
-	sanitized, valid := ctrlr.uss.CheckAndSanitizeUrl(req.LongUrl)
+}
 
-	if !valid {
-		return c.String(http.StatusBadRequest, "Malformed URL")
+// resolveExpiry turns the requested expiry into a unix time. Zero means the link never expires
+func resolveExpiry(expiresAt *time.Time, ttlSeconds int64) (int64, error) {
+	switch {
+	case expiresAt != nil && ttlSeconds != 0:
+		return 0, newAPIError(http.StatusBadRequest, CodeInvalidExpiry, "Specify either expires_at or ttl_seconds, not both")
+	case ttlSeconds < 0:
+		return 0, newAPIError(http.StatusBadRequest, CodeInvalidExpiry, "ttl_seconds must be positive")
+	case ttlSeconds > maxTtlSeconds:
+		return 0, newAPIError(http.StatusBadRequest, CodeInvalidExpiry, "ttl_seconds must be at most %d", maxTtlSeconds)
+	case ttlSeconds > 0:
+		return time.Now().Unix() + ttlSeconds, nil
+	case expiresAt != nil:
+		return expiresAt.Unix(), nil
 	}
-	mapped, err := ctrlr.uss.CreateUrlMapping(c.Request().Context(), sanitized)
+	return 0, nil
+}
 
-	if err != nil || mapped == "" {
+// UpdateUrlMapping godoc
+// @Summary Retarget a short URL or change its expiry
+// @Produce json
+// @Param id path string true "The alphanumeric string that identifies a URL"
+// @Param domain query string false "Custom domain of the short URL"
+// @Param data body UrlMappingUpdateRequest true "Fields to update"
+// @Success 200 {object} UrlEntryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "The new URL is already mapped"
+// @Router /api/v1/urls/{id} [patch]
+func (ctrlr *AppController) UpdateUrlMapping(c echo.Context) error {
+
+	urlId := shortUrlFrom(c)
+
+	var req UrlMappingUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
 
-		if errors.Is(err, dal.ErrUrlEntryAlreadyExists) {
-			log.Printf("URL already exists Mapped = %s .Err = %v", mapped, err)
-			return c.String(http.StatusBadRequest, err.Error())
+	update := &dal.UrlEntryUpdate{Actor: actorFrom(c)}
+	if req.LongUrl != nil {
+		sanitized, err := ctrlr.uss.CanonicalizeUrl(*req.LongUrl)
+		if err != nil {
+			return err
 		}
+		update.LongUrl = &sanitized
+	}
 
-		log.Printf("Unable to create a URL mapping. Mapped = %s .Err = %v", mapped, err)
-		return c.String(http.StatusBadRequest, err.Error())
+	expiresAt, err := resolveExpiry(req.ExpiresAt, req.TtlSeconds)
+	if err != nil {
+		return err
+	}
+	if req.NeverExpires && expiresAt != 0 {
+		return newAPIError(http.StatusBadRequest, CodeInvalidExpiry, "never_expires cannot be combined with an expiry")
 	}
+	if req.NeverExpires || expiresAt != 0 {
+		update.ExpiresAt = &expiresAt
+	}
+	update.RedirectType = req.RedirectType
 
-	resp := &UrlMappingResponse{
-		LongUrl:  req.LongUrl,
-		ShortUrl: mapped,
-		Ts:       time.Now().String(),
+	entry, err := ctrlr.uss.UpdateUrlMapping(c.Request().Context(), urlId, update)
+	if err != nil {
+		return notFoundFor(urlId, err)
 	}
 
-	log.Printf("Successfully created URL mapping : %+v ", resp)
+	log.Printf("Successfully updated URL mapping : %+v ", entry)
+	return c.JSONPretty(http.StatusOK, ctrlr.entryResponse(c, entry), "  ")
+}
 
-	return c.JSONPretty(http.StatusCreated, resp, "  ")
+// GetUrlHistory godoc
+// @Summary List every destination a short URL has had
+// @Produce json
+// @Param id path string true "The alphanumeric string that identifies a URL"
+// @Param domain query string false "Custom domain of the short URL"
+// @Success 200 {object} UrlHistoryResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/urls/{id}/history [get]
+func (ctrlr *AppController) GetUrlHistory(c echo.Context) error {
+
+	urlId := shortUrlFrom(c)
+
+	versions, err := ctrlr.uss.GetUrlHistory(c.Request().Context(), urlId)
+	if err != nil {
+		return notFoundFor(urlId, err)
+	}
+
+	resp := &UrlHistoryResponse{ShortUrl: urlId, ShortLink: ctrlr.shortLink(c, urlId), Versions: versions}
+	return c.JSONPretty(http.StatusOK, resp, "  ")
+}
+
+// RollbackUrlMapping godoc
+// @Summary Point a short URL back to one of its previous destinations
+// @Produce json
+// @Param id path string true "The alphanumeric string that identifies a URL"
+// @Param domain query string false "Custom domain of the short URL"
+// @Param data body UrlRollbackRequest true "Version to restore"
+// @Success 200 {object} UrlEntryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/urls/{id}/rollback [post]
+func (ctrlr *AppController) RollbackUrlMapping(c echo.Context) error {
+
+	urlId := shortUrlFrom(c)
+
+	var req UrlRollbackRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidBody
+	}
+
+	entry, err := ctrlr.uss.RollbackUrlMapping(c.Request().Context(), urlId, req.Version, actorFrom(c))
+	if err != nil {
+		return notFoundFor(urlId, err)
+	}
+
+	log.Printf("Rolled back %s to version %d", urlId, req.Version)
+	return c.JSONPretty(http.StatusOK, ctrlr.entryResponse(c, entry), "  ")
+}
+
+// shortUrlFrom is the short url that a management route refers to.
+// Links on a custom domain are named by the code and the domain query parameter.
+func shortUrlFrom(c echo.Context) string {
+	return dal.ShortKey(strings.ToLower(c.QueryParam("domain")), c.Param("urlId"))
+}
+
+// shortLink is the full short url of the link stored as shortUrl. Links of the default
+// domain start with the configured base url, never with the Host header of the request.
+func (ctrlr *AppController) shortLink(c echo.Context, shortUrl string) string {
+	return ctrlr.uss.ShortLink(c.Request().Context(), shortUrl, ctrlr.baseUrl)
+}
+
+// entryResponse adds the full short url to entry
+func (ctrlr *AppController) entryResponse(c echo.Context, entry *dal.UrlMappingEntry) *UrlEntryResponse {
+	return &UrlEntryResponse{UrlMappingEntry: entry, ShortLink: ctrlr.shortLink(c, entry.ShortUrl)}
+}
 
+// actorFrom names who makes a change. That is the owner of the API key, if any.
+// Otherwise clients identify themselves through the X-Actor header, or the client IP is recorded.
+func actorFrom(c echo.Context) string {
+	if p, ok := auth.FromContext(c.Request().Context()); ok {
+		return p.Owner
+	}
+	if actor := c.Request().Header.Get(actorHeader); actor != "" {
+		return actor
+	}
+	return c.RealIP()
 }
 
 // DeleteUrlMapping godoc
 // @Summary Delete a short URL
 // @Produce json
 // @Param id path string true "The alphanumeric string/UUID that identifies a URL"
+// @Param domain query string false "Custom domain of the short URL"
 // @Success 200
 // @Router /api/v1/urls/{id} [delete]
 func (ctrlr *AppController) DeleteUrlMapping(c echo.Context) error {
 
-	urlId := c.Param("urlId")
+	urlId := shortUrlFrom(c)
 
 	err := ctrlr.uss.DeleteUrlMapping(c.Request().Context(), urlId)
 
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, fmt.Sprintf("Unable to delete: %v", err))
+		return err
 	}
 	return c.NoContent(http.StatusOK)
 }
@@ -146,60 +460,170 @@ func (ctrlr *AppController) DeleteUrlMapping(c echo.Context) error {
 // @Produce json
 // @Param start query string true "Start time for metrics"
 // @Param end query string true "End time for metrics"
-// @Param sort query string true "Sort can be asc or desc"
+// @Param sort query string false "Sort can be asc or desc. Defaults to desc"
+// @Param limit query int false "Entries per page, at most 1000. Defaults to 100"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param top query int false "Only the N most accessed URLs, without further pages"
 // @Success 200 {object} MetricsResponse
-// @Router /api/v1/urls/{id} [get]
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/metrics [get]
 func (ctrlr *AppController) GetUrlMetrics(c echo.Context) error {
 
-	sortOrder := c.QueryParam("sort")
-
-	start, err := strconv.ParseInt(c.QueryParam("start"), 10, 64)
+	query, top, err := parseMetricsQuery(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, fmt.Sprintf("Invalid start time: %v", err))
+		return err
 	}
 
-	end, err := strconv.ParseInt(c.QueryParam("end"), 10, 64)
+	page, err := ctrlr.uss.GetUrlMetrics(c.Request().Context(), query)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, fmt.Sprintf("Invalid end time: %v", err))
+		return err
 	}
+	if top {
+		page.NextCursor = ""
+	}
+	for _, metrics := range page.Metrics {
+		metrics.ShortLink = ctrlr.shortLink(c, metrics.ShortUrl)
+	}
+	return c.JSONPretty(http.StatusOK, page, "  ")
+}
+
+// parseMetricsQuery validates the query parameters of GetUrlMetrics.
+// top reports whether only the first page was asked for.
+func parseMetricsQuery(c echo.Context) (query dal.MetricsQuery, top bool, err error) {
 
-	var asc bool
-	if sortOrder == "asc" {
-		asc = true
+	if query.Start, err = strconv.ParseInt(c.QueryParam("start"), 10, 64); err != nil {
+		return query, false, invalidQuery("Invalid start time: %v", err)
+	}
+	if query.End, err = strconv.ParseInt(c.QueryParam("end"), 10, 64); err != nil {
+		return query, false, invalidQuery("Invalid end time: %v", err)
+	}
+
+	switch c.QueryParam("sort") {
+	case "asc":
+		query.Asc = true
+	case "desc", "":
+	default:
+		return query, false, invalidQuery("Invalid sort %q: must be asc or desc", c.QueryParam("sort"))
 	}
 
-	if sortOrder == "desc" {
-		asc = false
+	if limit := c.QueryParam("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 {
+			return query, false, invalidQuery("Invalid limit %q: must be a positive number", limit)
+		}
+	}
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		if query.After, err = service.DecodeMetricsCursor(cursor); err != nil {
+			return query, false, err
+		}
 	}
 
-	metrics, err := ctrlr.uss.GetUrlMetrics(c.Request().Context(), start, end, asc)
+	// Top N is the first page of the most accessed URLs
+	if n := c.QueryParam("top"); n != "" {
+		if query.Asc || query.Limit != 0 || query.After != nil {
+			return query, false, invalidQuery("top cannot be combined with sort=asc, limit or cursor")
+		}
+		if query.Limit, err = strconv.Atoi(n); err != nil || query.Limit < 1 {
+			return query, false, invalidQuery("Invalid top %q: must be a positive number", n)
+		}
+		top = true
+	}
+	return query, top, nil
+}
 
+// GetUrlStats godoc
+// @Summary Get click counts of a short URL per time bucket, referrer domain and device class
+// @Produce json
+// @Param id path string true "The alphanumeric string that identifies a URL"
+// @Param domain query string false "Custom domain of the short URL"
+// @Param from query string false "Start of the range, as unix seconds or RFC 3339. Defaults to 7 days before to"
+// @Param to query string false "End of the range, as unix seconds or RFC 3339. Defaults to now"
+// @Param granularity query string false "hour, day or week. Defaults to day"
+// @Success 200 {object} service.UrlStats
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/urls/{id}/stats [get]
+func (ctrlr *AppController) GetUrlStats(c echo.Context) error {
+
+	urlId := shortUrlFrom(c)
+
+	to, err := parseTimeParam(c.QueryParam("to"), time.Now())
+	if err != nil {
+		return invalidQuery("Invalid to time: %v", err)
+	}
+	from, err := parseTimeParam(c.QueryParam("from"), to.Add(-defaultStatsRange))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, fmt.Sprintf("Unable to get Url metrics: %v", err))
+		return invalidQuery("Invalid from time: %v", err)
+	}
+	granularity := service.GranularityDay
+	if g := c.QueryParam("granularity"); g != "" {
+		granularity = service.Granularity(g)
 	}
-	return c.JSONPretty(http.StatusOK, metrics, "  ")
+
+	stats, err := ctrlr.uss.GetUrlStats(c.Request().Context(), urlId, from.Unix(), to.Unix(), granularity)
+	if err != nil {
+		return notFoundFor(urlId, err)
+	}
+	return c.JSONPretty(http.StatusOK, stats, "  ")
+}
+
+// parseTimeParam accepts unix seconds or RFC 3339. An empty value yields def
+func parseTimeParam(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
 }
 
 // RedirectUrl godoc
 // @Summary Redirect to short URL
-// @Success 302
+// @Success 301 "Permanent redirect, per the redirect_type of the link"
+// @Success 302 "Temporary redirect, the server default"
+// @Success 307
+// @Success 308
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse "The short URL has expired"
 // @Router /{id} [get]
 func (ctrlr *AppController) RedirectUrl(c echo.Context) error {
 
-	urlId := c.Param("urlId")
-	longUrl, err := ctrlr.uss.RedirectUrl(c.Request().Context(), urlId)
-
-	if longUrl == "" || err != nil {
+	req := c.Request()
+	// The same code can lead elsewhere on each custom domain
+	urlId := ctrlr.uss.ShortUrlFor(req.Context(), req.Host, c.Param("urlId"))
+	redirect, err := ctrlr.uss.RedirectUrl(req.Context(), urlId, service.Visit{
+		Referrer:       req.Referer(),
+		UserAgent:      req.UserAgent(),
+		AcceptLanguage: req.Header.Get("Accept-Language"),
+		Ip:             c.RealIP(),
+	})
 
-		switch err {
-
-		case dal.ErrUrlEntryNotFound:
-			return c.JSON(http.StatusNotFound, fmt.Sprintf("No short URL found for %s", urlId))
-		default:
-			return c.JSON(http.StatusInternalServerError, "Internal Server error")
+	if err != nil {
+		if errors.Is(err, dal.ErrUrlEntryExpired) {
+			return newAPIError(http.StatusGone, CodeExpired, "Short URL %s has expired", urlId)
 		}
-
+		return notFoundFor(urlId, err)
 	}
+	c.Response().Header().Set(echo.HeaderCacheControl, cacheControlFor(redirect, time.Now()))
 	// Redirect to the original URL
-	return c.Redirect(http.StatusSeeOther, longUrl)
+	return c.Redirect(redirect.Status, redirect.LongUrl)
+}
+
+// cacheControlFor lets clients remember permanent redirects, up to the expiry of the link.
+// Temporary redirects are never stored, so that every visit reaches the server and is counted.
+func cacheControlFor(redirect *service.Redirect, now time.Time) string {
+	if !redirect.Permanent() {
+		return "no-store"
+	}
+	maxAge := permanentRedirectMaxAge
+	if redirect.ExpiresAt != 0 {
+		if untilExpiry := time.Unix(redirect.ExpiresAt, 0).Sub(now); untilExpiry < maxAge {
+			maxAge = untilExpiry
+		}
+	}
+	// A link that expires within the second, or that a stale cache entry still redirects, is not stored
+	if maxAge < time.Second {
+		return "no-store"
+	}
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge.Seconds()))
 }
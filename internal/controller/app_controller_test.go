@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gately/internal/dal"
+	"gately/internal/multicache"
+	"gately/internal/service"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheControlFor(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name         string
+		status       int
+		expiresAt    int64
+		cacheControl string
+	}{
+		{"found", http.StatusFound, 0, "no-store"},
+		{"temporary redirect", http.StatusTemporaryRedirect, 0, "no-store"},
+		{"moved permanently", http.StatusMovedPermanently, 0, "public, max-age=86400"},
+		{"permanent redirect", http.StatusPermanentRedirect, 0, "public, max-age=86400"},
+		{"expires after the max age", http.StatusMovedPermanently, now.Add(48 * time.Hour).Unix(), "public, max-age=86400"},
+		{"expires before the max age", http.StatusMovedPermanently, now.Add(time.Hour).Unix(), "public, max-age=3600"},
+		{"temporary and expiring", http.StatusFound, now.Add(time.Hour).Unix(), "no-store"},
+		{"expires now", http.StatusPermanentRedirect, now.Unix(), "no-store"},
+		{"expired", http.StatusPermanentRedirect, now.Add(-time.Hour).Unix(), "no-store"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect := &service.Redirect{LongUrl: "https://example.com", Status: tt.status, ExpiresAt: tt.expiresAt}
+			assert.Equal(t, tt.cacheControl, cacheControlFor(redirect, now))
+		})
+	}
+}
+
+func TestResponsesCarryFullShortLinks(t *testing.T) {
+	ctrlr := &AppController{
+		uss:     service.New(service.WithMultiCache(multicache.New(nil)), service.WithUrlStore(dal.NewMemoryUrlStore())),
+		baseUrl: "https://gate.ly",
+	}
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.POST("/api/v1/urls", ctrlr.CreateUrlMapping)
+	e.PATCH("/api/v1/urls/:urlId", ctrlr.UpdateUrlMapping)
+	e.GET("/api/v1/urls/:urlId/history", ctrlr.GetUrlHistory)
+	e.POST("/api/v1/urls/:urlId/rollback", ctrlr.RollbackUrlMapping)
+	e.GET("/api/v1/metrics", ctrlr.GetUrlMetrics)
+
+	// The Host header is up to the client and never makes it into a link
+	serve := func(method, target, body string, out interface{}) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Host = "attacker.example"
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Less(t, rec.Code, 300, rec.Body.String())
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out))
+	}
+
+	var created UrlMappingResponse
+	serve(http.MethodPost, "/api/v1/urls", `{"long_url":"https://example.com/a"}`, &created)
+	require.True(t, strings.HasPrefix(created.ShortUrl, "https://gate.ly/"), created.ShortUrl)
+	code := strings.TrimPrefix(created.ShortUrl, "https://gate.ly/")
+
+	var updated UrlEntryResponse
+	serve(http.MethodPatch, "/api/v1/urls/"+code, `{"long_url":"https://example.com/b"}`, &updated)
+	assert.Equal(t, created.ShortUrl, updated.ShortLink)
+	assert.Equal(t, code, updated.ShortUrl)
+
+	var history UrlHistoryResponse
+	serve(http.MethodGet, "/api/v1/urls/"+code+"/history", "", &history)
+	assert.Equal(t, created.ShortUrl, history.ShortLink)
+
+	var rolledBack UrlEntryResponse
+	serve(http.MethodPost, "/api/v1/urls/"+code+"/rollback", `{"version":1}`, &rolledBack)
+	assert.Equal(t, created.ShortUrl, rolledBack.ShortLink)
+
+	var metrics MetricsResponse
+	serve(http.MethodGet, "/api/v1/metrics?start=0&end=4000000000", "", &metrics)
+	require.Len(t, metrics.Metrics, 1)
+	assert.Equal(t, created.ShortUrl, metrics.Metrics[0].ShortLink)
+}
+
+func TestCreateUrlMappingAliasErrors(t *testing.T) {
+	ctrlr := &AppController{
+		uss:     service.New(service.WithMultiCache(multicache.New(nil)), service.WithUrlStore(dal.NewMemoryUrlStore())),
+		baseUrl: "https://gate.ly",
+	}
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.POST("/api/v1/urls", ctrlr.CreateUrlMapping)
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/urls", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   ErrorCode
+	}{
+		{"reserved", `{"long_url":"https://example.com/a","alias":"Metrics"}`, http.StatusBadRequest, CodeReservedAlias},
+		{"invalid", `{"long_url":"https://example.com/a","alias":"a/b"}`, http.StatusBadRequest, CodeInvalidAlias},
+		{"taken", `{"long_url":"https://example.com/b","alias":"launch"}`, http.StatusConflict, CodeAliasTaken},
+	}
+	require.Equal(t, http.StatusCreated, create(`{"long_url":"https://example.com/a","alias":"launch"}`).Code)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := create(tt.body)
+			assert.Equal(t, tt.status, rec.Code)
+			var resp ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+		})
+	}
+}
+
+func TestResolveExpiry(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name       string
+		expiresAt  *time.Time
+		ttlSeconds int64
+		valid      bool
+	}{
+		{"never", nil, 0, true},
+		{"expires_at", &at, 0, true},
+		{"ttl", nil, 3600, true},
+		{"ttl at the limit", nil, maxTtlSeconds, true},
+		{"ttl over the limit", nil, maxTtlSeconds + 1, false},
+		{"ttl that overflows", nil, math.MaxInt64, false},
+		{"ttl in the past", nil, -1, false},
+		{"both", &at, 3600, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now().Unix()
+			expiresAt, err := resolveExpiry(tt.expiresAt, tt.ttlSeconds)
+			if !tt.valid {
+				var apiErr *APIError
+				require.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, CodeInvalidExpiry, apiErr.Code)
+				return
+			}
+			require.NoError(t, err)
+			switch {
+			case tt.expiresAt != nil:
+				assert.Equal(t, tt.expiresAt.Unix(), expiresAt)
+			case tt.ttlSeconds > 0:
+				assert.GreaterOrEqual(t, expiresAt, before+tt.ttlSeconds)
+				assert.LessOrEqual(t, expiresAt, time.Now().Unix()+tt.ttlSeconds)
+			default:
+				assert.Zero(t, expiresAt)
+			}
+		})
+	}
+}
+
+func TestExpiryOverHttp(t *testing.T) {
+	store := dal.NewMemoryUrlStore()
+	ctrlr := &AppController{
+		uss:     service.New(service.WithMultiCache(multicache.New(nil)), service.WithUrlStore(store)),
+		baseUrl: "https://gate.ly",
+	}
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.POST("/api/v1/urls", ctrlr.CreateUrlMapping)
+	e.GET("/:urlId", ctrlr.RedirectUrl)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	rec := serve(http.MethodPost, "/api/v1/urls", `{"long_url":"https://example.com/a","expires_at":"`+past+`"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(http.MethodPost, "/api/v1/urls", fmt.Sprintf(`{"long_url":"https://example.com/a","ttl_seconds":%d}`, int64(maxTtlSeconds)+1))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Expired, but not purged yet
+	require.NoError(t, store.AddUrlEntry(context.Background(), &dal.UrlMappingEntry{
+		ShortUrl: "gone", LongUrl: "https://example.com/gone", ExpiresAt: time.Now().Unix() - 60}))
+	rec = serve(http.MethodGet, "/gone", "")
+	assert.Equal(t, http.StatusGone, rec.Code)
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, CodeExpired, resp.Code)
+}
+
+func TestParseMetricsQuery(t *testing.T) {
+	cursor := service.EncodeMetricsCursor(&dal.MetricsCursor{Hits: 5, ShortUrl: "abc"})
+
+	tests := []struct {
+		name  string
+		query string
+		want  dal.MetricsQuery
+		top   bool
+		valid bool
+	}{
+		{"range only", "start=0&end=100", dal.MetricsQuery{End: 100}, false, true},
+		{"ascending page", "start=0&end=100&sort=asc&limit=10", dal.MetricsQuery{End: 100, Asc: true, Limit: 10}, false, true},
+		{"next page", "start=0&end=100&limit=10&cursor=" + cursor,
+			dal.MetricsQuery{End: 100, Limit: 10, After: &dal.MetricsCursor{Hits: 5, ShortUrl: "abc"}}, false, true},
+		{"top", "start=0&end=100&top=3", dal.MetricsQuery{End: 100, Limit: 3}, true, true},
+		{"no start", "end=100", dal.MetricsQuery{}, false, false},
+		{"no end", "start=0", dal.MetricsQuery{}, false, false},
+		{"unknown sort", "start=0&end=100&sort=up", dal.MetricsQuery{}, false, false},
+		{"zero limit", "start=0&end=100&limit=0", dal.MetricsQuery{}, false, false},
+		{"negative limit", "start=0&end=100&limit=-1", dal.MetricsQuery{}, false, false},
+		{"limit not a number", "start=0&end=100&limit=ten", dal.MetricsQuery{}, false, false},
+		{"malformed cursor", "start=0&end=100&cursor=not-a-cursor!", dal.MetricsQuery{}, false, false},
+		{"tampered cursor", "start=0&end=100&cursor=" + base64.RawURLEncoding.EncodeToString([]byte("-5:abc")),
+			dal.MetricsQuery{}, false, false},
+		{"zero top", "start=0&end=100&top=0", dal.MetricsQuery{}, false, false},
+		{"top with a limit", "start=0&end=100&top=3&limit=10", dal.MetricsQuery{}, false, false},
+		{"top with a cursor", "start=0&end=100&top=3&cursor=" + cursor, dal.MetricsQuery{}, false, false},
+		{"top ascending", "start=0&end=100&top=3&sort=asc", dal.MetricsQuery{}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/metrics?"+tt.query, nil)
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			query, top, err := parseMetricsQuery(c)
+			if !tt.valid {
+				require.Error(t, err)
+				status, resp := toErrorResponse(err)
+				assert.Equal(t, http.StatusBadRequest, status)
+				assert.Equal(t, CodeInvalidQuery, resp.Code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, query)
+			assert.Equal(t, tt.top, top)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"gately/internal/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// Header for clients that cannot send an Authorization header
+const apiKeyHeader = "X-Api-Key"
+
+var errMissingApiKey = newAPIError(http.StatusUnauthorized, CodeUnauthorized,
+	"An API key is required. Send it as 'Authorization: Bearer <key>' or in the X-Api-Key header")
+
+// apiKeyFrom reads the API key of a request
+func apiKeyFrom(c echo.Context) string {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if scheme, key, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(key)
+	}
+	return c.Request().Header.Get(apiKeyHeader)
+}
+
+// Authenticate is the middleware of the management API. Requests without a
+// valid API key are rejected, the others carry the key's auth.Principal in their context.
+func (ctrlr *AppController) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := apiKeyFrom(c)
+		if key == "" {
+			return errMissingApiKey
+		}
+
+		req := c.Request()
+		principal, err := ctrlr.auth.Authenticate(req.Context(), key)
+		if err != nil {
+			return err
+		}
+		c.SetRequest(req.WithContext(auth.NewContext(req.Context(), principal)))
+		return next(c)
+	}
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gately/internal/auth"
+	"gately/internal/dal"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticateMiddleware(t *testing.T) {
+	ctx := context.Background()
+	authenticator := auth.New(dal.NewMemoryKeyStore())
+	ctrlr := &AppController{auth: authenticator}
+
+	raw, _, err := authenticator.CreateKey(ctx, "alice", "ci", "team-a", false)
+	require.NoError(t, err)
+	revoked, revokedKey, err := authenticator.CreateKey(ctx, "bob", "ci", "team-a", false)
+	require.NoError(t, err)
+	require.NoError(t, authenticator.RevokeKey(ctx, revokedKey.Id))
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/api/v1/urls", func(c echo.Context) error {
+		p, ok := auth.FromContext(c.Request().Context())
+		require.True(t, ok)
+		return c.String(http.StatusOK, p.Owner+"@"+p.Workspace)
+	}, ctrlr.Authenticate)
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+		code   ErrorCode
+	}{
+		{name: "missing key", status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "empty bearer", header: echo.HeaderAuthorization, value: "Bearer ", status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "malformed key", header: echo.HeaderAuthorization, value: "Bearer not-a-key", status: http.StatusUnauthorized, code: CodeInvalidApiKey},
+		{name: "wrong secret", header: apiKeyHeader, value: raw + "x", status: http.StatusUnauthorized, code: CodeInvalidApiKey},
+		{name: "basic auth", header: echo.HeaderAuthorization, value: "Basic " + raw, status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "revoked key", header: apiKeyHeader, value: revoked, status: http.StatusUnauthorized, code: CodeInvalidApiKey},
+		{name: "bearer", header: echo.HeaderAuthorization, value: "Bearer " + raw, status: http.StatusOK},
+		{name: "bearer in lower case", header: echo.HeaderAuthorization, value: "bearer " + raw, status: http.StatusOK},
+		{name: "api key header", header: apiKeyHeader, value: raw, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/urls", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.status == http.StatusOK {
+				assert.Equal(t, "alice@team-a", rec.Body.String())
+				return
+			}
+			var resp ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+			assert.NotContains(t, rec.Body.String(), raw)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"gately/internal/auth"
+	"gately/internal/canonical"
+	"gately/internal/dal"
+	"gately/internal/service"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorCode is a stable, machine readable identifier of an API error.
+// Clients switch on it, so existing codes must never change meaning.
+type ErrorCode string
+
+const (
+	CodeBadRequest          ErrorCode = "bad_request"
+	CodeInvalidBody         ErrorCode = "invalid_body"
+	CodeInvalidUrl          ErrorCode = "invalid_url"
+	CodeSchemeNotAllowed    ErrorCode = "scheme_not_allowed"
+	CodeInvalidAlias        ErrorCode = "invalid_alias"
+	CodeReservedAlias       ErrorCode = "reserved_alias"
+	CodeAliasTaken          ErrorCode = "alias_taken"
+	CodeUrlAlreadyExists    ErrorCode = "url_already_exists"
+	CodeInvalidExpiry       ErrorCode = "invalid_expiry"
+	CodeInvalidRedirectType ErrorCode = "invalid_redirect_type"
+	CodeUnknownDomain       ErrorCode = "unknown_domain"
+	CodeEmptyUpdate         ErrorCode = "empty_update"
+	CodeInvalidVersion      ErrorCode = "invalid_version"
+	CodeInvalidQuery        ErrorCode = "invalid_query"
+	CodeUnauthorized        ErrorCode = "unauthorized"
+	CodeInvalidApiKey       ErrorCode = "invalid_api_key"
+	CodeForbidden           ErrorCode = "forbidden"
+	CodeQuotaExceeded       ErrorCode = "quota_exceeded"
+	CodeRateLimited         ErrorCode = "rate_limited"
+	CodeNotFound            ErrorCode = "not_found"
+	CodeExpired             ErrorCode = "expired"
+	CodeMethodNotAllowed    ErrorCode = "method_not_allowed"
+	CodeShortCodeExhausted  ErrorCode = "short_code_exhausted"
+	CodeNotImplemented      ErrorCode = "not_implemented"
+	CodeInternal            ErrorCode = "internal_error"
+)
+
+// ErrorResponse is the body of every failed API request
+type ErrorResponse struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Also sent as the X-Request-Id header. Quote it when reporting a problem
+	RequestId string `json:"request_id,omitempty"`
+}
+
+// APIError is an error that already knows its HTTP status and code.
+// Handlers return it for failures that are detected in the controller itself.
+type APIError struct {
+	Status  int
+	Code    ErrorCode
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func newAPIError(status int, code ErrorCode, format string, args ...interface{}) *APIError {
+	return &APIError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	errInvalidBody = newAPIError(http.StatusBadRequest, CodeInvalidBody, "Malformed request body")
+)
+
+func invalidQuery(format string, args ...interface{}) *APIError {
+	return newAPIError(http.StatusBadRequest, CodeInvalidQuery, format, args...)
+}
+
+// notFoundFor names the short url in the message of a dal.ErrUrlEntryNotFound.
+// Other errors are returned unchanged.
+func notFoundFor(shortUrl string, err error) error {
+	if errors.Is(err, dal.ErrUrlEntryNotFound) {
+		return newAPIError(http.StatusNotFound, CodeNotFound, "No short URL found for %s", shortUrl)
+	}
+	return err
+}
+
+// Domain errors and how they are reported. The first match wins
+var errorMappings = []struct {
+	err    error
+	status int
+	code   ErrorCode
+}{
+	{auth.ErrInvalidApiKey, http.StatusUnauthorized, CodeInvalidApiKey},
+	{auth.ErrRevokedApiKey, http.StatusUnauthorized, CodeInvalidApiKey},
+	{service.ErrNotOwner, http.StatusForbidden, CodeForbidden},
+	{service.ErrQuotaExceeded, http.StatusForbidden, CodeQuotaExceeded},
+	{dal.ErrUrlEntryNotFound, http.StatusNotFound, CodeNotFound},
+	{dal.ErrUrlEntryExpired, http.StatusGone, CodeExpired},
+	{canonical.ErrInvalidUrl, http.StatusBadRequest, CodeInvalidUrl},
+	{canonical.ErrSchemeNotAllowed, http.StatusBadRequest, CodeSchemeNotAllowed},
+	{service.ErrAliasTaken, http.StatusConflict, CodeAliasTaken},
+	{dal.ErrUrlEntryAlreadyExists, http.StatusConflict, CodeUrlAlreadyExists},
+	{service.ErrInvalidAlias, http.StatusBadRequest, CodeInvalidAlias},
+	{service.ErrReservedAlias, http.StatusBadRequest, CodeReservedAlias},
+	{service.ErrInvalidExpiry, http.StatusBadRequest, CodeInvalidExpiry},
+	{service.ErrInvalidRedirectType, http.StatusBadRequest, CodeInvalidRedirectType},
+	{service.ErrUnknownDomain, http.StatusBadRequest, CodeUnknownDomain},
+	{service.ErrEmptyUpdate, http.StatusBadRequest, CodeEmptyUpdate},
+	{service.ErrInvalidVersion, http.StatusBadRequest, CodeInvalidVersion},
+	{service.ErrInvalidGranularity, http.StatusBadRequest, CodeInvalidQuery},
+	{service.ErrInvalidStatsRange, http.StatusBadRequest, CodeInvalidQuery},
+	{service.ErrInvalidMetricsQuery, http.StatusBadRequest, CodeInvalidQuery},
+	{service.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidQuery},
+	{service.ErrShortCodeExhausted, http.StatusServiceUnavailable, CodeShortCodeExhausted},
+	{service.ErrStatsUnavailable, http.StatusNotImplemented, CodeNotImplemented},
+}
+
+// codeForStatus names the errors that echo raises itself, e.g. for unknown routes
+func codeForStatus(status int) ErrorCode {
+	switch {
+	case status == http.StatusUnauthorized:
+		return CodeUnauthorized
+	case status == http.StatusForbidden:
+		return CodeForbidden
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case status == http.StatusTooManyRequests:
+		return CodeRateLimited
+	case status >= http.StatusInternalServerError:
+		return CodeInternal
+	default:
+		return CodeBadRequest
+	}
+}
+
+// toErrorResponse maps err to an HTTP status and the body that describes it
+func toErrorResponse(err error) (int, *ErrorResponse) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status, &ErrorResponse{Code: apiErr.Code, Message: apiErr.Message}
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code, &ErrorResponse{Code: codeForStatus(httpErr.Code), Message: fmt.Sprint(httpErr.Message)}
+	}
+
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			return m.status, &ErrorResponse{Code: m.code, Message: err.Error()}
+		}
+	}
+
+	// Anything else is a failure of ours. Its details stay in the log
+	return http.StatusInternalServerError, &ErrorResponse{Code: CodeInternal, Message: "Internal server error"}
+}
+
+// HTTPErrorHandler writes every error returned by a handler or middleware as an ErrorResponse
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, resp := toErrorResponse(err)
+	resp.RequestId = c.Response().Header().Get(echo.HeaderXRequestID)
+	if status >= http.StatusInternalServerError {
+		log.Printf("Request %s %s failed. RequestId=%s Err=%v", c.Request().Method, c.Request().URL.Path, resp.RequestId, err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, resp)
+	}
+	if err != nil {
+		log.Printf("Unable to write error response. Err=%v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gately/internal/auth"
+	"gately/internal/canonical"
+	"gately/internal/dal"
+	"gately/internal/service"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToErrorResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    ErrorCode
+		message string
+	}{
+		{"invalid api key", auth.ErrInvalidApiKey, http.StatusUnauthorized, CodeInvalidApiKey, ""},
+		{"revoked api key", auth.ErrRevokedApiKey, http.StatusUnauthorized, CodeInvalidApiKey, ""},
+		{"not owner", service.ErrNotOwner, http.StatusForbidden, CodeForbidden, ""},
+		{"quota exceeded", service.ErrQuotaExceeded, http.StatusForbidden, CodeQuotaExceeded, ""},
+		{"not found", dal.ErrUrlEntryNotFound, http.StatusNotFound, CodeNotFound, ""},
+		{"expired", dal.ErrUrlEntryExpired, http.StatusGone, CodeExpired, ""},
+		{"invalid url", canonical.ErrInvalidUrl, http.StatusBadRequest, CodeInvalidUrl, ""},
+		{"scheme not allowed", canonical.ErrSchemeNotAllowed, http.StatusBadRequest, CodeSchemeNotAllowed, ""},
+		{"alias taken", service.ErrAliasTaken, http.StatusConflict, CodeAliasTaken, ""},
+		{"url already exists", dal.ErrUrlEntryAlreadyExists, http.StatusConflict, CodeUrlAlreadyExists, ""},
+		{"invalid alias", service.ErrInvalidAlias, http.StatusBadRequest, CodeInvalidAlias, ""},
+		{"reserved alias", service.ErrReservedAlias, http.StatusBadRequest, CodeReservedAlias, ""},
+		{"invalid expiry", service.ErrInvalidExpiry, http.StatusBadRequest, CodeInvalidExpiry, ""},
+		{"invalid redirect type", service.ErrInvalidRedirectType, http.StatusBadRequest, CodeInvalidRedirectType, ""},
+		{"unknown domain", service.ErrUnknownDomain, http.StatusBadRequest, CodeUnknownDomain, ""},
+		{"empty update", service.ErrEmptyUpdate, http.StatusBadRequest, CodeEmptyUpdate, ""},
+		{"invalid version", service.ErrInvalidVersion, http.StatusBadRequest, CodeInvalidVersion, ""},
+		{"invalid granularity", service.ErrInvalidGranularity, http.StatusBadRequest, CodeInvalidQuery, ""},
+		{"invalid stats range", service.ErrInvalidStatsRange, http.StatusBadRequest, CodeInvalidQuery, ""},
+		{"invalid metrics query", service.ErrInvalidMetricsQuery, http.StatusBadRequest, CodeInvalidQuery, ""},
+		{"invalid cursor", service.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidQuery, ""},
+		{"short code exhausted", service.ErrShortCodeExhausted, http.StatusServiceUnavailable, CodeShortCodeExhausted, ""},
+		{"stats unavailable", service.ErrStatsUnavailable, http.StatusNotImplemented, CodeNotImplemented, ""},
+
+		{"wrapped sentinel", fmt.Errorf("Alias foo is taken. Err=%w", service.ErrAliasTaken),
+			http.StatusConflict, CodeAliasTaken, "Alias foo is taken. Err=" + service.ErrAliasTaken.Error()},
+		{"api error", notFoundFor("abc", dal.ErrUrlEntryNotFound),
+			http.StatusNotFound, CodeNotFound, "No short URL found for abc"},
+		{"wrapped api error", fmt.Errorf("Err=%w", errInvalidBody),
+			http.StatusBadRequest, CodeInvalidBody, "Malformed request body"},
+
+		{"echo not found", echo.ErrNotFound, http.StatusNotFound, CodeNotFound, "Not Found"},
+		{"echo method not allowed", echo.ErrMethodNotAllowed, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method Not Allowed"},
+		{"echo unauthorized", echo.NewHTTPError(http.StatusUnauthorized, "missing key"), http.StatusUnauthorized, CodeUnauthorized, "missing key"},
+		{"echo forbidden", echo.ErrForbidden, http.StatusForbidden, CodeForbidden, "Forbidden"},
+		{"echo too many requests", echo.ErrTooManyRequests, http.StatusTooManyRequests, CodeRateLimited, "Too Many Requests"},
+		{"echo bad request", echo.NewHTTPError(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType, CodeBadRequest, "Unsupported Media Type"},
+		{"echo internal", echo.ErrBadGateway, http.StatusBadGateway, CodeInternal, "Bad Gateway"},
+
+		{"unknown error", errors.New("connection refused"), http.StatusInternalServerError, CodeInternal, "Internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := toErrorResponse(tt.err)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.code, resp.Code)
+
+			message := tt.message
+			if message == "" {
+				message = tt.err.Error()
+			}
+			assert.Equal(t, message, resp.Message)
+		})
+	}
+}
+
+// The first match wins, so no sentinel may be shadowed by an earlier mapping
+func TestErrorMappingsAreReachable(t *testing.T) {
+	for _, m := range errorMappings {
+		status, resp := toErrorResponse(m.err)
+		assert.Equal(t, m.status, status, m.err.Error())
+		assert.Equal(t, m.code, resp.Code, m.err.Error())
+	}
+}
+
+func serveError(method string, err error, committed bool) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(method, "/api/v1/urls/abc", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+	if committed {
+		_ = c.NoContent(http.StatusNoContent)
+	}
+	HTTPErrorHandler(err, c)
+	return rec
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	rec := serveError(http.MethodGet, dal.ErrUrlEntryExpired, false)
+	assert.Equal(t, http.StatusGone, rec.Code)
+
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, ErrorResponse{Code: CodeExpired, Message: dal.ErrUrlEntryExpired.Error(), RequestId: "req-1"}, resp)
+
+	// Internal details are not sent to the client
+	rec = serveError(http.MethodGet, errors.New("pq: password authentication failed"), false)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "password")
+
+	// HEAD responses have no body
+	rec = serveError(http.MethodHead, dal.ErrUrlEntryNotFound, false)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	// A response that was already sent is left alone
+	rec = serveError(http.MethodGet, dal.ErrUrlEntryNotFound, true)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
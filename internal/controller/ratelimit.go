@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"gately/internal/auth"
+	"gately/internal/ratelimit"
+	"github.com/labstack/echo/v4"
+)
+
+// Headers of the IETF RateLimit header fields draft
+const (
+	headerRateLimitLimit     = "RateLimit-Limit"
+	headerRateLimitRemaining = "RateLimit-Remaining"
+	headerRateLimitReset     = "RateLimit-Reset"
+)
+
+// byApiKey counts the requests of each API key. Without authentication, the client IP stands in
+func byApiKey(c echo.Context) string {
+	if p, ok := auth.FromContext(c.Request().Context()); ok {
+		return "key:" + p.KeyId
+	}
+	return byIp(c)
+}
+
+func byIp(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// IPExtractor picks the client IP of a request, which rate limits and clicks see.
+// X-Forwarded-For is only believed when one of the trusted proxies set it. Otherwise
+// clients could send any address in it and get around the redirect rate limit.
+func IPExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("Ignoring trusted proxy %q. Err=%v", cidr, err)
+			continue
+		}
+		opts = append(opts, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...)
+}
+
+// seconds rounds d up to whole seconds, as the headers carry
+func seconds(d time.Duration) string {
+	return fmt.Sprint(int64(math.Ceil(d.Seconds())))
+}
+
+// rateLimit rejects the requests beyond limit with 429 Too Many Requests.
+// Requests are counted per name and the key that keyOf picks for them.
+func (ctrlr *AppController) rateLimit(name string, limit ratelimit.Limit, keyOf func(c echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if !limit.Enabled() {
+			return next
+		}
+		return func(c echo.Context) error {
+			res, err := ctrlr.limiter.Allow(c.Request().Context(), name+":"+keyOf(c), limit)
+			if err != nil {
+				// Rather serve the request than fail it because its count is unknown
+				log.Printf("Unable to apply the %s rate limit. Err=%v", name, err)
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(headerRateLimitLimit, fmt.Sprint(res.Limit))
+			header.Set(headerRateLimitRemaining, fmt.Sprint(res.Remaining))
+			header.Set(headerRateLimitReset, seconds(res.Reset))
+			if !res.Allowed {
+				header.Set(echo.HeaderRetryAfter, seconds(res.RetryAfter))
+				return newAPIError(http.StatusTooManyRequests, CodeRateLimited,
+					"Too many requests. Retry in %s seconds", seconds(res.RetryAfter))
+			}
+			return next(c)
+		}
+	}
+}
+
+// LimitCreates is the rate limit of new short urls, per API key
+func (ctrlr *AppController) LimitCreates() echo.MiddlewareFunc {
+	return ctrlr.rateLimit("create", ctrlr.createLimit, byApiKey)
+}
+
+// LimitRedirects is the rate limit of redirects, per client IP
+func (ctrlr *AppController) LimitRedirects() echo.MiddlewareFunc {
+	return ctrlr.rateLimit("redirect", ctrlr.redirectLimit, byIp)
+}
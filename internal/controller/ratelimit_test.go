@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPExtractor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		ip             string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:4711", ip: "203.0.113.7"},
+		// Without trusted proxies, the header is anyone's to set
+		{name: "spoofed header", remoteAddr: "203.0.113.7:4711", forwardedFor: "198.51.100.1", ip: "203.0.113.7"},
+		{name: "trusted proxy", trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:4711",
+			forwardedFor: "198.51.100.1", ip: "198.51.100.1"},
+		// The client may prepend addresses, only the one the proxy appended counts
+		{name: "spoofed behind trusted proxy", trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:4711",
+			forwardedFor: "192.0.2.99, 198.51.100.1", ip: "198.51.100.1"},
+		{name: "untrusted proxy", trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "172.16.0.1:4711",
+			forwardedFor: "198.51.100.1", ip: "172.16.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set(echo.HeaderXForwardedFor, tt.forwardedFor)
+			}
+			assert.Equal(t, tt.ip, IPExtractor(tt.trustedProxies)(req))
+		})
+	}
+}
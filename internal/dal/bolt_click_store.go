@@ -0,0 +1,97 @@
+package dal
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltClickStore keeps click events in the same BoltDB file as the URL mappings.
+// Keys are the big endian timestamp followed by a sequence number, so that a
+// cursor walks the clicks of a short url in time order.
+type BoltClickStore struct {
+	db *bolt.DB
+}
+
+// NewBoltClickStore expects a database opened through OpenBolt
+func NewBoltClickStore(db *bolt.DB) ClickStore {
+	return &BoltClickStore{db: db}
+}
+
+func clickKey(ts int64, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(ts))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+func (bs *BoltClickStore) AddClickEvents(ctx context.Context, events []*ClickEvent) error {
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		clicks := tx.Bucket(boltClicksBucket)
+		for _, e := range events {
+			bucket, err := clicks.CreateBucketIfNotExists([]byte(e.ShortUrl))
+			if err != nil {
+				return err
+			}
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			raw, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(clickKey(e.Ts, seq), raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *BoltClickStore) GetClickEvents(ctx context.Context, shortUrl string, start, end int64) ([]*ClickEvent, error) {
+	return collectClickEvents(ctx, bs, shortUrl, start, end)
+}
+
+func (bs *BoltClickStore) StreamClickEvents(ctx context.Context, shortUrl string, start, end int64, fn func(*ClickEvent) error) error {
+
+	return bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltClicksBucket).Bucket([]byte(shortUrl))
+		if bucket == nil {
+			return nil
+		}
+
+		// Clicks never predate 1970, so the unsigned key order is the time order
+		if start < 0 {
+			start = 0
+		}
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(clickKey(start, 0)); k != nil; k, v = cursor.Next() {
+			if int64(binary.BigEndian.Uint64(k)) >= end {
+				break
+			}
+			elem := &ClickEvent{}
+			if err := json.Unmarshal(v, elem); err != nil {
+				return err
+			}
+			if err := fn(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *BoltClickStore) DeleteClickEvents(ctx context.Context, shortUrl string) error {
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(boltClicksBucket).DeleteBucket([]byte(shortUrl))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
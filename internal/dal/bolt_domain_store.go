@@ -0,0 +1,63 @@
+package dal
+
+import (
+	"context"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDomainStore keeps custom domains in the same BoltDB file as the URL mappings
+type BoltDomainStore struct {
+	db *bolt.DB
+}
+
+// NewBoltDomainStore expects a database opened through OpenBolt
+func NewBoltDomainStore(db *bolt.DB) DomainStore {
+	return &BoltDomainStore{db: db}
+}
+
+func (bs *BoltDomainStore) AddDomain(ctx context.Context, domain *Domain) error {
+	raw, err := json.Marshal(domain)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltDomainsBucket)
+		if bucket.Get([]byte(domain.Host)) != nil {
+			return ErrDomainAlreadyExists
+		}
+		return bucket.Put([]byte(domain.Host), raw)
+	})
+}
+
+func (bs *BoltDomainStore) GetDomain(ctx context.Context, host string) (*Domain, error) {
+	domain := &Domain{}
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltDomainsBucket).Get([]byte(host))
+		if raw == nil {
+			return ErrDomainNotFound
+		}
+		return json.Unmarshal(raw, domain)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return domain, nil
+}
+
+func (bs *BoltDomainStore) ListDomains(ctx context.Context) ([]*Domain, error) {
+	var domains []*Domain
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltDomainsBucket).ForEach(func(k, v []byte) error {
+			domain := &Domain{}
+			if err := json.Unmarshal(v, domain); err != nil {
+				return err
+			}
+			domains = append(domains, domain)
+			return nil
+		})
+	})
+	sortDomains(domains)
+	return domains, err
+}
@@ -0,0 +1,81 @@
+package dal
+
+import (
+	"context"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltKeyStore keeps API keys in the same BoltDB file as the URL mappings
+type BoltKeyStore struct {
+	db *bolt.DB
+}
+
+// NewBoltKeyStore expects a database opened through OpenBolt
+func NewBoltKeyStore(db *bolt.DB) KeyStore {
+	return &BoltKeyStore{db: db}
+}
+
+func getBoltApiKey(tx *bolt.Tx, id string) (*ApiKey, error) {
+	raw := tx.Bucket(boltApiKeysBucket).Get([]byte(id))
+	if raw == nil {
+		return nil, ErrApiKeyNotFound
+	}
+	key := &ApiKey{}
+	if err := json.Unmarshal(raw, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func putBoltApiKey(tx *bolt.Tx, key *ApiKey) error {
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltApiKeysBucket).Put([]byte(key.Id), raw)
+}
+
+func (bs *BoltKeyStore) AddApiKey(ctx context.Context, key *ApiKey) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return putBoltApiKey(tx, key)
+	})
+}
+
+func (bs *BoltKeyStore) GetApiKey(ctx context.Context, id string) (*ApiKey, error) {
+	var key *ApiKey
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		key, err = getBoltApiKey(tx, id)
+		return err
+	})
+	return key, err
+}
+
+func (bs *BoltKeyStore) ListApiKeys(ctx context.Context) ([]*ApiKey, error) {
+	var keys []*ApiKey
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltApiKeysBucket).ForEach(func(k, v []byte) error {
+			key := &ApiKey{}
+			if err := json.Unmarshal(v, key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	sortApiKeys(keys)
+	return keys, err
+}
+
+func (bs *BoltKeyStore) RevokeApiKey(ctx context.Context, id string, ts int64) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		key, err := getBoltApiKey(tx, id)
+		if err != nil {
+			return err
+		}
+		key.RevokedTs = ts
+		return putBoltApiKey(tx, key)
+	})
+}
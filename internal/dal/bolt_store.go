@@ -0,0 +1,447 @@
+package dal
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// URL mappings keyed by the short url. Values are JSON encoded UrlMappingEntry
+	boltUrlsBucket = []byte("url_mappings")
+	// Unique index of the deduplicated long urls, keyed by longUrlKey
+	boltLongUrlsBucket = []byte("long_urls")
+	// Click events, in one nested bucket per short url
+	boltClicksBucket = []byte("clicks")
+	// API keys keyed by their id
+	boltApiKeysBucket = []byte("api_keys")
+	// Workspaces keyed by their id
+	boltWorkspacesBucket = []byte("workspaces")
+	// Custom domains keyed by their host
+	boltDomainsBucket = []byte("domains")
+	// Number of URL mappings per workspace, for link quotas. Keyed by workspaceCountKey,
+	// values are 8 byte big endian
+	boltWorkspaceCountsBucket = []byte("workspace_counts")
+)
+
+// BoltUrlStore keeps URL mappings in a single BoltDB file on disk.
+// It backs the embedded mode, where gately runs without any external services.
+// BoltDB serializes all write transactions, so every update is atomic.
+type BoltUrlStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens (or creates) the BoltDB file at path and the buckets gately keeps in it
+func OpenBolt(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltUrlsBucket, boltLongUrlsBucket, boltClicksBucket, boltApiKeysBucket, boltWorkspacesBucket, boltDomainsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(boltWorkspaceCountsBucket) == nil {
+			return createBoltWorkspaceCounts(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewBoltUrlStore expects a database opened through OpenBolt
+func NewBoltUrlStore(db *bolt.DB) UrlStore {
+	return &BoltUrlStore{db: db}
+}
+
+// longUrlKey is the key of a deduplicated long url on host in the long_urls bucket.
+// Keys of the default workspace are the bare long url, as they were before workspaces.
+func longUrlKey(workspace, host, longUrl string) string {
+	if workspace == DefaultWorkspace {
+		return dedupeName(host, longUrl)
+	}
+	return workspace + "\x00" + dedupeName(host, longUrl)
+}
+
+// entryLongUrlKey is the key of longUrl when entry points to it
+func entryLongUrlKey(entry *UrlMappingEntry, longUrl string) []byte {
+	host, _ := SplitShortKey(entry.ShortUrl)
+	return []byte(longUrlKey(entry.Workspace, host, longUrl))
+}
+
+// isDeduplicated reports whether the long url of entry is indexed to it, rather
+// than to another entry or to none because duplicates were allowed
+func isDeduplicated(tx *bolt.Tx, entry *UrlMappingEntry) bool {
+	indexed := tx.Bucket(boltLongUrlsBucket).Get(entryLongUrlKey(entry, entry.LongUrl))
+	return string(indexed) == entry.ShortUrl
+}
+
+// isLongUrlKeyTaken reports whether key is indexed to an entry that has not expired.
+// The key of an expired entry is taken over, so that it does not hold on to its long url
+func isLongUrlKeyTaken(tx *bolt.Tx, key []byte) (bool, error) {
+	shortUrl := tx.Bucket(boltLongUrlsBucket).Get(key)
+	if shortUrl == nil {
+		return false, nil
+	}
+	holder, err := getBoltEntry(tx, string(shortUrl))
+	if err == ErrUrlEntryNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !holder.IsExpired(time.Now().Unix()) {
+		return true, nil
+	}
+	log.Printf("Releasing the dedupe key of expired short URL %s", holder.ShortUrl)
+	return false, tx.Bucket(boltLongUrlsBucket).Delete(key)
+}
+
+// workspaceCountKey is the key of a workspace in the workspace_counts bucket.
+// BoltDB keys cannot be empty, so it is prefixed for the default workspace.
+func workspaceCountKey(workspace string) []byte {
+	return []byte("/" + workspace)
+}
+
+// addBoltWorkspaceCount adds delta to the number of URL mappings of workspace
+func addBoltWorkspaceCount(tx *bolt.Tx, workspace string, delta int64) error {
+	counts := tx.Bucket(boltWorkspaceCountsBucket)
+	key := workspaceCountKey(workspace)
+
+	var count int64
+	if raw := counts.Get(key); raw != nil {
+		count = int64(binary.BigEndian.Uint64(raw))
+	}
+	if count += delta; count <= 0 {
+		return counts.Delete(key)
+	}
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(count))
+	return counts.Put(key, raw)
+}
+
+// createBoltWorkspaceCounts counts the URL mappings of files from before link quotas, once
+func createBoltWorkspaceCounts(tx *bolt.Tx) error {
+	if _, err := tx.CreateBucket(boltWorkspaceCountsBucket); err != nil {
+		return err
+	}
+	return tx.Bucket(boltUrlsBucket).ForEach(func(k, v []byte) error {
+		elem := &UrlMappingEntry{}
+		if err := json.Unmarshal(v, elem); err != nil {
+			return err
+		}
+		return addBoltWorkspaceCount(tx, elem.Workspace, 1)
+	})
+}
+
+// deleteBoltEntry deletes entry along with its long url index key, if it owns it
+func deleteBoltEntry(tx *bolt.Tx, entry *UrlMappingEntry) error {
+	if isDeduplicated(tx, entry) {
+		if err := tx.Bucket(boltLongUrlsBucket).Delete(entryLongUrlKey(entry, entry.LongUrl)); err != nil {
+			return err
+		}
+	}
+	if err := addBoltWorkspaceCount(tx, entry.Workspace, -1); err != nil {
+		return err
+	}
+	return tx.Bucket(boltUrlsBucket).Delete([]byte(entry.ShortUrl))
+}
+
+func getBoltEntry(tx *bolt.Tx, shortUrl string) (*UrlMappingEntry, error) {
+	raw := tx.Bucket(boltUrlsBucket).Get([]byte(shortUrl))
+	if raw == nil {
+		return nil, ErrUrlEntryNotFound
+	}
+	entry := &UrlMappingEntry{}
+	if err := json.Unmarshal(raw, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func putBoltEntry(tx *bolt.Tx, entry *UrlMappingEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltUrlsBucket).Put([]byte(entry.ShortUrl), raw)
+}
+
+func (bs *BoltUrlStore) GetUrlMetrics(ctx context.Context, query MetricsQuery, fn func(*UrlMappingEntry) error) error {
+
+	log.Printf("Trying to get entries between start=%d and end=%d", query.Start, query.End)
+	var entries []*UrlMappingEntry
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUrlsBucket).ForEach(func(k, v []byte) error {
+			elem := &UrlMappingEntry{}
+			if err := json.Unmarshal(v, elem); err != nil {
+				return err
+			}
+			if query.matches(elem) {
+				entries = append(entries, elem)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("Unable to get metrics for the given dates. Err=%v", err)
+		return err
+	}
+
+	// fn runs outside of the transaction, as it may call back into the store
+	return streamEntries(entries, query, fn)
+}
+
+func (bs *BoltUrlStore) AddUrlEntry(ctx context.Context, entry *UrlMappingEntry) error {
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		longUrls := tx.Bucket(boltLongUrlsBucket)
+		longKey := entryLongUrlKey(entry, entry.LongUrl)
+		if entry.DedupeKey != "" {
+			taken, err := isLongUrlKeyTaken(tx, longKey)
+			if err != nil {
+				return err
+			}
+			if taken {
+				log.Printf("A short URL already exists for %s", entry.LongUrl)
+				return ErrUrlEntryAlreadyExists
+			}
+		}
+		if tx.Bucket(boltUrlsBucket).Get([]byte(entry.ShortUrl)) != nil {
+			log.Printf("Short URL %s is already mapped", entry.ShortUrl)
+			return ErrShortUrlAlreadyExists
+		}
+
+		if err := putBoltEntry(tx, entry); err != nil {
+			return err
+		}
+		if err := addBoltWorkspaceCount(tx, entry.Workspace, 1); err != nil {
+			return err
+		}
+		if entry.DedupeKey == "" {
+			return nil
+		}
+		return longUrls.Put(longKey, []byte(entry.ShortUrl))
+	})
+}
+
+func (bs *BoltUrlStore) GetMappedUrl(ctx context.Context, shortUrl string) (string, error) {
+
+	return mappedUrl(bs.GetUrlEntry(ctx, shortUrl))
+}
+
+func (bs *BoltUrlStore) GetUrlEntry(ctx context.Context, shortUrl string) (*UrlMappingEntry, error) {
+
+	var entry *UrlMappingEntry
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = getBoltEntry(tx, shortUrl)
+		return err
+	})
+	if err == ErrUrlEntryNotFound {
+		log.Printf("No short URL exists for %s", shortUrl)
+	}
+	return entry, err
+}
+
+func (bs *BoltUrlStore) GetUrlEntryByLongUrl(ctx context.Context, workspace, host, longUrl string) (*UrlMappingEntry, error) {
+
+	var entry *UrlMappingEntry
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		shortUrl := tx.Bucket(boltLongUrlsBucket).Get([]byte(longUrlKey(workspace, host, longUrl)))
+		if shortUrl == nil {
+			return ErrUrlEntryNotFound
+		}
+		var err error
+		entry, err = getBoltEntry(tx, string(shortUrl))
+		return err
+	})
+	if err == ErrUrlEntryNotFound {
+		log.Printf("No short URL exists for %s", longUrl)
+	}
+	return entry, err
+}
+
+func (bs *BoltUrlStore) CheckIfUrlExists(ctx context.Context, url string, isLong bool) bool {
+
+	var exists bool
+	_ = bs.db.View(func(tx *bolt.Tx) error {
+		if !isLong {
+			exists = tx.Bucket(boltUrlsBucket).Get([]byte(url)) != nil
+			return nil
+		}
+		// In any workspace and on any domain. The keys of others end with the long url
+		return tx.Bucket(boltLongUrlsBucket).ForEach(func(k, v []byte) error {
+			if key := string(k); key == url || strings.HasSuffix(key, "\x00"+url) || strings.HasSuffix(key, " "+url) {
+				exists = true
+			}
+			return nil
+		})
+	})
+	return exists
+}
+
+func (bs *BoltUrlStore) DeleteUrlEntry(ctx context.Context, shortUrl string, cond *UrlEntryCondition) error {
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		entry, err := getBoltEntry(tx, shortUrl)
+		if err == ErrUrlEntryNotFound && cond == nil {
+			// Deleting a missing entry is not an error, same as MongoUrlStore
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !cond.allows(entry) {
+			log.Printf("No short URL matching the condition exists for %s", shortUrl)
+			return ErrUrlEntryNotFound
+		}
+		return deleteBoltEntry(tx, entry)
+	})
+}
+
+func (bs *BoltUrlStore) UpdateUrlEntry(ctx context.Context, shortUrl string, update *UrlEntryUpdate) (*UrlMappingEntry, error) {
+
+	var entry *UrlMappingEntry
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = getBoltEntry(tx, shortUrl)
+		if err != nil {
+			return err
+		}
+		if !update.allows(entry) {
+			log.Printf("%s no longer matches the condition of the update", shortUrl)
+			return ErrUrlEntryNotFound
+		}
+
+		longUrls := tx.Bucket(boltLongUrlsBucket)
+		if update.LongUrl != nil && *update.LongUrl != entry.LongUrl && isDeduplicated(tx, entry) {
+			newKey := entryLongUrlKey(entry, *update.LongUrl)
+			taken, err := isLongUrlKeyTaken(tx, newKey)
+			if err != nil {
+				return err
+			}
+			if taken {
+				log.Printf("A short URL already exists for %s", *update.LongUrl)
+				return ErrUrlEntryAlreadyExists
+			}
+			if err := longUrls.Delete(entryLongUrlKey(entry, entry.LongUrl)); err != nil {
+				return err
+			}
+			if err := longUrls.Put(newKey, []byte(shortUrl)); err != nil {
+				return err
+			}
+		}
+
+		applyUrlEntryUpdate(entry, update)
+		return putBoltEntry(tx, entry)
+	})
+	if err == ErrUrlEntryNotFound {
+		log.Printf("No short URL exists for %s", shortUrl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (bs *BoltUrlStore) GetUrlHistory(ctx context.Context, shortUrl string) ([]UrlDestination, error) {
+
+	entry, err := bs.GetUrlEntry(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
+	return entry.History, nil
+}
+
+func (bs *BoltUrlStore) DeleteExpiredUrlEntries(ctx context.Context, before int64) (int64, error) {
+
+	var deleted int64
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		// Keys cannot be deleted while iterating, so collect them first
+		var expired []*UrlMappingEntry
+		err := tx.Bucket(boltUrlsBucket).ForEach(func(k, v []byte) error {
+			elem := &UrlMappingEntry{}
+			if err := json.Unmarshal(v, elem); err != nil {
+				return err
+			}
+			if elem.ExpiresAt > 0 && elem.ExpiresAt < before {
+				expired = append(expired, elem)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range expired {
+			if err := deleteBoltEntry(tx, entry); err != nil {
+				return err
+			}
+		}
+		deleted = int64(len(expired))
+		return nil
+	})
+	return deleted, err
+}
+
+func (bs *BoltUrlStore) UpdateUrlHitCount(ctx context.Context, shortUrl string) error {
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		entry, err := getBoltEntry(tx, shortUrl)
+		if err != nil {
+			return err
+		}
+		entry.Hits += 1
+		entry.LastAccessed = time.Now().Unix()
+		return putBoltEntry(tx, entry)
+	})
+	if err == ErrUrlEntryNotFound {
+		log.Printf("No short URL exists for %s", shortUrl)
+	}
+	return err
+}
+
+func (bs *BoltUrlStore) UpdateUrlHitCounts(ctx context.Context, counts map[string]HitCount) error {
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		for shortUrl, count := range counts {
+			entry, err := getBoltEntry(tx, shortUrl)
+			if err == ErrUrlEntryNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			applyHitCount(entry, count)
+			if err := putBoltEntry(tx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *BoltUrlStore) CountUrlEntries(ctx context.Context, workspace string) (int64, error) {
+
+	var count int64
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		if raw := tx.Bucket(boltWorkspaceCountsBucket).Get(workspaceCountKey(workspace)); raw != nil {
+			count = int64(binary.BigEndian.Uint64(raw))
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,119 @@
+package dal
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestBolt(t *testing.T, path string) UrlStore {
+	t.Helper()
+	db, err := OpenBolt(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return NewBoltUrlStore(db)
+}
+
+func TestBoltAddGetDelete(t *testing.T) {
+	ctx := context.Background()
+	store := openTestBolt(t, filepath.Join(t.TempDir(), "gately.db"))
+	longUrl := "https://example.com/a"
+
+	require.NoError(t, store.AddUrlEntry(ctx, &UrlMappingEntry{
+		ShortUrl: "abc", LongUrl: longUrl, Hits: 1, DedupeKey: DedupeKey(DefaultWorkspace, "", longUrl)}))
+
+	mapped, err := store.GetMappedUrl(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, longUrl, mapped)
+	entry, err := store.GetUrlEntryByLongUrl(ctx, DefaultWorkspace, "", longUrl)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", entry.ShortUrl)
+	assert.True(t, store.CheckIfUrlExists(ctx, "abc", false))
+
+	require.NoError(t, store.DeleteUrlEntry(ctx, "abc", nil))
+	_, err = store.GetUrlEntry(ctx, "abc")
+	assert.ErrorIs(t, err, ErrUrlEntryNotFound)
+	_, err = store.GetUrlEntryByLongUrl(ctx, DefaultWorkspace, "", longUrl)
+	assert.ErrorIs(t, err, ErrUrlEntryNotFound)
+	assert.False(t, store.CheckIfUrlExists(ctx, "abc", false))
+
+	// Deleting a missing entry is not an error
+	assert.NoError(t, store.DeleteUrlEntry(ctx, "abc", nil))
+}
+
+func TestBoltRejectsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	store := openTestBolt(t, filepath.Join(t.TempDir(), "gately.db"))
+	add := func(shortUrl, longUrl string, deduplicated bool) error {
+		entry := &UrlMappingEntry{ShortUrl: shortUrl, LongUrl: longUrl}
+		if deduplicated {
+			entry.DedupeKey = DedupeKey(DefaultWorkspace, "", longUrl)
+		}
+		return store.AddUrlEntry(ctx, entry)
+	}
+
+	require.NoError(t, add("abc", "https://example.com/a", true))
+	assert.ErrorIs(t, add("abc", "https://example.com/b", true), ErrShortUrlAlreadyExists)
+	assert.ErrorIs(t, add("def", "https://example.com/a", true), ErrUrlEntryAlreadyExists)
+	// Without a dedupe key the long url may be shortened again
+	assert.NoError(t, add("ghi", "https://example.com/a", false))
+
+	entry, err := store.GetUrlEntry(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", entry.LongUrl)
+}
+
+func TestBoltKeepsEntriesWhenReopened(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "gately.db")
+	longUrl := "https://example.com/a"
+
+	db, err := OpenBolt(path)
+	require.NoError(t, err)
+	store := NewBoltUrlStore(db)
+	require.NoError(t, store.AddUrlEntry(ctx, &UrlMappingEntry{
+		ShortUrl: "abc", LongUrl: longUrl, Hits: 1, Workspace: "team-a", DedupeKey: DedupeKey("team-a", "", longUrl)}))
+	require.NoError(t, store.UpdateUrlHitCount(ctx, "abc"))
+	require.NoError(t, db.Close())
+
+	store = openTestBolt(t, path)
+	entry, err := store.GetUrlEntry(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, longUrl, entry.LongUrl)
+	assert.Equal(t, int64(2), entry.Hits)
+	count, err := store.CountUrlEntries(ctx, "team-a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	// The long url is still deduplicated
+	err = store.AddUrlEntry(ctx, &UrlMappingEntry{
+		ShortUrl: "def", LongUrl: longUrl, Workspace: "team-a", DedupeKey: DedupeKey("team-a", "", longUrl)})
+	assert.ErrorIs(t, err, ErrUrlEntryAlreadyExists)
+}
+
+func TestBoltCountsUrlEntriesOfOlderFiles(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "gately.db")
+
+	db, err := OpenBolt(path)
+	require.NoError(t, err)
+	store := NewBoltUrlStore(db)
+	for _, shortUrl := range []string{"a", "b"} {
+		require.NoError(t, store.AddUrlEntry(ctx, &UrlMappingEntry{ShortUrl: shortUrl, LongUrl: "https://example.com/" + shortUrl, Workspace: "team-a"}))
+	}
+	// Files from before link quotas have no counts
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(boltWorkspaceCountsBucket)
+	}))
+	require.NoError(t, db.Close())
+
+	db, err = OpenBolt(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	count, err := NewBoltUrlStore(db).CountUrlEntries(ctx, "team-a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
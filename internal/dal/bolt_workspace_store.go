@@ -0,0 +1,77 @@
+package dal
+
+import (
+	"context"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltWorkspaceStore keeps workspaces in the same BoltDB file as the URL mappings
+type BoltWorkspaceStore struct {
+	db *bolt.DB
+}
+
+// NewBoltWorkspaceStore expects a database opened through OpenBolt
+func NewBoltWorkspaceStore(db *bolt.DB) WorkspaceStore {
+	return &BoltWorkspaceStore{db: db}
+}
+
+func (bs *BoltWorkspaceStore) AddWorkspace(ctx context.Context, ws *Workspace) error {
+	raw, err := json.Marshal(ws)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltWorkspacesBucket)
+		if bucket.Get([]byte(ws.Id)) != nil {
+			return ErrWorkspaceAlreadyExists
+		}
+		return bucket.Put([]byte(ws.Id), raw)
+	})
+}
+
+func (bs *BoltWorkspaceStore) GetWorkspace(ctx context.Context, id string) (*Workspace, error) {
+	ws := &Workspace{}
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltWorkspacesBucket).Get([]byte(id))
+		if raw == nil {
+			return ErrWorkspaceNotFound
+		}
+		return json.Unmarshal(raw, ws)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (bs *BoltWorkspaceStore) UpdateWorkspace(ctx context.Context, ws *Workspace) error {
+	raw, err := json.Marshal(ws)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltWorkspacesBucket)
+		if bucket.Get([]byte(ws.Id)) == nil {
+			return ErrWorkspaceNotFound
+		}
+		return bucket.Put([]byte(ws.Id), raw)
+	})
+}
+
+func (bs *BoltWorkspaceStore) ListWorkspaces(ctx context.Context) ([]*Workspace, error) {
+	var workspaces []*Workspace
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltWorkspacesBucket).ForEach(func(k, v []byte) error {
+			ws := &Workspace{}
+			if err := json.Unmarshal(v, ws); err != nil {
+				return err
+			}
+			workspaces = append(workspaces, ws)
+			return nil
+		})
+	})
+	sortWorkspaces(workspaces)
+	return workspaces, err
+}
@@ -0,0 +1,122 @@
+package dal
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection that holds click events, next to the URL mappings
+const clickCollection = "clicks"
+
+// ClickEvent is one redirect of a short url and what the client told us about itself
+type ClickEvent struct {
+	ShortUrl string `bson:"short_url" json:"short_url"`
+	// Unix time of the redirect
+	Ts             int64  `bson:"ts" json:"ts"`
+	Referrer       string `bson:"referrer,omitempty" json:"referrer,omitempty"`
+	UserAgent      string `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	AcceptLanguage string `bson:"accept_language,omitempty" json:"accept_language,omitempty"`
+	// Salted hash of the client IP. The IP itself is never stored
+	IpHash string `bson:"ip_hash,omitempty" json:"ip_hash,omitempty"`
+}
+
+// ClickStore is an append-only log of click events
+type ClickStore interface {
+	AddClickEvents(ctx context.Context, events []*ClickEvent) error
+	// GetClickEvents returns the clicks of a short url between start (inclusive)
+	// and end (exclusive), oldest first
+	GetClickEvents(ctx context.Context, shortUrl string, start, end int64) ([]*ClickEvent, error)
+	// StreamClickEvents hands the clicks that GetClickEvents would return to fn, one at a time,
+	// so that they need not all be held in memory. It stops at the first error returned by fn
+	// and returns that error. fn must not call back into the store.
+	StreamClickEvents(ctx context.Context, shortUrl string, start, end int64, fn func(*ClickEvent) error) error
+	// DeleteClickEvents drops every click of a short url, for when the link is deleted
+	DeleteClickEvents(ctx context.Context, shortUrl string) error
+}
+
+// collectClickEvents implements GetClickEvents through StreamClickEvents
+func collectClickEvents(ctx context.Context, store ClickStore, shortUrl string, start, end int64) ([]*ClickEvent, error) {
+	var results []*ClickEvent
+	err := store.StreamClickEvents(ctx, shortUrl, start, end, func(e *ClickEvent) error {
+		results = append(results, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+type MongoClickStore struct {
+	c    *mongo.Client
+	name string
+}
+
+func NewMongoClickStore(c *mongo.Client, db string) ClickStore {
+	return &MongoClickStore{c: c, name: db}
+}
+
+func (ms *MongoClickStore) AddClickEvents(ctx context.Context, events []*ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	clickTbl := ms.c.Database(ms.name).Collection(clickCollection)
+
+	docs := make([]interface{}, len(events))
+	for i, e := range events {
+		docs[i] = e
+	}
+	// Unordered, so that one failing insert does not hold back the others
+	if _, err := clickTbl.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil {
+		log.Printf("Unable to add click events. Err = %v", err)
+		return err
+	}
+	return nil
+}
+
+func (ms *MongoClickStore) GetClickEvents(ctx context.Context, shortUrl string, start, end int64) ([]*ClickEvent, error) {
+	return collectClickEvents(ctx, ms, shortUrl, start, end)
+}
+
+func (ms *MongoClickStore) StreamClickEvents(ctx context.Context, shortUrl string, start, end int64, fn func(*ClickEvent) error) error {
+	clickTbl := ms.c.Database(ms.name).Collection(clickCollection)
+
+	filter := bson.M{
+		"short_url": shortUrl,
+		"ts": bson.M{
+			"$gte": start,
+			"$lt":  end,
+		},
+	}
+	cursor, err := clickTbl.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "ts", Value: 1}}))
+	if err != nil {
+		log.Printf("Unable to get click events for %s. Err=%v", shortUrl, err)
+		return err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	for cursor.Next(ctx) {
+		elem := &ClickEvent{}
+		if err := cursor.Decode(elem); err != nil {
+			return err
+		}
+		if err := fn(elem); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (ms *MongoClickStore) DeleteClickEvents(ctx context.Context, shortUrl string) error {
+	clickTbl := ms.c.Database(ms.name).Collection(clickCollection)
+
+	if _, err := clickTbl.DeleteMany(ctx, bson.M{"short_url": shortUrl}); err != nil {
+		log.Printf("Unable to delete click events of %s. Err=%v", shortUrl, err)
+		return err
+	}
+	return nil
+}
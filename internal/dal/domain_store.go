@@ -0,0 +1,123 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection that holds custom domains, next to the URL mappings
+const domainCollection = "domains"
+
+var (
+	ErrDomainNotFound      = errors.New("Domain does not exist")
+	ErrDomainAlreadyExists = errors.New("The domain is already registered")
+)
+
+// Domain is a custom domain that short urls are served from, e.g. go.acme.com.
+// Short codes are unique per domain.
+type Domain struct {
+	Host string `bson:"host" json:"host"`
+	// Workspace whose links may use the domain
+	Workspace string `bson:"workspace,omitempty" json:"workspace,omitempty"`
+	// Scheme of the short urls on the domain, https unless set
+	Scheme    string `bson:"scheme,omitempty" json:"scheme,omitempty"`
+	CreatedTs int64  `bson:"created_ts" json:"created_ts"`
+}
+
+type DomainStore interface {
+	AddDomain(ctx context.Context, domain *Domain) error
+	GetDomain(ctx context.Context, host string) (*Domain, error)
+	ListDomains(ctx context.Context) ([]*Domain, error)
+}
+
+// ShortKey is the key of a short code on a domain in the UrlStore.
+// Codes of the default domain are stored as they are, so links from before
+// custom domains keep working.
+func ShortKey(domain, code string) string {
+	if domain == "" {
+		return code
+	}
+	return domain + "/" + code
+}
+
+// SplitShortKey is the inverse of ShortKey. Codes never contain a '/'
+func SplitShortKey(key string) (domain, code string) {
+	if i := strings.LastIndexByte(key, '/'); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// sortDomains orders domains by host
+func sortDomains(domains []*Domain) {
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i].Host < domains[j].Host
+	})
+}
+
+type MongoDomainStore struct {
+	c    *mongo.Client
+	name string
+}
+
+func NewMongoDomainStore(c *mongo.Client, db string) DomainStore {
+	return &MongoDomainStore{c: c, name: db}
+}
+
+func (ms *MongoDomainStore) AddDomain(ctx context.Context, domain *Domain) error {
+	domainTbl := ms.c.Database(ms.name).Collection(domainCollection)
+
+	// Upsert only if missing. Of two concurrent adds, both may try to insert,
+	// and the unique index on host fails the second one
+	res, err := domainTbl.UpdateOne(ctx, bson.M{"host": domain.Host},
+		bson.M{"$setOnInsert": domain}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDomainAlreadyExists
+	}
+	if err != nil {
+		log.Printf("Unable to add domain %s. Err = %v", domain.Host, err)
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return ErrDomainAlreadyExists
+	}
+	return nil
+}
+
+func (ms *MongoDomainStore) GetDomain(ctx context.Context, host string) (*Domain, error) {
+	domainTbl := ms.c.Database(ms.name).Collection(domainCollection)
+
+	var domain Domain
+	err := domainTbl.FindOne(ctx, bson.M{"host": host}).Decode(&domain)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDomainNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &domain, nil
+}
+
+func (ms *MongoDomainStore) ListDomains(ctx context.Context) ([]*Domain, error) {
+	domainTbl := ms.c.Database(ms.name).Collection(domainCollection)
+
+	cursor, err := domainTbl.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var domains []*Domain
+	if err := cursor.All(ctx, &domains); err != nil {
+		return nil, err
+	}
+	sortDomains(domains)
+	return domains, nil
+}
@@ -0,0 +1,104 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collection that holds API keys, next to the URL mappings
+const apiKeyCollection = "api_keys"
+
+var ErrApiKeyNotFound = errors.New("API key does not exist")
+
+// ApiKey authenticates a client of the management API.
+// Only a hash of the secret part of the key is stored.
+type ApiKey struct {
+	// Public part of the key, used to look it up
+	Id   string `bson:"key_id" json:"id"`
+	Hash string `bson:"hash" json:"hash"`
+	// Links created with the key belong to this owner
+	Owner string `bson:"owner" json:"owner"`
+	Name  string `bson:"name,omitempty" json:"name,omitempty"`
+	// Admin keys may manage the links of every owner in their workspace
+	Admin bool `bson:"admin,omitempty" json:"admin,omitempty"`
+	// Workspace of the links the key may see and manage
+	Workspace string `bson:"workspace,omitempty" json:"workspace,omitempty"`
+	CreatedTs int64  `bson:"created_ts" json:"created_ts"`
+	// Unix time at which the key was revoked. Zero while it is valid
+	RevokedTs int64 `bson:"revoked_ts,omitempty" json:"revoked_ts,omitempty"`
+}
+
+type KeyStore interface {
+	AddApiKey(ctx context.Context, key *ApiKey) error
+	GetApiKey(ctx context.Context, id string) (*ApiKey, error)
+	ListApiKeys(ctx context.Context) ([]*ApiKey, error)
+	// RevokeApiKey marks a key as revoked at the given unix time. Revoked keys are kept for auditing
+	RevokeApiKey(ctx context.Context, id string, ts int64) error
+}
+
+type MongoKeyStore struct {
+	c    *mongo.Client
+	name string
+}
+
+func NewMongoKeyStore(c *mongo.Client, db string) KeyStore {
+	return &MongoKeyStore{c: c, name: db}
+}
+
+func (ms *MongoKeyStore) AddApiKey(ctx context.Context, key *ApiKey) error {
+	keyTbl := ms.c.Database(ms.name).Collection(apiKeyCollection)
+	if _, err := keyTbl.InsertOne(ctx, key); err != nil {
+		log.Printf("Unable to add API key. Err = %v", err)
+		return err
+	}
+	return nil
+}
+
+func (ms *MongoKeyStore) GetApiKey(ctx context.Context, id string) (*ApiKey, error) {
+	keyTbl := ms.c.Database(ms.name).Collection(apiKeyCollection)
+
+	var key ApiKey
+	err := keyTbl.FindOne(ctx, bson.M{"key_id": id}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrApiKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (ms *MongoKeyStore) ListApiKeys(ctx context.Context) ([]*ApiKey, error) {
+	keyTbl := ms.c.Database(ms.name).Collection(apiKeyCollection)
+
+	cursor, err := keyTbl.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var keys []*ApiKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	sortApiKeys(keys)
+	return keys, nil
+}
+
+func (ms *MongoKeyStore) RevokeApiKey(ctx context.Context, id string, ts int64) error {
+	keyTbl := ms.c.Database(ms.name).Collection(apiKeyCollection)
+
+	res, err := keyTbl.UpdateOne(ctx, bson.M{"key_id": id}, bson.M{"$set": bson.M{"revoked_ts": ts}})
+	if err != nil {
+		log.Printf("Unable to revoke API key %s. Err = %v", id, err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrApiKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package dal
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryClickStore keeps click events in process memory. Nothing survives a restart.
+type MemoryClickStore struct {
+	mu sync.RWMutex
+	// Click events keyed by the short url
+	events map[string][]ClickEvent
+}
+
+func NewMemoryClickStore() ClickStore {
+	return &MemoryClickStore{events: make(map[string][]ClickEvent)}
+}
+
+func (ms *MemoryClickStore) AddClickEvents(ctx context.Context, events []*ClickEvent) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, e := range events {
+		ms.events[e.ShortUrl] = append(ms.events[e.ShortUrl], *e)
+	}
+	return nil
+}
+
+func (ms *MemoryClickStore) GetClickEvents(ctx context.Context, shortUrl string, start, end int64) ([]*ClickEvent, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var results []*ClickEvent
+	for _, e := range ms.events[shortUrl] {
+		if e.Ts >= start && e.Ts < end {
+			elem := e
+			results = append(results, &elem)
+		}
+	}
+
+	// Batches are flushed by several workers, so events are not stored in order
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Ts < results[j].Ts })
+	return results, nil
+}
+
+// StreamClickEvents holds a copy of the selected events, which are in memory anyway
+func (ms *MemoryClickStore) StreamClickEvents(ctx context.Context, shortUrl string, start, end int64, fn func(*ClickEvent) error) error {
+	events, err := ms.GetClickEvents(ctx, shortUrl, start, end)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryClickStore) DeleteClickEvents(ctx context.Context, shortUrl string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.events, shortUrl)
+	return nil
+}
@@ -0,0 +1,51 @@
+package dal
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryDomainStore keeps custom domains in process memory. Nothing survives a restart.
+type MemoryDomainStore struct {
+	mu      sync.RWMutex
+	domains map[string]Domain
+}
+
+func NewMemoryDomainStore() DomainStore {
+	return &MemoryDomainStore{domains: make(map[string]Domain)}
+}
+
+func (ms *MemoryDomainStore) AddDomain(ctx context.Context, domain *Domain) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.domains[domain.Host]; ok {
+		return ErrDomainAlreadyExists
+	}
+	ms.domains[domain.Host] = *domain
+	return nil
+}
+
+func (ms *MemoryDomainStore) GetDomain(ctx context.Context, host string) (*Domain, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	domain, ok := ms.domains[host]
+	if !ok {
+		return nil, ErrDomainNotFound
+	}
+	return &domain, nil
+}
+
+func (ms *MemoryDomainStore) ListDomains(ctx context.Context) ([]*Domain, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	domains := make([]*Domain, 0, len(ms.domains))
+	for _, domain := range ms.domains {
+		elem := domain
+		domains = append(domains, &elem)
+	}
+	sortDomains(domains)
+	return domains, nil
+}
@@ -0,0 +1,72 @@
+package dal
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryKeyStore keeps API keys in process memory. Nothing survives a restart.
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]ApiKey
+}
+
+func NewMemoryKeyStore() KeyStore {
+	return &MemoryKeyStore{keys: make(map[string]ApiKey)}
+}
+
+// sortApiKeys orders keys by creation, oldest first
+func sortApiKeys(keys []*ApiKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedTs == keys[j].CreatedTs {
+			return keys[i].Id < keys[j].Id
+		}
+		return keys[i].CreatedTs < keys[j].CreatedTs
+	})
+}
+
+func (ms *MemoryKeyStore) AddApiKey(ctx context.Context, key *ApiKey) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.keys[key.Id] = *key
+	return nil
+}
+
+func (ms *MemoryKeyStore) GetApiKey(ctx context.Context, id string) (*ApiKey, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	key, ok := ms.keys[id]
+	if !ok {
+		return nil, ErrApiKeyNotFound
+	}
+	return &key, nil
+}
+
+func (ms *MemoryKeyStore) ListApiKeys(ctx context.Context) ([]*ApiKey, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	keys := make([]*ApiKey, 0, len(ms.keys))
+	for _, key := range ms.keys {
+		elem := key
+		keys = append(keys, &elem)
+	}
+	sortApiKeys(keys)
+	return keys, nil
+}
+
+func (ms *MemoryKeyStore) RevokeApiKey(ctx context.Context, id string, ts int64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key, ok := ms.keys[id]
+	if !ok {
+		return ErrApiKeyNotFound
+	}
+	key.RevokedTs = ts
+	ms.keys[id] = key
+	return nil
+}
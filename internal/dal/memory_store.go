@@ -0,0 +1,288 @@
+package dal
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryUrlStore keeps all URL mappings in process memory.
+// It is safe for concurrent use and is meant for local development and tests,
+// where running MongoDB is not an option. Nothing survives a restart.
+type MemoryUrlStore struct {
+	mu sync.RWMutex
+	// URL mappings keyed by the short url
+	entries map[string]*UrlMappingEntry
+	// Unique index of dedupe key -> short url. Entries without a dedupe key are not in it
+	dedupeKeys map[string]string
+	// Number of entries per workspace, for link quotas
+	workspaceCounts map[string]int64
+}
+
+func NewMemoryUrlStore() UrlStore {
+	return &MemoryUrlStore{
+		entries:         make(map[string]*UrlMappingEntry),
+		dedupeKeys:      make(map[string]string),
+		workspaceCounts: make(map[string]int64),
+	}
+}
+
+func (ms *MemoryUrlStore) GetUrlMetrics(ctx context.Context, query MetricsQuery, fn func(*UrlMappingEntry) error) error {
+	ms.mu.RLock()
+	log.Printf("Trying to get entries between start=%d and end=%d", query.Start, query.End)
+	entries := make([]*UrlMappingEntry, 0, len(ms.entries))
+	for _, entry := range ms.entries {
+		// Hand out copies so that callers never race with hit count updates
+		elem := *entry
+		entries = append(entries, &elem)
+	}
+	// fn may call back into the store, so it runs without the lock
+	ms.mu.RUnlock()
+
+	return streamEntries(entries, query, fn)
+}
+
+func (ms *MemoryUrlStore) UpdateUrlHitCounts(ctx context.Context, counts map[string]HitCount) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for shortUrl, count := range counts {
+		if entry, ok := ms.entries[shortUrl]; ok {
+			applyHitCount(entry, count)
+		}
+	}
+	return nil
+}
+
+// applyHitCount adds aggregated hits to entry in place
+func applyHitCount(entry *UrlMappingEntry, count HitCount) {
+	entry.Hits += count.Hits
+	if count.LastAccessed > entry.LastAccessed {
+		entry.LastAccessed = count.LastAccessed
+	}
+}
+
+// applyUrlEntryUpdate changes entry in place, recording a replaced long url in its history.
+// Stores that keep whole entries (memory, BoltDB) share it.
+func applyUrlEntryUpdate(entry *UrlMappingEntry, update *UrlEntryUpdate) {
+	if update.LongUrl != nil && *update.LongUrl != entry.LongUrl {
+		// Never share the history slice with copies handed out earlier
+		history := make([]UrlDestination, len(entry.History), len(entry.History)+1)
+		copy(history, entry.History)
+		entry.History = append(history, UrlDestination{
+			LongUrl:    entry.LongUrl,
+			ReplacedTs: time.Now().Unix(),
+			Actor:      update.Actor,
+		})
+		entry.LongUrl = *update.LongUrl
+	}
+	if update.ExpiresAt != nil {
+		entry.ExpiresAt = *update.ExpiresAt
+	}
+	if update.RedirectType != nil {
+		entry.RedirectType = *update.RedirectType
+	}
+}
+
+// sortByHits orders entries by hit count.
+// Ties are broken by the short url to keep the order stable
+func sortByHits(results []*UrlMappingEntry, asc bool) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Hits == results[j].Hits {
+			return results[i].ShortUrl < results[j].ShortUrl
+		}
+		if asc {
+			return results[i].Hits < results[j].Hits
+		}
+		return results[i].Hits > results[j].Hits
+	})
+}
+
+func (ms *MemoryUrlStore) AddUrlEntry(ctx context.Context, entry *UrlMappingEntry) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if entry.DedupeKey != "" && !ms.claimDedupeKey(entry.DedupeKey) {
+		log.Printf("A short URL already exists for %s", entry.LongUrl)
+		return ErrUrlEntryAlreadyExists
+	}
+	if _, ok := ms.entries[entry.ShortUrl]; ok {
+		log.Printf("Short URL %s is already mapped", entry.ShortUrl)
+		return ErrShortUrlAlreadyExists
+	}
+
+	elem := *entry
+	ms.entries[entry.ShortUrl] = &elem
+	ms.workspaceCounts[entry.Workspace]++
+	if entry.DedupeKey != "" {
+		ms.dedupeKeys[entry.DedupeKey] = entry.ShortUrl
+	}
+	return nil
+}
+
+func (ms *MemoryUrlStore) GetMappedUrl(ctx context.Context, shortUrl string) (string, error) {
+
+	return mappedUrl(ms.GetUrlEntry(ctx, shortUrl))
+}
+
+func (ms *MemoryUrlStore) GetUrlEntry(ctx context.Context, shortUrl string) (*UrlMappingEntry, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	entry, ok := ms.entries[shortUrl]
+	if !ok {
+		log.Printf("No short URL exists for %s", shortUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+	elem := *entry
+	return &elem, nil
+}
+
+func (ms *MemoryUrlStore) GetUrlEntryByLongUrl(ctx context.Context, workspace, host, longUrl string) (*UrlMappingEntry, error) {
+	ms.mu.RLock()
+	shortUrl, ok := ms.dedupeKeys[DedupeKey(workspace, host, longUrl)]
+	ms.mu.RUnlock()
+
+	if !ok {
+		log.Printf("No short URL exists for %s", longUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+	return ms.GetUrlEntry(ctx, shortUrl)
+}
+
+func (ms *MemoryUrlStore) CheckIfUrlExists(ctx context.Context, url string, isLong bool) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if isLong {
+		// In any workspace
+		for _, entry := range ms.entries {
+			if entry.LongUrl == url {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := ms.entries[url]
+	return ok
+}
+
+func (ms *MemoryUrlStore) DeleteUrlEntry(ctx context.Context, shortUrl string, cond *UrlEntryCondition) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, ok := ms.entries[shortUrl]
+	if ok && cond.allows(entry) {
+		ms.removeEntry(entry)
+		return nil
+	}
+	if cond != nil {
+		log.Printf("No short URL matching the condition exists for %s", shortUrl)
+		return ErrUrlEntryNotFound
+	}
+	// Deleting a missing entry is not an error, same as MongoUrlStore
+	return nil
+}
+
+func (ms *MemoryUrlStore) UpdateUrlEntry(ctx context.Context, shortUrl string, update *UrlEntryUpdate) (*UrlMappingEntry, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, ok := ms.entries[shortUrl]
+	if !ok {
+		log.Printf("No short URL exists for %s", shortUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+	if !update.allows(entry) {
+		log.Printf("%s no longer matches the condition of the update", shortUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+
+	if update.LongUrl != nil && *update.LongUrl != entry.LongUrl && entry.DedupeKey != "" {
+		newKey := entry.dedupeKeyFor(*update.LongUrl)
+		if !ms.claimDedupeKey(newKey) {
+			log.Printf("A short URL already exists for %s", *update.LongUrl)
+			return nil, ErrUrlEntryAlreadyExists
+		}
+		delete(ms.dedupeKeys, entry.DedupeKey)
+		ms.dedupeKeys[newKey] = shortUrl
+		entry.DedupeKey = newKey
+	}
+	applyUrlEntryUpdate(entry, update)
+
+	elem := *entry
+	return &elem, nil
+}
+
+func (ms *MemoryUrlStore) GetUrlHistory(ctx context.Context, shortUrl string) ([]UrlDestination, error) {
+
+	entry, err := ms.GetUrlEntry(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
+	return entry.History, nil
+}
+
+func (ms *MemoryUrlStore) DeleteExpiredUrlEntries(ctx context.Context, before int64) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var deleted int64
+	for _, entry := range ms.entries {
+		if entry.ExpiresAt > 0 && entry.ExpiresAt < before {
+			ms.removeEntry(entry)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// claimDedupeKey reports whether key is free, after taking it away from the entry
+// that holds it if that has expired. The caller holds the write lock
+func (ms *MemoryUrlStore) claimDedupeKey(key string) bool {
+	holder, ok := ms.entries[ms.dedupeKeys[key]]
+	if !ok {
+		return true
+	}
+	if !holder.IsExpired(time.Now().Unix()) {
+		return false
+	}
+	log.Printf("Releasing the dedupe key of expired short URL %s", holder.ShortUrl)
+	holder.DedupeKey = ""
+	delete(ms.dedupeKeys, key)
+	return true
+}
+
+// removeEntry drops entry and its dedupe key. The caller holds the write lock
+func (ms *MemoryUrlStore) removeEntry(entry *UrlMappingEntry) {
+	if entry.DedupeKey != "" {
+		delete(ms.dedupeKeys, entry.DedupeKey)
+	}
+	delete(ms.entries, entry.ShortUrl)
+	if ms.workspaceCounts[entry.Workspace]--; ms.workspaceCounts[entry.Workspace] <= 0 {
+		delete(ms.workspaceCounts, entry.Workspace)
+	}
+}
+
+func (ms *MemoryUrlStore) UpdateUrlHitCount(ctx context.Context, shortUrl string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, ok := ms.entries[shortUrl]
+	if !ok {
+		log.Printf("No short URL exists for %s", shortUrl)
+		return ErrUrlEntryNotFound
+	}
+	entry.Hits += 1
+	entry.LastAccessed = time.Now().Unix()
+	return nil
+}
+
+func (ms *MemoryUrlStore) CountUrlEntries(ctx context.Context, workspace string) (int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.workspaceCounts[workspace], nil
+}
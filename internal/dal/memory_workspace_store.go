@@ -0,0 +1,62 @@
+package dal
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryWorkspaceStore keeps workspaces in process memory. Nothing survives a restart.
+type MemoryWorkspaceStore struct {
+	mu         sync.RWMutex
+	workspaces map[string]Workspace
+}
+
+func NewMemoryWorkspaceStore() WorkspaceStore {
+	return &MemoryWorkspaceStore{workspaces: make(map[string]Workspace)}
+}
+
+func (ms *MemoryWorkspaceStore) AddWorkspace(ctx context.Context, ws *Workspace) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.workspaces[ws.Id]; ok {
+		return ErrWorkspaceAlreadyExists
+	}
+	ms.workspaces[ws.Id] = *ws
+	return nil
+}
+
+func (ms *MemoryWorkspaceStore) GetWorkspace(ctx context.Context, id string) (*Workspace, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	ws, ok := ms.workspaces[id]
+	if !ok {
+		return nil, ErrWorkspaceNotFound
+	}
+	return &ws, nil
+}
+
+func (ms *MemoryWorkspaceStore) UpdateWorkspace(ctx context.Context, ws *Workspace) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.workspaces[ws.Id]; !ok {
+		return ErrWorkspaceNotFound
+	}
+	ms.workspaces[ws.Id] = *ws
+	return nil
+}
+
+func (ms *MemoryWorkspaceStore) ListWorkspaces(ctx context.Context) ([]*Workspace, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	workspaces := make([]*Workspace, 0, len(ms.workspaces))
+	for _, ws := range ms.workspaces {
+		elem := ws
+		workspaces = append(workspaces, &elem)
+	}
+	sortWorkspaces(workspaces)
+	return workspaces, nil
+}
@@ -0,0 +1,60 @@
+package dal
+
+// MetricsQuery selects the entries last accessed between Start (inclusive) and End (exclusive).
+// Entries are ordered by hits, then by short url so that the order is total.
+type MetricsQuery struct {
+	// Only entries of this workspace
+	Workspace string
+	Start     int64
+	End       int64
+	Asc       bool
+	// Maximum number of entries. Zero means no limit
+	Limit int
+	// Only entries that come after this one in the query order. Nil starts from the top
+	After *MetricsCursor
+}
+
+// MetricsCursor is the position of an entry in the order of a MetricsQuery
+type MetricsCursor struct {
+	Hits     int64
+	ShortUrl string
+}
+
+// matches reports whether entry is in the workspace and range of q, and after its cursor
+func (q MetricsQuery) matches(entry *UrlMappingEntry) bool {
+	if entry.Workspace != q.Workspace || entry.LastAccessed < q.Start || entry.LastAccessed >= q.End {
+		return false
+	}
+	if q.After == nil {
+		return true
+	}
+	if entry.Hits == q.After.Hits {
+		return entry.ShortUrl > q.After.ShortUrl
+	}
+	if q.Asc {
+		return entry.Hits > q.After.Hits
+	}
+	return entry.Hits < q.After.Hits
+}
+
+// streamEntries sorts the entries matching q and hands them to fn, up to q.Limit.
+// It backs the stores that cannot sort natively.
+func streamEntries(entries []*UrlMappingEntry, q MetricsQuery, fn func(*UrlMappingEntry) error) error {
+	var results []*UrlMappingEntry
+	for _, entry := range entries {
+		if q.matches(entry) {
+			results = append(results, entry)
+		}
+	}
+
+	sortByHits(results, q.Asc)
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	for _, entry := range results {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
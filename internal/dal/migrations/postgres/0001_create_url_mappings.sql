@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS url_mappings (
+    id            BIGSERIAL PRIMARY KEY,
+    short_url     TEXT   NOT NULL,
+    long_url      TEXT   NOT NULL,
+    hits          BIGINT NOT NULL DEFAULT 0,
+    created_ts    BIGINT NOT NULL,
+    last_accessed BIGINT NOT NULL,
+    CONSTRAINT url_mappings_short_url_key UNIQUE (short_url),
+    CONSTRAINT url_mappings_long_url_key UNIQUE (long_url)
+);
+
+-- GetUrlMetrics filters on last_accessed and orders by hits
+CREATE INDEX IF NOT EXISTS url_mappings_last_accessed_idx ON url_mappings (last_accessed);
+CREATE INDEX IF NOT EXISTS url_mappings_hits_idx ON url_mappings (hits);
@@ -0,0 +1,5 @@
+-- Unix time from which a short URL stops redirecting. Zero means never
+ALTER TABLE url_mappings ADD COLUMN IF NOT EXISTS expires_at BIGINT NOT NULL DEFAULT 0;
+
+-- Only expiring links are looked at by the expiry sweeper
+CREATE INDEX IF NOT EXISTS url_mappings_expires_at_idx ON url_mappings (expires_at) WHERE expires_at > 0;
@@ -0,0 +1,9 @@
+-- Previous destinations of retargeted short URLs
+CREATE TABLE IF NOT EXISTS url_history (
+    id          BIGSERIAL PRIMARY KEY,
+    short_url   TEXT   NOT NULL REFERENCES url_mappings (short_url) ON DELETE CASCADE,
+    long_url    TEXT   NOT NULL,
+    replaced_ts BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS url_history_short_url_idx ON url_history (short_url, id);
@@ -0,0 +1,2 @@
+-- Who retargeted the short URL
+ALTER TABLE url_history ADD COLUMN IF NOT EXISTS actor TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+-- One row per redirect. Not tied to url_mappings by a foreign key, because
+-- clicks are written in batches and may land after the link was deleted.
+CREATE TABLE IF NOT EXISTS click_events (
+    id              BIGSERIAL PRIMARY KEY,
+    short_url       TEXT   NOT NULL,
+    ts              BIGINT NOT NULL,
+    referrer        TEXT   NOT NULL DEFAULT '',
+    user_agent      TEXT   NOT NULL DEFAULT '',
+    accept_language TEXT   NOT NULL DEFAULT '',
+    ip_hash         TEXT   NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS click_events_short_url_ts_idx ON click_events (short_url, ts);
@@ -0,0 +1,13 @@
+-- Management API keys. Only a hash of the secret is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_id     TEXT PRIMARY KEY,
+    hash       TEXT    NOT NULL,
+    owner      TEXT    NOT NULL,
+    name       TEXT    NOT NULL DEFAULT '',
+    admin      BOOLEAN NOT NULL DEFAULT FALSE,
+    created_ts BIGINT  NOT NULL,
+    revoked_ts BIGINT  NOT NULL DEFAULT 0
+);
+
+-- Links created before keys existed have no owner, so only admin keys may manage them
+ALTER TABLE url_mappings ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
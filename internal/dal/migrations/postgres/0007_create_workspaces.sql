@@ -0,0 +1,17 @@
+-- Workspaces are namespaces of links shared by a team
+CREATE TABLE IF NOT EXISTS workspaces (
+    workspace_id      TEXT PRIMARY KEY,
+    name              TEXT   NOT NULL DEFAULT '',
+    short_code_prefix TEXT   NOT NULL DEFAULT '',
+    max_links         BIGINT NOT NULL DEFAULT 0,
+    created_ts        BIGINT NOT NULL
+);
+
+-- Existing keys and links stay in the default workspace, named by the empty string
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS workspace TEXT NOT NULL DEFAULT '';
+ALTER TABLE url_mappings ADD COLUMN IF NOT EXISTS workspace TEXT NOT NULL DEFAULT '';
+
+-- Long urls are unique per workspace rather than globally
+ALTER TABLE url_mappings DROP CONSTRAINT IF EXISTS url_mappings_long_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS url_mappings_workspace_long_url_key ON url_mappings (workspace, long_url);
+CREATE INDEX IF NOT EXISTS url_mappings_workspace_hits_idx ON url_mappings (workspace, hits);
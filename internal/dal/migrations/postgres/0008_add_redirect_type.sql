@@ -0,0 +1,2 @@
+-- HTTP status of the redirects of a link. 0 means the server default
+ALTER TABLE url_mappings ADD COLUMN IF NOT EXISTS redirect_type INTEGER NOT NULL DEFAULT 0;
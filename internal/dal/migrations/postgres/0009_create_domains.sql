@@ -0,0 +1,8 @@
+-- Custom domains that short urls are served from. Short codes are unique per domain,
+-- as the short_url of a link on a custom domain is stored as <host>/<code>
+CREATE TABLE IF NOT EXISTS domains (
+    host       TEXT PRIMARY KEY,
+    workspace  TEXT   NOT NULL DEFAULT '',
+    scheme     TEXT   NOT NULL DEFAULT '',
+    created_ts BIGINT NOT NULL
+);
@@ -0,0 +1,13 @@
+-- How a workspace treats a long url that is already shortened. '' means the server default
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS dedupe_policy TEXT NOT NULL DEFAULT '';
+
+-- Links are deduplicated through a hash of their workspace, custom domain and long url, see
+-- dal.DedupeKey. Links created while duplicates are allowed have none, and the unique index leaves them out
+ALTER TABLE url_mappings ADD COLUMN IF NOT EXISTS dedupe_key TEXT;
+UPDATE url_mappings SET dedupe_key = encode(sha256(convert_to(workspace || '/' ||
+    CASE WHEN position('/' IN short_url) > 0 THEN split_part(short_url, '/', 1) || ' ' ELSE '' END ||
+    long_url, 'UTF8')), 'hex')
+WHERE dedupe_key IS NULL;
+
+DROP INDEX IF EXISTS url_mappings_workspace_long_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS url_mappings_dedupe_key_key ON url_mappings (dedupe_key) WHERE dedupe_key IS NOT NULL;
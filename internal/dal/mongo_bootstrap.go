@@ -0,0 +1,525 @@
+package dal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDB error codes
+const (
+	// A namespace that does not exist, e.g. a collection that a concurrent rename moved away
+	mongoNamespaceNotFound = 26
+	// A namespace that already exists, e.g. from a concurrent CreateCollection
+	mongoNamespaceExists = 48
+	// An index on the same keys as an existing one, which MongoDB only allows for distinct partial filters
+	mongoIndexOptionsConflict  = 85
+	mongoIndexKeySpecsConflict = 86
+)
+
+// Keys of the TTL index that purges expired links
+var mongoTtlKeys = bson.D{{Key: "expires_on", Value: int32(1)}}
+
+// mongoIndex is an index that BootstrapMongo keeps on the URL collection
+type mongoIndex struct {
+	name string
+	keys bson.D
+	// What the index serves, for the startup report
+	purpose string
+	unique  bool
+	partial bson.D
+	// Seconds after the indexed date at which MongoDB deletes the document. Nil for other indexes
+	expireAfter *int32
+}
+
+// mongoIndexSpec is an index as listIndexes reports it
+type mongoIndexSpec struct {
+	Name        string      `bson:"name"`
+	Key         bson.D      `bson:"key"`
+	Unique      bool        `bson:"unique"`
+	Partial     bson.Raw    `bson:"partialFilterExpression"`
+	ExpireAfter interface{} `bson:"expireAfterSeconds"`
+}
+
+// mongoUrlIndexes is the index plan of the URL collection. The TTL index on
+// expires_on is only part of it when expired links are purged, after purgeAfter.
+func mongoUrlIndexes(purgeAfter *time.Duration) []mongoIndex {
+
+	indexes := []mongoIndex{
+		{
+			name:    "short_url_unique",
+			keys:    bson.D{{Key: "short_url", Value: int32(1)}},
+			purpose: "redirects, short code collisions",
+			unique:  true,
+		},
+		{
+			// Entries created while duplicates were allowed have an empty dedupe_key and are left out
+			name:    "dedupe_key_unique",
+			keys:    bson.D{{Key: "dedupe_key", Value: int32(1)}},
+			purpose: "long url deduplication per workspace",
+			unique:  true,
+			partial: bson.D{{Key: "dedupe_key", Value: bson.D{{Key: "$gt", Value: ""}}}},
+		},
+		{
+			name:    "last_accessed",
+			keys:    bson.D{{Key: "last_accessed", Value: int32(1)}},
+			purpose: "metrics date ranges",
+		},
+		{
+			name:    "workspace_hits",
+			keys:    bson.D{{Key: "workspace", Value: int32(1)}, {Key: "hits", Value: int32(-1)}, {Key: "short_url", Value: int32(1)}},
+			purpose: "metrics pages ordered by hits, link quotas",
+		},
+	}
+	if purgeAfter != nil {
+		seconds := int32(math.Min(purgeAfter.Seconds(), math.MaxInt32))
+		indexes = append(indexes, mongoIndex{
+			name:        "expires_on_ttl",
+			keys:        mongoTtlKeys,
+			purpose:     fmt.Sprintf("purges links %v after they expire", *purgeAfter),
+			expireAfter: &seconds,
+		})
+	}
+	return indexes
+}
+
+// mongoCollectionIndexes are the indexes that BootstrapMongo keeps on one collection
+type mongoCollectionIndexes struct {
+	collection string
+	indexes    []mongoIndex
+}
+
+// mongoIndexPlan is the index plan of the URL collection and of the collections next to it
+func mongoIndexPlan(collection string, purgeAfter *time.Duration) []mongoCollectionIndexes {
+
+	return []mongoCollectionIndexes{
+		{collection: collection, indexes: mongoUrlIndexes(purgeAfter)},
+		{collection: clickCollection, indexes: []mongoIndex{{
+			name:    "short_url_ts",
+			keys:    bson.D{{Key: "short_url", Value: int32(1)}, {Key: "ts", Value: int32(1)}},
+			purpose: "click stats of a link",
+		}}},
+		{collection: workspaceCollection, indexes: []mongoIndex{{
+			name:    "workspace_id_unique",
+			keys:    bson.D{{Key: "workspace_id", Value: int32(1)}},
+			purpose: "workspace lookups, concurrent creates",
+			unique:  true,
+		}}},
+		{collection: domainCollection, indexes: []mongoIndex{{
+			name:    "host_unique",
+			keys:    bson.D{{Key: "host", Value: int32(1)}},
+			purpose: "custom domain lookups, concurrent adds",
+			unique:  true,
+		}}},
+		{collection: apiKeyCollection, indexes: []mongoIndex{{
+			name:    "key_id_unique",
+			keys:    bson.D{{Key: "key_id", Value: int32(1)}},
+			purpose: "API key lookups",
+			unique:  true,
+		}}},
+	}
+}
+
+// BootstrapMongo makes sure that the URL collection and the indexes of the index plan
+// exist, and reports the plan. It is idempotent, so every start of the server runs it.
+//
+// Documents from before dedupe policies and TTL purging are backfilled with their
+// dedupe_key and expires_on. Without purgeAfter, purging is disabled and the TTL index
+// is dropped, so that expired links are kept.
+func BootstrapMongo(ctx context.Context, c *mongo.Client, db, collection string, purgeAfter *time.Duration) error {
+
+	if err := moveLegacyUrlCollection(ctx, c, db, collection); err != nil {
+		return err
+	}
+
+	report := &bytes.Buffer{}
+	w := tabwriter.NewWriter(report, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "MongoDB index plan for %s\n", db)
+	for _, plan := range mongoIndexPlan(collection, purgeAfter) {
+		if err := ensureMongoCollection(ctx, c.Database(db), plan.collection); err != nil {
+			return fmt.Errorf("Unable to create MongoDB collection %s.%s. Err=%w", db, plan.collection, err)
+		}
+		coll := c.Database(db).Collection(plan.collection)
+		existing, err := listMongoIndexes(ctx, coll)
+		if err != nil {
+			return err
+		}
+
+		for _, index := range plan.indexes {
+			status, err := ensureMongoIndex(ctx, coll, index, existing)
+			if err != nil {
+				return fmt.Errorf("Unable to create MongoDB index %s on %s.%s. Err=%w", index.name, db, plan.collection, err)
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", plan.collection, index.name, describeMongoIndex(index), status, index.purpose)
+		}
+		if plan.collection == collection && purgeAfter == nil {
+			for _, spec := range existing {
+				if !sameIndexKeys(spec.Key, mongoTtlKeys) || spec.ExpireAfter == nil {
+					continue
+				}
+				if _, err := coll.Indexes().DropOne(ctx, spec.Name); err != nil {
+					return fmt.Errorf("Unable to drop MongoDB index %s on %s.%s. Err=%w", spec.Name, db, collection, err)
+				}
+				fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", collection, spec.Name, "{expires_on: 1}", "dropped", "purging is disabled")
+			}
+		}
+	}
+	_ = w.Flush()
+	log.Print(strings.TrimSuffix(report.String(), "\n"))
+
+	// After the unique index on dedupe_key, so that it catches any duplicates
+	urlTbl := c.Database(db).Collection(collection)
+	if err := backfillDedupeKeys(ctx, urlTbl); err != nil {
+		return err
+	}
+	return backfillExpiresOn(ctx, urlTbl)
+}
+
+// moveLegacyUrlCollection moves URL mappings from where releases before the collection
+// naming fix kept them. Those wrote to the collection "<collection>." of the database
+// named like the collection, and left an empty collection at the configured place.
+func moveLegacyUrlCollection(ctx context.Context, c *mongo.Client, db, collection string) error {
+
+	// Counted exactly, as the estimate comes from metadata that may be stale after an unclean shutdown
+	legacyDb, legacyCollection := collection, collection+"."
+	legacy, err := c.Database(legacyDb).Collection(legacyCollection).CountDocuments(ctx, bson.D{})
+	if err != nil || legacy == 0 {
+		return err
+	}
+	current, err := c.Database(db).Collection(collection).CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	if current > 0 {
+		log.Printf("Found %d URL mappings in %s.%s and %d in %s.%s. Leaving them where they are, merge them by hand",
+			legacy, legacyDb, legacyCollection, current, db, collection)
+		return nil
+	}
+
+	log.Printf("Moving %d URL mappings from %s.%s to %s.%s", legacy, legacyDb, legacyCollection, db, collection)
+	err = c.Database("admin").RunCommand(ctx, bson.D{
+		{Key: "renameCollection", Value: legacyDb + "." + legacyCollection},
+		{Key: "to", Value: db + "." + collection},
+		// The configured collection is known to be empty
+		{Key: "dropTarget", Value: true},
+	}).Err()
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.HasErrorCode(mongoNamespaceNotFound) {
+		// Another instance that started at the same time moved them first
+		log.Printf("URL mappings in %s.%s were already moved", legacyDb, legacyCollection)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to move URL mappings from %s.%s. Err=%w", legacyDb, legacyCollection, err)
+	}
+	return nil
+}
+
+func ensureMongoCollection(ctx context.Context, db *mongo.Database, collection string) error {
+
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": collection})
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return nil
+	}
+	err = db.CreateCollection(ctx, collection)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.HasErrorCode(mongoNamespaceExists) {
+		// Another instance created it first
+		return nil
+	}
+	return err
+}
+
+func listMongoIndexes(ctx context.Context, coll *mongo.Collection) ([]mongoIndexSpec, error) {
+
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var specs []mongoIndexSpec
+	if err := cursor.All(ctx, &specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// ensureMongoIndex creates index unless an index on the same keys exists. An existing
+// index with other options is changed in place if only its TTL differs, and replaced
+// otherwise. It returns what was done, for the startup report.
+func ensureMongoIndex(ctx context.Context, coll *mongo.Collection, index mongoIndex, existing []mongoIndexSpec) (string, error) {
+
+	var stale []mongoIndexSpec
+	exists := false
+	for _, spec := range existing {
+		if !sameIndexKeys(spec.Key, index.keys) {
+			continue
+		}
+		sameOptions := spec.Unique == index.unique && samePartialFilter(spec.Partial, index.partial)
+		sameTtl := sameExpireAfter(spec.ExpireAfter, index.expireAfter)
+		if sameOptions && sameTtl {
+			exists = true
+			continue
+		}
+
+		if sameOptions && spec.ExpireAfter != nil && index.expireAfter != nil {
+			err := coll.Database().RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: coll.Name()},
+				{Key: "index", Value: bson.D{
+					{Key: "name", Value: spec.Name},
+					{Key: "expireAfterSeconds", Value: *index.expireAfter},
+				}},
+			}).Err()
+			if err != nil {
+				return "", err
+			}
+			return "updated", nil
+		}
+		stale = append(stale, spec)
+	}
+
+	if exists {
+		// The stand-in of a replacement that was interrupted is of no use any more
+		stand := standInMongoIndex(index)
+		for _, spec := range stale {
+			if spec.Name == stand.name {
+				if _, err := coll.Indexes().DropOne(ctx, spec.Name); err != nil {
+					return "", err
+				}
+				return "exists, dropped " + spec.Name, nil
+			}
+		}
+		return "exists", nil
+	}
+	if len(stale) == 0 {
+		return "created", createMongoIndex(ctx, coll, index.name, index)
+	}
+	return replaceMongoIndex(ctx, coll, index, stale)
+}
+
+// standInMongoIndex is index under a temporary name, with an extra condition that every
+// document meets. It holds the same documents to the same rules as index, while MongoDB
+// takes it for another index, so that both can exist at the same time.
+func standInMongoIndex(index mongoIndex) mongoIndex {
+	stand := index
+	stand.name = index.name + "_next"
+	stand.partial = append(append(bson.D{}, index.partial...), bson.E{Key: "_id", Value: bson.D{{Key: "$exists", Value: true}}})
+	return stand
+}
+
+// replaceMongoIndex replaces the stale indexes on the keys of index. The replacement is built
+// before they are dropped, so that writes are never without the guarantee of a unique index.
+// If a stale index has the name of index, a stand-in takes its place until index is rebuilt
+// under that name, see standInMongoIndex.
+func replaceMongoIndex(ctx context.Context, coll *mongo.Collection, index mongoIndex, stale []mongoIndexSpec) (string, error) {
+
+	replacement, unique := index, false
+	for _, spec := range stale {
+		if spec.Name == index.name {
+			replacement = standInMongoIndex(index)
+		}
+		unique = unique || spec.Unique
+	}
+
+	log.Printf("Replacing MongoDB index %s, as its options changed", stale[0].Name)
+	err := createMongoIndex(ctx, coll, replacement.name, replacement)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.HasErrorCode(mongoIndexOptionsConflict) || cmdErr.HasErrorCode(mongoIndexKeySpecsConflict)) {
+		// MongoDB does not build it next to the stale index
+		if unique {
+			return "", fmt.Errorf("The unique index %s cannot be replaced while it is in use. "+
+				"Drop it by hand while no links are created, and restart: %v", stale[0].Name, err)
+		}
+		// Only queries are slower until the replacement is built
+		for _, spec := range stale {
+			if _, err := coll.Indexes().DropOne(ctx, spec.Name); err != nil {
+				return "", err
+			}
+		}
+		return "rebuilt", createMongoIndex(ctx, coll, index.name, index)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	for _, spec := range stale {
+		if spec.Name == replacement.name {
+			// The stand-in of an earlier replacement, which was built again above
+			continue
+		}
+		if _, err := coll.Indexes().DropOne(ctx, spec.Name); err != nil {
+			return "", err
+		}
+	}
+	if replacement.name != index.name {
+		if err := createMongoIndex(ctx, coll, index.name, index); err != nil {
+			return "", err
+		}
+		if _, err := coll.Indexes().DropOne(ctx, replacement.name); err != nil {
+			return "", err
+		}
+	}
+	return "rebuilt", nil
+}
+
+// createMongoIndex builds index under name
+func createMongoIndex(ctx context.Context, coll *mongo.Collection, name string, index mongoIndex) error {
+
+	opts := options.Index().SetName(name)
+	if index.unique {
+		opts.SetUnique(true)
+	}
+	if index.partial != nil {
+		opts.SetPartialFilterExpression(index.partial)
+	}
+	if index.expireAfter != nil {
+		opts.SetExpireAfterSeconds(*index.expireAfter)
+	}
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: index.keys, Options: opts})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("The collection has duplicate values for the unique index, remove them first: %v", err)
+	}
+	return err
+}
+
+// backfillDedupeKeys gives the documents from before dedupe policies their dedupe_key.
+// They were all deduplicated then, except for duplicates that slipped through without an
+// index. The oldest of those keeps the key, and the others are treated like duplicates
+// that were allowed.
+func backfillDedupeKeys(ctx context.Context, coll *mongo.Collection) error {
+
+	missing := bson.M{"dedupe_key": bson.M{"$exists": false}}
+	// Once every document has its key, skip the sort that the backfill needs
+	count, err := coll.CountDocuments(ctx, missing, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	cursor, err := coll.Find(ctx, missing,
+		options.Find().SetSort(bson.D{{Key: "created_ts", Value: 1}}).SetAllowDiskUse(true).
+			SetProjection(bson.M{"_id": 1, "short_url": 1, "long_url": 1, "workspace": 1}))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var backfilled, duplicates int
+	for cursor.Next(ctx) {
+		var doc struct {
+			Id    interface{}     `bson:"_id"`
+			Entry UrlMappingEntry `bson:",inline"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+
+		filter := bson.M{"_id": doc.Id, "dedupe_key": bson.M{"$exists": false}}
+		_, err := coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"dedupe_key": doc.Entry.dedupeKeyFor(doc.Entry.LongUrl)}})
+		if mongo.IsDuplicateKeyError(err) {
+			log.Printf("Short URL %s duplicates the long url %s, which is no longer deduplicated to it", doc.Entry.ShortUrl, doc.Entry.LongUrl)
+			_, err = coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"dedupe_key": ""}})
+			duplicates++
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to backfill the dedupe key of %s. Err=%w", doc.Entry.ShortUrl, err)
+		}
+		backfilled++
+	}
+	if backfilled > 0 {
+		log.Printf("Backfilled the dedupe key of %d URL mappings, %d of them duplicates", backfilled, duplicates)
+	}
+	return cursor.Err()
+}
+
+// backfillExpiresOn gives expiring documents from before TTL purging their expires_on
+func backfillExpiresOn(ctx context.Context, coll *mongo.Collection) error {
+
+	res, err := coll.UpdateMany(ctx,
+		bson.M{"expires_at": bson.M{"$gt": 0}, "expires_on": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"expires_on": bson.M{"$toDate": bson.M{"$multiply": bson.A{"$expires_at", 1000}}},
+		}}}})
+	if err != nil {
+		return fmt.Errorf("Unable to backfill the expiry dates. Err=%w", err)
+	}
+	if res.ModifiedCount > 0 {
+		log.Printf("Backfilled the expiry date of %d URL mappings", res.ModifiedCount)
+	}
+	return nil
+}
+
+// describeMongoIndex formats the keys and options of index, e.g. {short_url: 1} unique
+func describeMongoIndex(index mongoIndex) string {
+
+	keys := make([]string, len(index.keys))
+	for i, key := range index.keys {
+		keys[i] = fmt.Sprintf("%s: %v", key.Key, key.Value)
+	}
+	description := "{" + strings.Join(keys, ", ") + "}"
+	if index.unique {
+		description += " unique"
+	}
+	if index.partial != nil {
+		description += " partial"
+	}
+	if index.expireAfter != nil {
+		description += fmt.Sprintf(" ttl=%ds", *index.expireAfter)
+	}
+	return description
+}
+
+func sameIndexKeys(a, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key || fmt.Sprint(indexNumber(a[i].Value)) != fmt.Sprint(indexNumber(b[i].Value)) {
+			return false
+		}
+	}
+	return true
+}
+
+func samePartialFilter(existing bson.Raw, partial bson.D) bool {
+	if partial == nil {
+		return len(existing) == 0
+	}
+	raw, err := bson.Marshal(partial)
+	return err == nil && bytes.Equal(raw, existing)
+}
+
+func sameExpireAfter(existing interface{}, expireAfter *int32) bool {
+	if expireAfter == nil {
+		return existing == nil
+	}
+	return existing != nil && indexNumber(existing) == int64(*expireAfter)
+}
+
+// indexNumber brings the numbers of index specs into one type. Shells and drivers write
+// them as int32, int64 or double. Other values, such as "text" or "2dsphere", are kept.
+func indexNumber(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return v
+}
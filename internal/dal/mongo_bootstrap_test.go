@@ -0,0 +1,165 @@
+package dal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSameIndexKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b bson.D
+		same bool
+	}{
+		{"same", bson.D{{Key: "short_url", Value: int32(1)}}, bson.D{{Key: "short_url", Value: int32(1)}}, true},
+		{"int64 from a driver", bson.D{{Key: "short_url", Value: int64(1)}}, bson.D{{Key: "short_url", Value: int32(1)}}, true},
+		{"double from the shell", bson.D{{Key: "hits", Value: float64(-1)}}, bson.D{{Key: "hits", Value: int32(-1)}}, true},
+		{"other direction", bson.D{{Key: "hits", Value: int32(1)}}, bson.D{{Key: "hits", Value: int32(-1)}}, false},
+		{"other field", bson.D{{Key: "long_url", Value: int32(1)}}, bson.D{{Key: "short_url", Value: int32(1)}}, false},
+		{
+			"other order",
+			bson.D{{Key: "hits", Value: int32(-1)}, {Key: "workspace", Value: int32(1)}},
+			bson.D{{Key: "workspace", Value: int32(1)}, {Key: "hits", Value: int32(-1)}},
+			false,
+		},
+		{"prefix", bson.D{{Key: "workspace", Value: int32(1)}}, bson.D{{Key: "workspace", Value: int32(1)}, {Key: "hits", Value: int32(-1)}}, false},
+		{"text", bson.D{{Key: "long_url", Value: "text"}}, bson.D{{Key: "long_url", Value: "text"}}, true},
+		{"text and ascending", bson.D{{Key: "long_url", Value: "text"}}, bson.D{{Key: "long_url", Value: int32(1)}}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.same, sameIndexKeys(tt.a, tt.b), tt.name)
+	}
+}
+
+func TestSamePartialFilter(t *testing.T) {
+	nonEmpty := bson.D{{Key: "dedupe_key", Value: bson.D{{Key: "$gt", Value: ""}}}}
+	raw, err := bson.Marshal(nonEmpty)
+	require.NoError(t, err)
+	other, err := bson.Marshal(bson.D{{Key: "dedupe_key", Value: bson.D{{Key: "$exists", Value: true}}}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		existing bson.Raw
+		partial  bson.D
+		same     bool
+	}{
+		{"neither", nil, nil, true},
+		{"same filter", raw, nonEmpty, true},
+		{"filter added", nil, nonEmpty, false},
+		{"filter removed", raw, nil, false},
+		{"other filter", other, nonEmpty, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.same, samePartialFilter(tt.existing, tt.partial), tt.name)
+	}
+}
+
+func TestSameExpireAfter(t *testing.T) {
+	week := int32(7 * 24 * 3600)
+	day := int32(24 * 3600)
+
+	tests := []struct {
+		name        string
+		existing    interface{}
+		expireAfter *int32
+		same        bool
+	}{
+		{"no ttl", nil, nil, true},
+		{"same ttl", week, &week, true},
+		{"int64 from a driver", int64(week), &week, true},
+		{"double from the shell", float64(week), &week, true},
+		{"other ttl", day, &week, false},
+		{"ttl added", nil, &week, false},
+		{"ttl removed", week, nil, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.same, sameExpireAfter(tt.existing, tt.expireAfter), tt.name)
+	}
+}
+
+func TestIndexNumber(t *testing.T) {
+	tests := []struct {
+		in, out interface{}
+	}{
+		{int32(1), int64(1)},
+		{int64(-1), int64(-1)},
+		{float64(1), int64(1)},
+		{float64(604800), int64(604800)},
+		{"text", "text"},
+		{"2dsphere", "2dsphere"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.out, indexNumber(tt.in), "%#v", tt.in)
+	}
+}
+
+func TestMongoUrlIndexes(t *testing.T) {
+	week := 7 * 24 * time.Hour
+	forever := time.Duration(math.MaxInt64)
+
+	tests := []struct {
+		name       string
+		purgeAfter *time.Duration
+		// Seconds of the TTL index, nil if there is none
+		ttl *int32
+	}{
+		{name: "purging disabled"},
+		{name: "purging after a week", purgeAfter: &week, ttl: func() *int32 { s := int32(604800); return &s }()},
+		{name: "retention beyond the range of a TTL", purgeAfter: &forever, ttl: func() *int32 { s := int32(math.MaxInt32); return &s }()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexes := mongoUrlIndexes(tt.purgeAfter)
+
+			names := map[string]bool{}
+			var ttl *mongoIndex
+			for i, index := range indexes {
+				assert.False(t, names[index.name], "%s is planned twice", index.name)
+				names[index.name] = true
+				assert.NotEmpty(t, index.purpose, index.name)
+				if index.expireAfter != nil {
+					ttl = &indexes[i]
+				}
+			}
+			assert.True(t, names["short_url_unique"])
+			assert.True(t, names["dedupe_key_unique"])
+
+			if tt.ttl == nil {
+				assert.Nil(t, ttl)
+				return
+			}
+			require.NotNil(t, ttl)
+			assert.Equal(t, "expires_on_ttl", ttl.name)
+			assert.True(t, sameIndexKeys(mongoTtlKeys, ttl.keys))
+			assert.Equal(t, *tt.ttl, *ttl.expireAfter)
+		})
+	}
+}
+
+func TestStandInMongoIndex(t *testing.T) {
+	for _, index := range mongoUrlIndexes(nil) {
+		t.Run(index.name, func(t *testing.T) {
+			stand := standInMongoIndex(index)
+
+			assert.Equal(t, index.name+"_next", stand.name)
+			assert.Equal(t, index.keys, stand.keys)
+			assert.Equal(t, index.unique, stand.unique)
+			// The conditions of the index, and one that every document meets
+			require.Len(t, stand.partial, len(index.partial)+1)
+			for i, cond := range index.partial {
+				assert.Equal(t, cond, stand.partial[i])
+			}
+			assert.Equal(t, "_id", stand.partial[len(index.partial)].Key)
+			// MongoDB must take it for another index
+			raw, err := bson.Marshal(stand.partial)
+			require.NoError(t, err)
+			assert.False(t, samePartialFilter(raw, index.partial))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"gately/internal/config"
+	_ "github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Stores are the stores of one backend, sharing its connection
+type Stores struct {
+	Urls       UrlStore
+	Clicks     ClickStore
+	Keys       KeyStore
+	Workspaces WorkspaceStore
+	Domains    DomainStore
+	// Close releases the connection or file behind the stores
+	Close func() error
+}
+
+// OpenOption changes how Open sets up the backend
+type OpenOption func(o *openOptions)
+
+type openOptions struct {
+	// Whether the MongoDB collections and indexes are set up
+	bootstrap bool
+}
+
+// WithBootstrap sets up the MongoDB collections and indexes, see BootstrapMongo.
+// Only the server does, as the TTL index follows its purge settings.
+func WithBootstrap() OpenOption {
+	return func(o *openOptions) {
+		o.bootstrap = true
+	}
+}
+
+// Open connects to the backend selected by cfg.StoreDriver
+func Open(cfg config.AppConfig, opts ...OpenOption) (*Stores, error) {
+
+	var o openOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	switch cfg.StoreDriver {
+	case config.StoreDriverMemory:
+		log.Printf("Using the in-memory URL store. URL mappings will not survive a restart")
+		return &Stores{
+			Urls:       NewMemoryUrlStore(),
+			Clicks:     NewMemoryClickStore(),
+			Keys:       NewMemoryKeyStore(),
+			Workspaces: NewMemoryWorkspaceStore(),
+			Domains:    NewMemoryDomainStore(),
+			Close:      func() error { return nil },
+		}, nil
+	case config.StoreDriverPostgres:
+		return openPostgres(cfg)
+	case config.StoreDriverBolt:
+		log.Printf("Using the embedded URL store at %s", cfg.EmbeddedPath)
+		db, err := OpenBolt(cfg.EmbeddedPath)
+		if err != nil {
+			return nil, err
+		}
+		return &Stores{
+			Urls:       NewBoltUrlStore(db),
+			Clicks:     NewBoltClickStore(db),
+			Keys:       NewBoltKeyStore(db),
+			Workspaces: NewBoltWorkspaceStore(db),
+			Domains:    NewBoltDomainStore(db),
+			Close:      db.Close,
+		}, nil
+	case config.StoreDriverMongo, "":
+		return openMongo(cfg, o)
+	default:
+		return nil, fmt.Errorf("Unknown store driver %q", cfg.StoreDriver)
+	}
+}
+
+func openMongo(cfg config.AppConfig, o openOptions) (*Stores, error) {
+	// Instantiate MongoDB Client
+	// MongoDB is our source of truth for all URL mappings
+	// This is a read heavy application and MongoDB is best suited for read heavy apps
+	mongoURI := fmt.Sprintf("%s://%s", "mongodb", cfg.MongoHost)
+
+	mongoClient, err := mongo.Connect(context.TODO(),
+		options.Client().ApplyURI(mongoURI),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try to ping MongoDB to test connectivity
+	if err := mongoClient.Ping(context.TODO(), readpref.Primary()); err != nil {
+		return nil, err
+	}
+
+	if o.bootstrap {
+		// Links are purged by a TTL index as well as by the sweeper. Without purging the TTL index is dropped
+		var purgeAfter *time.Duration
+		if cfg.ExpirySweepInterval > 0 {
+			purgeAfter = &cfg.ExpiredRetention
+		}
+		if err := BootstrapMongo(context.TODO(), mongoClient, cfg.MongoDbName, cfg.MongoCollectionName, purgeAfter); err != nil {
+			_ = mongoClient.Disconnect(context.TODO())
+			return nil, err
+		}
+		log.Printf("Successfully bootstrapped the MongoDB collection to store URLs")
+	}
+
+	return &Stores{
+		Urls:       New(WithMongoClient(mongoClient), WithDatabase(cfg.MongoDbName), WithTable(cfg.MongoCollectionName)),
+		Clicks:     NewMongoClickStore(mongoClient, cfg.MongoDbName),
+		Keys:       NewMongoKeyStore(mongoClient, cfg.MongoDbName),
+		Workspaces: NewMongoWorkspaceStore(mongoClient, cfg.MongoDbName),
+		Domains:    NewMongoDomainStore(mongoClient, cfg.MongoDbName),
+		Close:      func() error { return mongoClient.Disconnect(context.Background()) },
+	}, nil
+}
+
+func openPostgres(cfg config.AppConfig) (*Stores, error) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.PostgresUser, cfg.PostgresPass),
+		Host:     cfg.PostgresHost,
+		Path:     cfg.PostgresDbName,
+		RawQuery: url.Values{"sslmode": {cfg.PostgresSslMode}}.Encode(),
+	}
+
+	db, err := sql.Open("postgres", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// Try to ping PostgreSQL to test connectivity
+	if err := db.PingContext(context.TODO()); err != nil {
+		return nil, err
+	}
+
+	if err := MigratePostgres(context.TODO(), db); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Successfully migrated the PostgreSQL schema to store URLs")
+	return &Stores{
+		Urls:       NewPostgresUrlStore(db),
+		Clicks:     NewPostgresClickStore(db),
+		Keys:       NewPostgresKeyStore(db),
+		Workspaces: NewPostgresWorkspaceStore(db),
+		Domains:    NewPostgresDomainStore(db),
+		Close:      db.Close,
+	}, nil
+}
@@ -0,0 +1,89 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// PostgresClickStore stores click events in the click_events table
+type PostgresClickStore struct {
+	db *sql.DB
+}
+
+func NewPostgresClickStore(db *sql.DB) ClickStore {
+	return &PostgresClickStore{db: db}
+}
+
+func (ps *PostgresClickStore) AddClickEvents(ctx context.Context, events []*ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var (
+		shortUrls       = make([]string, len(events))
+		ts              = make([]int64, len(events))
+		referrers       = make([]string, len(events))
+		userAgents      = make([]string, len(events))
+		acceptLanguages = make([]string, len(events))
+		ipHashes        = make([]string, len(events))
+	)
+	for i, e := range events {
+		shortUrls[i] = e.ShortUrl
+		ts[i] = e.Ts
+		referrers[i] = e.Referrer
+		userAgents[i] = e.UserAgent
+		acceptLanguages[i] = e.AcceptLanguage
+		ipHashes[i] = e.IpHash
+	}
+
+	// One statement for the whole batch
+	_, err := ps.db.ExecContext(ctx,
+		`INSERT INTO click_events (short_url, ts, referrer, user_agent, accept_language, ip_hash)
+		SELECT * FROM unnest($1::text[], $2::bigint[], $3::text[], $4::text[], $5::text[], $6::text[])`,
+		pq.Array(shortUrls), pq.Array(ts), pq.Array(referrers),
+		pq.Array(userAgents), pq.Array(acceptLanguages), pq.Array(ipHashes))
+	if err != nil {
+		log.Printf("Unable to add click events. Err = %v", err)
+		return err
+	}
+	return nil
+}
+
+func (ps *PostgresClickStore) GetClickEvents(ctx context.Context, shortUrl string, start, end int64) ([]*ClickEvent, error) {
+	return collectClickEvents(ctx, ps, shortUrl, start, end)
+}
+
+func (ps *PostgresClickStore) StreamClickEvents(ctx context.Context, shortUrl string, start, end int64, fn func(*ClickEvent) error) error {
+
+	rows, err := ps.db.QueryContext(ctx,
+		`SELECT short_url, ts, referrer, user_agent, accept_language, ip_hash FROM click_events
+		WHERE short_url = $1 AND ts >= $2 AND ts < $3 ORDER BY ts, id`, shortUrl, start, end)
+	if err != nil {
+		log.Printf("Unable to get click events for %s. Err=%v", shortUrl, err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		elem := &ClickEvent{}
+		if err := rows.Scan(&elem.ShortUrl, &elem.Ts, &elem.Referrer, &elem.UserAgent, &elem.AcceptLanguage, &elem.IpHash); err != nil {
+			return err
+		}
+		if err := fn(elem); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (ps *PostgresClickStore) DeleteClickEvents(ctx context.Context, shortUrl string) error {
+
+	if _, err := ps.db.ExecContext(ctx, "DELETE FROM click_events WHERE short_url = $1", shortUrl); err != nil {
+		log.Printf("Unable to delete click events of %s. Err=%v", shortUrl, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// PostgresDomainStore stores custom domains in the domains table
+type PostgresDomainStore struct {
+	db *sql.DB
+}
+
+func NewPostgresDomainStore(db *sql.DB) DomainStore {
+	return &PostgresDomainStore{db: db}
+}
+
+func (ps *PostgresDomainStore) AddDomain(ctx context.Context, domain *Domain) error {
+
+	_, err := ps.db.ExecContext(ctx,
+		`INSERT INTO domains (host, workspace, scheme, created_ts) VALUES ($1, $2, $3, $4)`,
+		domain.Host, domain.Workspace, domain.Scheme, domain.CreatedTs)
+	if _, ok := uniqueViolation(err); ok {
+		return ErrDomainAlreadyExists
+	}
+	if err != nil {
+		log.Printf("Unable to add domain %s. Err = %v", domain.Host, err)
+		return err
+	}
+	return nil
+}
+
+func (ps *PostgresDomainStore) GetDomain(ctx context.Context, host string) (*Domain, error) {
+
+	domain := &Domain{}
+	err := ps.db.QueryRowContext(ctx,
+		`SELECT host, workspace, scheme, created_ts FROM domains WHERE host = $1`, host).
+		Scan(&domain.Host, &domain.Workspace, &domain.Scheme, &domain.CreatedTs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDomainNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return domain, nil
+}
+
+func (ps *PostgresDomainStore) ListDomains(ctx context.Context) ([]*Domain, error) {
+
+	rows, err := ps.db.QueryContext(ctx, `SELECT host, workspace, scheme, created_ts FROM domains ORDER BY host`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []*Domain
+	for rows.Next() {
+		domain := &Domain{}
+		if err := rows.Scan(&domain.Host, &domain.Workspace, &domain.Scheme, &domain.CreatedTs); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, rows.Err()
+}
@@ -0,0 +1,82 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// PostgresKeyStore stores API keys in the api_keys table
+type PostgresKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresKeyStore(db *sql.DB) KeyStore {
+	return &PostgresKeyStore{db: db}
+}
+
+func (ps *PostgresKeyStore) AddApiKey(ctx context.Context, key *ApiKey) error {
+
+	_, err := ps.db.ExecContext(ctx,
+		`INSERT INTO api_keys (key_id, hash, owner, name, admin, workspace, created_ts, revoked_ts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		key.Id, key.Hash, key.Owner, key.Name, key.Admin, key.Workspace, key.CreatedTs, key.RevokedTs)
+	if err != nil {
+		log.Printf("Unable to add API key. Err = %v", err)
+		return err
+	}
+	return nil
+}
+
+func (ps *PostgresKeyStore) GetApiKey(ctx context.Context, id string) (*ApiKey, error) {
+
+	key := &ApiKey{}
+	err := ps.db.QueryRowContext(ctx,
+		`SELECT key_id, hash, owner, name, admin, workspace, created_ts, revoked_ts FROM api_keys WHERE key_id = $1`, id).
+		Scan(&key.Id, &key.Hash, &key.Owner, &key.Name, &key.Admin, &key.Workspace, &key.CreatedTs, &key.RevokedTs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrApiKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (ps *PostgresKeyStore) ListApiKeys(ctx context.Context) ([]*ApiKey, error) {
+
+	rows, err := ps.db.QueryContext(ctx,
+		`SELECT key_id, hash, owner, name, admin, workspace, created_ts, revoked_ts FROM api_keys ORDER BY created_ts, key_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*ApiKey
+	for rows.Next() {
+		key := &ApiKey{}
+		if err := rows.Scan(&key.Id, &key.Hash, &key.Owner, &key.Name, &key.Admin, &key.Workspace, &key.CreatedTs, &key.RevokedTs); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (ps *PostgresKeyStore) RevokeApiKey(ctx context.Context, id string, ts int64) error {
+
+	res, err := ps.db.ExecContext(ctx, "UPDATE api_keys SET revoked_ts = $2 WHERE key_id = $1", id, ts)
+	if err != nil {
+		log.Printf("Unable to revoke API key %s. Err = %v", id, err)
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrApiKeyNotFound
+	}
+	return nil
+}
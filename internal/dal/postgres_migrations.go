@@ -0,0 +1,131 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versioned schema migrations for the PostgreSQL store.
+// Each file is named <version>_<description>.sql and is applied exactly once,
+// in version order. Never edit a migration that has been released, add a new one.
+//
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// Arbitrary key for the advisory lock that serializes migrations across replicas
+const postgresMigrationLock = 7316455
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// MigratePostgres brings the database schema up to date.
+// It is safe to run concurrently from several gately instances.
+func MigratePostgres(ctx context.Context, db *sql.DB) error {
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT    NOT NULL,
+		applied_ts BIGINT  NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("Unable to create schema_migrations table. Err=%w", err)
+	}
+
+	migrations, err := loadPostgresMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if err := applyPostgresMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("Unable to apply migration %s. Err=%w", m.name, err)
+		}
+	}
+	return nil
+}
+
+func loadPostgresMigrations() ([]migration, error) {
+	files, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, file := range files {
+		name := strings.TrimSuffix(file[strings.LastIndex(file, "/")+1:], ".sql")
+		version, err := migrationVersion(name)
+		if err != nil {
+			return nil, err
+		}
+		content, err := postgresMigrations.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("Duplicate migration version %d", migrations[i].version)
+		}
+	}
+	return migrations, nil
+}
+
+// migrationVersion parses the version of a migration named <version>_<description>
+func migrationVersion(name string) (int, error) {
+	prefix, description, found := strings.Cut(name, "_")
+	if !found || description == "" || prefix == "" || strings.Trim(prefix, "0123456789") != "" {
+		return 0, fmt.Errorf("Migration %s is not named <version>_<description>", name)
+	}
+	version, err := strconv.Atoi(prefix)
+	if err != nil || version == 0 {
+		return 0, fmt.Errorf("Migration %s does not start with a positive version number", name)
+	}
+	return version, nil
+}
+
+func applyPostgresMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Held until the transaction ends, so only one instance migrates at a time
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+		return err
+	}
+
+	var applied bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", m.version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, applied_ts) VALUES ($1, $2, $3)",
+		m.version, m.name, time.Now().Unix()); err != nil {
+		return err
+	}
+	log.Printf("Applied PostgreSQL migration %s", m.name)
+	return tx.Commit()
+}
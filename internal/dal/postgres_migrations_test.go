@@ -0,0 +1,52 @@
+package dal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresMigrationsAreContiguous(t *testing.T) {
+	migrations, err := loadPostgresMigrations()
+	require.NoError(t, err)
+	require.Len(t, migrations, 10)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, m.name)
+		assert.NotEmpty(t, m.sql, m.name)
+	}
+	assert.Equal(t, "0001_create_url_mappings", migrations[0].name)
+	assert.Equal(t, "0010_add_dedupe_policy", migrations[9].name)
+}
+
+func TestMigrationVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		valid   bool
+	}{
+		{"0001_create_url_mappings", 1, true},
+		{"0010_add_dedupe_policy", 10, true},
+		{"12_short_version", 12, true},
+		{"create_url_mappings", 0, false},
+		{"0001", 0, false},
+		{"0001_", 0, false},
+		{"_create_url_mappings", 0, false},
+		{"0000_zero", 0, false},
+		{"+001_signed", 0, false},
+		{"-001_negative", 0, false},
+		{"00a1_letters", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := migrationVersion(tt.name)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, version)
+		})
+	}
+}
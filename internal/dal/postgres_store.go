@@ -0,0 +1,360 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// SQLSTATE for unique constraint violations
+	pgUniqueViolation = "23505"
+	// Unique constraint on url_mappings.short_url
+	pgShortUrlConstraint = "url_mappings_short_url_key"
+)
+
+// PostgresUrlStore stores URL mappings in the url_mappings table.
+// The schema is owned by the migrations applied through MigratePostgres.
+type PostgresUrlStore struct {
+	db *sql.DB
+}
+
+func NewPostgresUrlStore(db *sql.DB) UrlStore {
+	return &PostgresUrlStore{db: db}
+}
+
+// uniqueViolation returns the name of the violated unique constraint, if any
+func uniqueViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation {
+		return pqErr.Constraint, true
+	}
+	return "", false
+}
+
+func (ps *PostgresUrlStore) GetUrlMetrics(ctx context.Context, query MetricsQuery, fn func(*UrlMappingEntry) error) error {
+
+	// Keyset pagination. Without a cursor, the keyset condition is skipped through $3
+	order, hitsAfter := "DESC", "<"
+	if query.Asc {
+		order, hitsAfter = "ASC", ">"
+	}
+	stmt := fmt.Sprintf(`SELECT short_url, long_url, hits, created_ts, last_accessed, expires_at, redirect_type, owner, workspace FROM url_mappings
+		WHERE last_accessed >= $1 AND last_accessed < $2 AND workspace = $6
+		AND (NOT $3 OR hits %s $4 OR (hits = $4 AND short_url > $5))
+		ORDER BY hits %s, short_url`, hitsAfter, order)
+	args := []interface{}{query.Start, query.End, query.After != nil, int64(0), "", query.Workspace}
+	if query.After != nil {
+		args[3], args[4] = query.After.Hits, query.After.ShortUrl
+	}
+	if query.Limit > 0 {
+		stmt += " LIMIT $7"
+		args = append(args, query.Limit)
+	}
+
+	log.Printf("Trying to get entries between start=%d and end=%d", query.Start, query.End)
+	rows, err := ps.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		log.Printf("Unable to get metrics for the given dates. Err=%v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		elem := &UrlMappingEntry{}
+		if err := rows.Scan(&elem.ShortUrl, &elem.LongUrl, &elem.Hits, &elem.CreatedTs, &elem.LastAccessed, &elem.ExpiresAt, &elem.RedirectType, &elem.Owner, &elem.Workspace); err != nil {
+			return err
+		}
+		if err := fn(elem); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (ps *PostgresUrlStore) AddUrlEntry(ctx context.Context, entry *UrlMappingEntry) error {
+
+	if entry.DedupeKey != "" {
+		if err := releaseExpiredPgDedupeKey(ctx, ps.db, entry.DedupeKey); err != nil {
+			return err
+		}
+	}
+	// Entries without a dedupe key are NULL, which the unique index leaves out
+	_, err := ps.db.ExecContext(ctx,
+		`INSERT INTO url_mappings (short_url, long_url, hits, created_ts, last_accessed, expires_at, redirect_type, owner, workspace, dedupe_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		entry.ShortUrl, entry.LongUrl, entry.Hits, entry.CreatedTs, entry.LastAccessed, entry.ExpiresAt, entry.RedirectType,
+		entry.Owner, entry.Workspace, sql.NullString{String: entry.DedupeKey, Valid: entry.DedupeKey != ""})
+
+	if constraint, ok := uniqueViolation(err); ok {
+		if constraint == pgShortUrlConstraint {
+			log.Printf("Short URL %s is already mapped", entry.ShortUrl)
+			return ErrShortUrlAlreadyExists
+		}
+		log.Printf("A short URL already exists for %s", entry.LongUrl)
+		return ErrUrlEntryAlreadyExists
+	}
+	if err != nil {
+		log.Printf("Unable to add new URL entry. Err = %v", err)
+		return err
+	}
+	return nil
+}
+
+func (ps *PostgresUrlStore) GetMappedUrl(ctx context.Context, shortUrl string) (string, error) {
+
+	return mappedUrl(ps.GetUrlEntry(ctx, shortUrl))
+}
+
+func (ps *PostgresUrlStore) GetUrlEntry(ctx context.Context, shortUrl string) (*UrlMappingEntry, error) {
+
+	entry := &UrlMappingEntry{}
+	err := ps.db.QueryRowContext(ctx,
+		`SELECT short_url, long_url, hits, created_ts, last_accessed, expires_at, redirect_type, owner, workspace, COALESCE(dedupe_key, '')
+		FROM url_mappings WHERE short_url = $1`, shortUrl).
+		Scan(&entry.ShortUrl, &entry.LongUrl, &entry.Hits, &entry.CreatedTs, &entry.LastAccessed, &entry.ExpiresAt, &entry.RedirectType, &entry.Owner, &entry.Workspace, &entry.DedupeKey)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("No short URL exists for %s", shortUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (ps *PostgresUrlStore) GetUrlEntryByLongUrl(ctx context.Context, workspace, host, longUrl string) (*UrlMappingEntry, error) {
+
+	entry := &UrlMappingEntry{}
+	err := ps.db.QueryRowContext(ctx,
+		`SELECT short_url, long_url, hits, created_ts, last_accessed, expires_at, redirect_type, owner, workspace, dedupe_key
+		FROM url_mappings WHERE dedupe_key = $1`, DedupeKey(workspace, host, longUrl)).
+		Scan(&entry.ShortUrl, &entry.LongUrl, &entry.Hits, &entry.CreatedTs, &entry.LastAccessed, &entry.ExpiresAt, &entry.RedirectType, &entry.Owner, &entry.Workspace, &entry.DedupeKey)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("No short URL exists for %s", longUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (ps *PostgresUrlStore) CheckIfUrlExists(ctx context.Context, url string, isLong bool) bool {
+
+	query := "SELECT EXISTS (SELECT 1 FROM url_mappings WHERE short_url = $1)"
+	if isLong {
+		query = "SELECT EXISTS (SELECT 1 FROM url_mappings WHERE long_url = $1)"
+	}
+
+	var exists bool
+	if err := ps.db.QueryRowContext(ctx, query, url).Scan(&exists); err != nil {
+		log.Printf("Unable to connect to PostgreSQL. Err=%v", err)
+		return false
+	}
+	return exists
+}
+
+func (ps *PostgresUrlStore) DeleteUrlEntry(ctx context.Context, shortUrl string, cond *UrlEntryCondition) error {
+
+	var owner, workspace sql.NullString
+	if cond != nil && cond.Owner != nil {
+		owner = sql.NullString{String: *cond.Owner, Valid: true}
+	}
+	if cond != nil && cond.Workspace != nil {
+		workspace = sql.NullString{String: *cond.Workspace, Valid: true}
+	}
+
+	// url_history rows go along with the mapping through ON DELETE CASCADE
+	result, err := ps.db.ExecContext(ctx,
+		`DELETE FROM url_mappings WHERE short_url = $1
+		AND ($2::text IS NULL OR owner = $2) AND ($3::text IS NULL OR workspace = $3)`,
+		shortUrl, owner, workspace)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 && cond != nil {
+		log.Printf("No short URL matching the condition exists for %s", shortUrl)
+		return ErrUrlEntryNotFound
+	}
+	return nil
+}
+
+func (ps *PostgresUrlStore) UpdateUrlEntry(ctx context.Context, shortUrl string, update *UrlEntryUpdate) (*UrlMappingEntry, error) {
+
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Lock the row so that concurrent updates record their history in order
+	entry := &UrlMappingEntry{}
+	err = tx.QueryRowContext(ctx,
+		`SELECT short_url, long_url, hits, created_ts, last_accessed, expires_at, redirect_type, owner, workspace, COALESCE(dedupe_key, '')
+		FROM url_mappings WHERE short_url = $1 FOR UPDATE`, shortUrl).
+		Scan(&entry.ShortUrl, &entry.LongUrl, &entry.Hits, &entry.CreatedTs, &entry.LastAccessed, &entry.ExpiresAt, &entry.RedirectType, &entry.Owner, &entry.Workspace, &entry.DedupeKey)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("No short URL exists for %s", shortUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !update.allows(entry) {
+		log.Printf("%s no longer matches the condition of the update", shortUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+
+	if update.LongUrl != nil && *update.LongUrl != entry.LongUrl {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO url_history (short_url, long_url, replaced_ts, actor) VALUES ($1, $2, $3, $4)",
+			shortUrl, entry.LongUrl, time.Now().Unix(), update.Actor); err != nil {
+			return nil, err
+		}
+		entry.LongUrl = *update.LongUrl
+		if entry.DedupeKey != "" {
+			entry.DedupeKey = entry.dedupeKeyFor(entry.LongUrl)
+			if err := releaseExpiredPgDedupeKey(ctx, tx, entry.DedupeKey); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if update.ExpiresAt != nil {
+		entry.ExpiresAt = *update.ExpiresAt
+	}
+	if update.RedirectType != nil {
+		entry.RedirectType = *update.RedirectType
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE url_mappings SET long_url = $2, expires_at = $3, redirect_type = $4, dedupe_key = $5 WHERE short_url = $1",
+		shortUrl, entry.LongUrl, entry.ExpiresAt, entry.RedirectType, sql.NullString{String: entry.DedupeKey, Valid: entry.DedupeKey != ""})
+	if _, ok := uniqueViolation(err); ok {
+		log.Printf("A short URL already exists for %s", entry.LongUrl)
+		return nil, ErrUrlEntryAlreadyExists
+	}
+	if err != nil {
+		log.Printf("Unable to update URL entry. Err = %v", err)
+		return nil, err
+	}
+	return entry, tx.Commit()
+}
+
+// releaseExpiredPgDedupeKey takes key away from the entry that holds it if that has
+// expired, so that its long url can be shortened again
+func releaseExpiredPgDedupeKey(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}, key string) error {
+	res, err := db.ExecContext(ctx,
+		"UPDATE url_mappings SET dedupe_key = NULL WHERE dedupe_key = $1 AND expires_at > 0 AND expires_at <= $2",
+		key, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Released the dedupe key of %d expired URL entries", n)
+	}
+	return nil
+}
+
+func (ps *PostgresUrlStore) GetUrlHistory(ctx context.Context, shortUrl string) ([]UrlDestination, error) {
+
+	if !ps.CheckIfUrlExists(ctx, shortUrl, false) {
+		log.Printf("No short URL exists for %s", shortUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+
+	rows, err := ps.db.QueryContext(ctx,
+		"SELECT long_url, replaced_ts, actor FROM url_history WHERE short_url = $1 ORDER BY id", shortUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []UrlDestination
+	for rows.Next() {
+		var dest UrlDestination
+		if err := rows.Scan(&dest.LongUrl, &dest.ReplacedTs, &dest.Actor); err != nil {
+			return nil, err
+		}
+		history = append(history, dest)
+	}
+	return history, rows.Err()
+}
+
+func (ps *PostgresUrlStore) DeleteExpiredUrlEntries(ctx context.Context, before int64) (int64, error) {
+
+	res, err := ps.db.ExecContext(ctx,
+		"DELETE FROM url_mappings WHERE expires_at > 0 AND expires_at < $1", before)
+	if err != nil {
+		log.Printf("Unable to delete expired URL entries. Err = %v", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (ps *PostgresUrlStore) UpdateUrlHitCount(ctx context.Context, shortUrl string) error {
+
+	res, err := ps.db.ExecContext(ctx,
+		"UPDATE url_mappings SET hits = hits + 1, last_accessed = $2 WHERE short_url = $1",
+		shortUrl, time.Now().Unix())
+	if err != nil {
+		log.Printf("Unable to update hit count. Err = %v", err)
+		return err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		log.Printf("No short URL exists for %s", shortUrl)
+		return ErrUrlEntryNotFound
+	}
+	return nil
+}
+
+func (ps *PostgresUrlStore) UpdateUrlHitCounts(ctx context.Context, counts map[string]HitCount) error {
+
+	shortUrls := make([]string, 0, len(counts))
+	hits := make([]int64, 0, len(counts))
+	lastAccessed := make([]int64, 0, len(counts))
+	for shortUrl, count := range counts {
+		shortUrls = append(shortUrls, shortUrl)
+		hits = append(hits, count.Hits)
+		lastAccessed = append(lastAccessed, count.LastAccessed)
+	}
+
+	// One statement for the whole batch
+	_, err := ps.db.ExecContext(ctx,
+		`UPDATE url_mappings AS u
+		SET hits = u.hits + c.hits, last_accessed = GREATEST(u.last_accessed, c.last_accessed)
+		FROM unnest($1::text[], $2::bigint[], $3::bigint[]) AS c (short_url, hits, last_accessed)
+		WHERE u.short_url = c.short_url`,
+		pq.Array(shortUrls), pq.Array(hits), pq.Array(lastAccessed))
+	if err != nil {
+		log.Printf("Unable to update hit counts. Err = %v", err)
+		return err
+	}
+	return nil
+}
+
+func (ps *PostgresUrlStore) CountUrlEntries(ctx context.Context, workspace string) (int64, error) {
+
+	var count int64
+	err := ps.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM url_mappings WHERE workspace = $1", workspace).Scan(&count)
+	return count, err
+}
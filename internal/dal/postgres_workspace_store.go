@@ -0,0 +1,84 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// PostgresWorkspaceStore stores workspaces in the workspaces table
+type PostgresWorkspaceStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWorkspaceStore(db *sql.DB) WorkspaceStore {
+	return &PostgresWorkspaceStore{db: db}
+}
+
+func (ps *PostgresWorkspaceStore) AddWorkspace(ctx context.Context, ws *Workspace) error {
+
+	_, err := ps.db.ExecContext(ctx,
+		`INSERT INTO workspaces (workspace_id, name, short_code_prefix, max_links, dedupe_policy, created_ts)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		ws.Id, ws.Name, ws.ShortCodePrefix, ws.MaxLinks, ws.DedupePolicy, ws.CreatedTs)
+	if _, ok := uniqueViolation(err); ok {
+		return ErrWorkspaceAlreadyExists
+	}
+	if err != nil {
+		log.Printf("Unable to add workspace %s. Err = %v", ws.Id, err)
+		return err
+	}
+	return nil
+}
+
+func (ps *PostgresWorkspaceStore) GetWorkspace(ctx context.Context, id string) (*Workspace, error) {
+
+	ws := &Workspace{}
+	err := ps.db.QueryRowContext(ctx,
+		`SELECT workspace_id, name, short_code_prefix, max_links, dedupe_policy, created_ts FROM workspaces WHERE workspace_id = $1`, id).
+		Scan(&ws.Id, &ws.Name, &ws.ShortCodePrefix, &ws.MaxLinks, &ws.DedupePolicy, &ws.CreatedTs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (ps *PostgresWorkspaceStore) UpdateWorkspace(ctx context.Context, ws *Workspace) error {
+
+	res, err := ps.db.ExecContext(ctx,
+		`UPDATE workspaces SET name = $2, short_code_prefix = $3, max_links = $4, dedupe_policy = $5
+		WHERE workspace_id = $1`,
+		ws.Id, ws.Name, ws.ShortCodePrefix, ws.MaxLinks, ws.DedupePolicy)
+	if err != nil {
+		log.Printf("Unable to update workspace %s. Err = %v", ws.Id, err)
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrWorkspaceNotFound
+	}
+	return nil
+}
+
+func (ps *PostgresWorkspaceStore) ListWorkspaces(ctx context.Context) ([]*Workspace, error) {
+
+	rows, err := ps.db.QueryContext(ctx,
+		`SELECT workspace_id, name, short_code_prefix, max_links, dedupe_policy, created_ts FROM workspaces ORDER BY workspace_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []*Workspace
+	for rows.Next() {
+		ws := &Workspace{}
+		if err := rows.Scan(&ws.Id, &ws.Name, &ws.ShortCodePrefix, &ws.MaxLinks, &ws.DedupePolicy, &ws.CreatedTs); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, ws)
+	}
+	return workspaces, rows.Err()
+}
@@ -2,9 +2,12 @@ package dal
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -18,15 +21,140 @@ type UrlMappingEntry struct {
 	Hits         int64  `bson:"hits" json:"hits"`
 	CreatedTs    int64  `bson:"created_ts" json:"created_ts"`
 	LastAccessed int64  `bson:"last_accessed" json:"last_accessed"`
+	// Unix time from which the short URL stops redirecting. Zero means never
+	ExpiresAt int64 `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	// HTTP status of the redirects, e.g. 301 or 307. Zero means the server default
+	RedirectType int `bson:"redirect_type,omitempty" json:"redirect_type,omitempty"`
+	// Previous destinations of the short URL, oldest first
+	History []UrlDestination `bson:"history,omitempty" json:"history,omitempty"`
+	// Owner of the API key that created the short URL. Empty for links from before API keys
+	Owner string `bson:"owner,omitempty" json:"owner,omitempty"`
+	// Workspace the short URL belongs to
+	Workspace string `bson:"workspace,omitempty" json:"workspace,omitempty"`
+	// DedupeKey of the long url, unique among the entries that have one. Empty for
+	// entries created while duplicates were allowed. It is stored even when empty, as
+	// Mongo documents from before dedupe policies have no dedupe_key at all
+	DedupeKey string `bson:"dedupe_key" json:"-"`
+}
+
+// UrlDestination is a long url that a short url used to point to
+type UrlDestination struct {
+	LongUrl string `bson:"long_url" json:"long_url"`
+	// Unix time at which the short url was retargeted away from LongUrl
+	ReplacedTs int64 `bson:"replaced_ts" json:"replaced_ts"`
+	// Who retargeted the short url
+	Actor string `bson:"actor,omitempty" json:"actor,omitempty"`
+}
+
+// HitCount is the aggregate of several hits on one short url
+type HitCount struct {
+	Hits int64
+	// Unix time of the latest hit
+	LastAccessed int64
+}
+
+// UrlEntryUpdate holds the mutable fields of a URL mapping.
+// Nil fields are left unchanged.
+type UrlEntryUpdate struct {
+	LongUrl      *string
+	ExpiresAt    *int64
+	RedirectType *int
+	// Who makes the change. Recorded in the history when the long url changes
+	Actor string
+	UrlEntryCondition
+}
+
+// UrlEntryCondition pins a change to the entry that an earlier check saw. An entry that
+// no longer belongs to Owner or Workspace is left alone and ErrUrlEntryNotFound is
+// returned, so that the check cannot go stale. Nil fields match every entry.
+type UrlEntryCondition struct {
+	Owner     *string
+	Workspace *string
+}
+
+// allows reports whether the change may be made to entry
+func (c *UrlEntryCondition) allows(entry *UrlMappingEntry) bool {
+	if c == nil {
+		return true
+	}
+	return (c.Owner == nil || *c.Owner == entry.Owner) && (c.Workspace == nil || *c.Workspace == entry.Workspace)
+}
+
+// matchMongoCondition narrows filter down to the entries that cond allows
+func matchMongoCondition(filter bson.M, cond *UrlEntryCondition) {
+	if cond == nil {
+		return
+	}
+	for field, value := range map[string]*string{"owner": cond.Owner, "workspace": cond.Workspace} {
+		if value == nil {
+			continue
+		}
+		filter[field] = *value
+		if *value == "" {
+			// Empty owners and workspaces are not stored at all
+			filter[field] = bson.M{"$in": bson.A{"", nil}}
+		}
+	}
+}
+
+// DedupeKey identifies a long url among the links of a workspace on one domain, so that
+// each custom domain can have its own link to it. host is empty for the default domain.
+// It is a hash, so that unique indexes on it hold for long urls of any length.
+func DedupeKey(workspace, host, longUrl string) string {
+	// Workspace ids cannot contain a '/', so the key is unambiguous
+	sum := sha256.Sum256([]byte(workspace + "/" + dedupeName(host, longUrl)))
+	return hex.EncodeToString(sum[:])
+}
+
+// dedupeName is longUrl as deduplicated on host. Canonical long urls and hosts contain
+// no spaces, so it never equals the name of a long url on another domain.
+func dedupeName(host, longUrl string) string {
+	if host == "" {
+		return longUrl
+	}
+	return host + " " + longUrl
+}
+
+// dedupeKeyFor is the dedupe key that the entry has when it points to longUrl
+func (e *UrlMappingEntry) dedupeKeyFor(longUrl string) string {
+	host, _ := SplitShortKey(e.ShortUrl)
+	return DedupeKey(e.Workspace, host, longUrl)
+}
+
+// IsExpired reports whether the entry has expired at the given unix time
+func (e *UrlMappingEntry) IsExpired(now int64) bool {
+	return e.ExpiresAt > 0 && now >= e.ExpiresAt
 }
 
 type UrlStore interface {
 	AddUrlEntry(ctx context.Context, entry *UrlMappingEntry) error
 	GetMappedUrl(ctx context.Context, shortUrl string) (string, error)
-	DeleteUrlEntry(ctx context.Context, shortUrl string) error
+	GetUrlEntry(ctx context.Context, shortUrl string) (*UrlMappingEntry, error)
+	// GetUrlEntryByLongUrl returns the entry that longUrl is deduplicated to in workspace, on
+	// the custom domain host or the default domain if host is empty. Entries created while
+	// duplicates were allowed are not found. AddUrlEntry and UpdateUrlEntry take the dedupe
+	// key over from an expired entry, so that it does not hold on to its long url.
+	GetUrlEntryByLongUrl(ctx context.Context, workspace, host, longUrl string) (*UrlMappingEntry, error)
+	// DeleteUrlEntry deletes the entry if cond allows it. Deleting a missing entry is not
+	// an error, unless there is a cond to match.
+	DeleteUrlEntry(ctx context.Context, shortUrl string, cond *UrlEntryCondition) error
 	CheckIfUrlExists(ctx context.Context, url string, isLong bool) bool
 	UpdateUrlHitCount(ctx context.Context, shortUrl string) error
-	GetUrlMetrics(ctx context.Context, start, end int64, asc bool) ([]*UrlMappingEntry, error)
+	// UpdateUrlHitCounts adds aggregated hits to many short urls at once.
+	// Short urls that no longer exist are skipped.
+	UpdateUrlHitCounts(ctx context.Context, counts map[string]HitCount) error
+	// GetUrlMetrics streams the entries selected by query to fn, in query order.
+	// It stops at the first error returned by fn and returns that error.
+	GetUrlMetrics(ctx context.Context, query MetricsQuery, fn func(*UrlMappingEntry) error) error
+	// UpdateUrlEntry atomically applies update and returns the updated entry.
+	// A changed long url is appended to the history of the entry.
+	UpdateUrlEntry(ctx context.Context, shortUrl string, update *UrlEntryUpdate) (*UrlMappingEntry, error)
+	// GetUrlHistory returns the previous destinations of a short url, oldest first
+	GetUrlHistory(ctx context.Context, shortUrl string) ([]UrlDestination, error)
+	// DeleteExpiredUrlEntries purges entries that expired before the given unix time
+	DeleteExpiredUrlEntries(ctx context.Context, before int64) (int64, error)
+	// CountUrlEntries returns how many entries a workspace has
+	CountUrlEntries(ctx context.Context, workspace string) (int64, error)
 }
 
 type MongoUrlStore struct {
@@ -39,74 +167,176 @@ type UrlStoreOption func(store *MongoUrlStore)
 
 var (
 	ErrUrlEntryAlreadyExists = errors.New("A URL entry already exists")
+	ErrShortUrlAlreadyExists = errors.New("The short URL is already taken")
 	ErrUrlEntryNotFound      = errors.New("URL does not exist")
+	ErrUrlEntryExpired       = errors.New("URL has expired")
 )
 
+// mappedUrl returns the long url of an entry fetched by GetUrlEntry.
+// Expired entries are reported as ErrUrlEntryExpired.
+func mappedUrl(entry *UrlMappingEntry, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if entry.IsExpired(time.Now().Unix()) {
+		return "", ErrUrlEntryExpired
+	}
+	return entry.LongUrl, nil
+}
+
 func New(opts ...UrlStoreOption) UrlStore {
 	store := &MongoUrlStore{}
 	for _, opt := range opts {
 		opt(store)
 	}
-	store.collection = fmt.Sprintf("%s.%s", store.name, store.collection)
 	return store
 }
 
-func (ms *MongoUrlStore) GetUrlMetrics(ctx context.Context, start, end int64, asc bool) ([]*UrlMappingEntry, error) {
+// mongoUrlDoc is how a UrlMappingEntry is stored in MongoDB. ExpiresOn is ExpiresAt
+// as a date, as TTL indexes only work on dates.
+type mongoUrlDoc struct {
+	UrlMappingEntry `bson:",inline"`
+	ExpiresOn       *time.Time `bson:"expires_on,omitempty"`
+}
+
+func newMongoUrlDoc(entry *UrlMappingEntry) *mongoUrlDoc {
+	doc := &mongoUrlDoc{UrlMappingEntry: *entry}
+	if entry.ExpiresAt > 0 {
+		expiresOn := time.Unix(entry.ExpiresAt, 0)
+		doc.ExpiresOn = &expiresOn
+	}
+	return doc
+}
+
+func (ms *MongoUrlStore) GetUrlMetrics(ctx context.Context, query MetricsQuery, fn func(*UrlMappingEntry) error) error {
 	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
 	// Specify the Sort option to sort the returned documents by hit count in
-	// ascending  or descending order.
+	// ascending  or descending order. The short url breaks ties, so that pages never overlap
 
-	sortOrder := -1
-	if asc {
-		sortOrder = 1
+	sortOrder, hitsAfter := -1, "$lt"
+	if query.Asc {
+		sortOrder, hitsAfter = 1, "$gt"
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "hits", Value: sortOrder}, {Key: "short_url", Value: 1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
 	}
-	opts := options.Find().SetSort(bson.D{{"hits", sortOrder}})
 
 	filter := bson.M{
+		"workspace": workspaceFilter(query.Workspace),
 		"last_accessed": bson.M{
-			"$gte": start,
-			"$lt":  end,
+			"$gte": query.Start,
+			"$lt":  query.End,
 		},
 	}
-	log.Printf("Trying to get entries between start=%d and end=%d", start, end)
+	if query.After != nil {
+		filter["$or"] = bson.A{
+			bson.M{"hits": bson.M{hitsAfter: query.After.Hits}},
+			bson.M{"hits": query.After.Hits, "short_url": bson.M{"$gt": query.After.ShortUrl}},
+		}
+	}
+	log.Printf("Trying to get entries between start=%d and end=%d", query.Start, query.End)
 	cursor, err := urlTbl.Find(ctx, filter, opts)
 
 	if err != nil {
 		log.Printf("Unable to get metrics for the given dates. Err=%v", err)
-		return nil, err
+		return err
 	}
+	// Close the cursor once finished
+	defer func() { _ = cursor.Close(ctx) }()
 
-	var results []*UrlMappingEntry
-	// Get a list of all returned Urls and print them out in the required order.
+	// Hand out the documents one at a time instead of loading all of them
 	for cursor.Next(ctx) {
 		// Create a value into which the single document can be decoded
 		elem := &UrlMappingEntry{}
-		err := cursor.Decode(elem)
-		if err != nil {
-			log.Fatal(err)
+		if err := cursor.Decode(elem); err != nil {
+			log.Printf("Unable to decode URL entry. Err=%v", err)
+			return err
+		}
+		if err := fn(elem); err != nil {
+			return err
 		}
+	}
+	return cursor.Err()
+}
 
-		results = append(results, elem)
+// workspaceFilter matches the entries of a workspace. The field is omitted for the default workspace
+func workspaceFilter(workspace string) interface{} {
+	if workspace == DefaultWorkspace {
+		return bson.M{"$in": bson.A{nil, DefaultWorkspace}}
+	}
+	return workspace
+}
 
+// dedupeFilter matches the entry that longUrl is deduplicated to in workspace on host.
+// Documents from before dedupe policies have no dedupe_key and are matched by their long url.
+// They are all on the default domain, which came before custom domains.
+func dedupeFilter(workspace, host, longUrl string) bson.M {
+	key := bson.M{"dedupe_key": DedupeKey(workspace, host, longUrl)}
+	if host != "" {
+		return key
 	}
+	return bson.M{"$or": bson.A{
+		key,
+		bson.M{
+			"dedupe_key": bson.M{"$exists": false},
+			"long_url":   longUrl,
+			"workspace":  workspaceFilter(workspace),
+		},
+	}}
+}
 
-	if err := cursor.Err(); err != nil {
-		log.Fatal(err)
+// releaseExpiredMongoDedupeKey takes the dedupe key away from the entry that matches filter
+// if it has expired, so that the long url can be shortened again
+func releaseExpiredMongoDedupeKey(ctx context.Context, urlTbl *mongo.Collection, filter bson.M) error {
+	expired := bson.M{"expires_at": bson.M{"$gt": 0, "$lte": time.Now().Unix()}}
+	res, err := urlTbl.UpdateMany(ctx, bson.M{"$and": bson.A{filter, expired}}, bson.M{"$set": bson.M{"dedupe_key": ""}})
+	if err != nil {
+		return err
 	}
+	if res.ModifiedCount > 0 {
+		log.Printf("Released the dedupe key of %d expired URL entries", res.ModifiedCount)
+	}
+	return nil
+}
 
-	// Close the cursor once finished
-	_ = cursor.Close(ctx)
-	return results, nil
+// duplicateKeyError names the unique index that a failed write ran into
+func duplicateKeyError(err error, shortUrl, longUrl string) error {
+	if strings.Contains(err.Error(), "dedupe_key") {
+		log.Printf("A short URL already exists for %s", longUrl)
+		return ErrUrlEntryAlreadyExists
+	}
+	log.Printf("Short URL %s is already mapped", shortUrl)
+	return ErrShortUrlAlreadyExists
 }
 
 func (ms *MongoUrlStore) AddUrlEntry(ctx context.Context, entry *UrlMappingEntry) error {
+	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
 
-	if ms.CheckIfUrlExists(ctx, entry.LongUrl, true) {
-		log.Printf("A short URL already exists for %s", entry.LongUrl)
-		return fmt.Errorf("A short URL already exists for %s.", entry.LongUrl)
+	// The unique indexes have the final say. These checks spare the insert in the common case
+	if entry.DedupeKey != "" {
+		host, _ := SplitShortKey(entry.ShortUrl)
+		filter := dedupeFilter(entry.Workspace, host, entry.LongUrl)
+		if err := releaseExpiredMongoDedupeKey(ctx, urlTbl, filter); err != nil {
+			return err
+		}
+		err := urlTbl.FindOne(ctx, filter).Err()
+		if err == nil {
+			log.Printf("A short URL already exists for %s", entry.LongUrl)
+			return ErrUrlEntryAlreadyExists
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+	if ms.CheckIfUrlExists(ctx, entry.ShortUrl, false) {
+		log.Printf("Short URL %s is already mapped", entry.ShortUrl)
+		return ErrShortUrlAlreadyExists
+	}
+	insertResult, err := urlTbl.InsertOne(ctx, newMongoUrlDoc(entry))
+	if mongo.IsDuplicateKeyError(err) {
+		return duplicateKeyError(err, entry.ShortUrl, entry.LongUrl)
 	}
-	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
-	insertResult, err := urlTbl.InsertOne(ctx, *entry)
 	if err != nil {
 		log.Printf("Unable to add new URL entry. Err = %v", err)
 		return err
@@ -117,21 +347,42 @@ func (ms *MongoUrlStore) AddUrlEntry(ctx context.Context, entry *UrlMappingEntry
 
 func (ms *MongoUrlStore) GetMappedUrl(ctx context.Context, shortUrl string) (string, error) {
 
-	if !ms.CheckIfUrlExists(ctx, shortUrl, false) {
-		log.Printf("No short URL exists for %s", shortUrl)
-		return "", ErrUrlEntryNotFound
-	}
+	return mappedUrl(ms.GetUrlEntry(ctx, shortUrl))
+}
+
+func (ms *MongoUrlStore) GetUrlEntry(ctx context.Context, shortUrl string) (*UrlMappingEntry, error) {
+
 	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
 	var result UrlMappingEntry
-	err := urlTbl.FindOne(ctx, bson.D{{"short_url", shortUrl}}).Decode(&result)
+	err := urlTbl.FindOne(ctx, bson.D{{Key: "short_url", Value: shortUrl}}).Decode(&result)
 
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("No short URL exists for %s", shortUrl)
+		return nil, ErrUrlEntryNotFound
+	}
 	if err != nil {
-		return "", fmt.Errorf("Unable to fetch original url for %s", shortUrl)
+		return nil, fmt.Errorf("Unable to fetch original url for %s", shortUrl)
 	}
 
 	log.Printf("Found an existing entry for %s. Entry=%+v", shortUrl, result)
 
-	return result.LongUrl, nil
+	return &result, nil
+}
+
+func (ms *MongoUrlStore) GetUrlEntryByLongUrl(ctx context.Context, workspace, host, longUrl string) (*UrlMappingEntry, error) {
+
+	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
+	var result UrlMappingEntry
+	err := urlTbl.FindOne(ctx, dedupeFilter(workspace, host, longUrl)).Decode(&result)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("No short URL exists for %s", longUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
 func (ms *MongoUrlStore) CheckIfUrlExists(ctx context.Context, url string, isLong bool) bool {
@@ -139,7 +390,7 @@ func (ms *MongoUrlStore) CheckIfUrlExists(ctx context.Context, url string, isLon
 	var result bson.M
 
 	if isLong {
-		err := urlTbl.FindOne(ctx, bson.D{{"long_url", url}}).Decode(&result)
+		err := urlTbl.FindOne(ctx, bson.D{{Key: "long_url", Value: url}}).Decode(&result)
 
 		if err != nil {
 
@@ -149,7 +400,7 @@ func (ms *MongoUrlStore) CheckIfUrlExists(ctx context.Context, url string, isLon
 		}
 
 	} else {
-		err := urlTbl.FindOne(ctx, bson.D{{"short_url", url}}).Decode(&result)
+		err := urlTbl.FindOne(ctx, bson.D{{Key: "short_url", Value: url}}).Decode(&result)
 
 		if err != nil {
 
@@ -163,36 +414,177 @@ func (ms *MongoUrlStore) CheckIfUrlExists(ctx context.Context, url string, isLon
 	return true
 }
 
-func (ms *MongoUrlStore) DeleteUrlEntry(ctx context.Context, shortUrl string) error {
+func (ms *MongoUrlStore) DeleteUrlEntry(ctx context.Context, shortUrl string, cond *UrlEntryCondition) error {
 	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
-	_, err := urlTbl.DeleteOne(ctx, bson.M{"short_url": shortUrl})
+	filter := bson.M{"short_url": shortUrl}
+	matchMongoCondition(filter, cond)
+	result, err := urlTbl.DeleteOne(ctx, filter)
 
 	if err != nil {
 		return err
 	}
+	if result.DeletedCount == 0 && cond != nil {
+		log.Printf("No short URL matching the condition exists for %s", shortUrl)
+		return ErrUrlEntryNotFound
+	}
 
 	return nil
 }
 
+func (ms *MongoUrlStore) UpdateUrlEntry(ctx context.Context, shortUrl string, update *UrlEntryUpdate) (*UrlMappingEntry, error) {
+	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
+
+	set := bson.M{}
+	if update.LongUrl != nil {
+		raw, err := urlTbl.FindOne(ctx, bson.M{"short_url": shortUrl}).DecodeBytes()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("No short URL exists for %s", shortUrl)
+			return nil, ErrUrlEntryNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		var current UrlMappingEntry
+		if err := bson.Unmarshal(raw, &current); err != nil {
+			return nil, err
+		}
+
+		// Entries without a dedupe_key are from before dedupe policies, when every long url was deduplicated
+		_, noKey := raw.LookupErr("dedupe_key")
+		if noKey != nil || current.DedupeKey != "" {
+			// Another deduplicated entry must not map to the new long url
+			host, _ := SplitShortKey(shortUrl)
+			filter := bson.M{
+				"$and": bson.A{dedupeFilter(current.Workspace, host, *update.LongUrl), bson.M{"short_url": bson.M{"$ne": shortUrl}}},
+			}
+			if err := releaseExpiredMongoDedupeKey(ctx, urlTbl, filter); err != nil {
+				return nil, err
+			}
+			err = urlTbl.FindOne(ctx, filter).Err()
+			if err == nil {
+				log.Printf("A short URL already exists for %s", *update.LongUrl)
+				return nil, ErrUrlEntryAlreadyExists
+			}
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, err
+			}
+			set["dedupe_key"] = bson.M{"$literal": current.dedupeKeyFor(*update.LongUrl)}
+		}
+
+		// The pipeline sees the document as it was before this update, so "$long_url"
+		// is the previous destination. It is only recorded when it actually changes
+		longUrl := bson.M{"$literal": *update.LongUrl}
+		history := bson.M{"$ifNull": bson.A{"$history", bson.A{}}}
+		set["history"] = bson.M{"$cond": bson.A{
+			bson.M{"$ne": bson.A{"$long_url", longUrl}},
+			bson.M{"$concatArrays": bson.A{history, bson.A{bson.M{
+				"long_url":    "$long_url",
+				"replaced_ts": time.Now().Unix(),
+				"actor":       bson.M{"$literal": update.Actor},
+			}}}},
+			history,
+		}}
+		set["long_url"] = longUrl
+	}
+	if update.ExpiresAt != nil {
+		set["expires_at"] = bson.M{"$literal": *update.ExpiresAt}
+		set["expires_on"] = "$$REMOVE"
+		if *update.ExpiresAt > 0 {
+			set["expires_on"] = bson.M{"$literal": time.Unix(*update.ExpiresAt, 0)}
+		}
+	}
+	if update.RedirectType != nil {
+		set["redirect_type"] = bson.M{"$literal": *update.RedirectType}
+	}
+
+	filter := bson.M{"short_url": shortUrl}
+	matchMongoCondition(filter, &update.UrlEntryCondition)
+
+	var result UrlMappingEntry
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := urlTbl.FindOneAndUpdate(ctx, filter,
+		mongo.Pipeline{{{Key: "$set", Value: set}}}, opts).Decode(&result)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("No short URL exists for %s", shortUrl)
+		return nil, ErrUrlEntryNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrUrlEntryAlreadyExists
+	}
+	if err != nil {
+		log.Printf("Unable to update URL entry. Err = %v", err)
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (ms *MongoUrlStore) GetUrlHistory(ctx context.Context, shortUrl string) ([]UrlDestination, error) {
+
+	entry, err := ms.GetUrlEntry(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
+	return entry.History, nil
+}
+
+func (ms *MongoUrlStore) DeleteExpiredUrlEntries(ctx context.Context, before int64) (int64, error) {
+	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
+	res, err := urlTbl.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$gt": 0, "$lt": before}})
+
+	if err != nil {
+		log.Printf("Unable to delete expired URL entries. Err = %v", err)
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
 func (ms *MongoUrlStore) UpdateUrlHitCount(ctx context.Context, shortUrl string) error {
-	if !ms.CheckIfUrlExists(ctx, shortUrl, false) {
+	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
+
+	// A single atomic update, so that concurrent redirects never lose an increment
+	filter := bson.M{"short_url": shortUrl}
+	update := bson.M{
+		"$inc": bson.M{"hits": 1},
+		"$set": bson.M{"last_accessed": time.Now().Unix()},
+	}
+	updResult, err := urlTbl.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Printf("Unable to update hit count. Err = %v", err)
+		return err
+	}
+	if updResult.MatchedCount == 0 {
 		log.Printf("No short URL exists for %s", shortUrl)
 		return ErrUrlEntryNotFound
 	}
+
+	return nil
+}
+
+func (ms *MongoUrlStore) UpdateUrlHitCounts(ctx context.Context, counts map[string]HitCount) error {
 	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
-	var result UrlMappingEntry
-	_ = urlTbl.FindOne(ctx, bson.D{{"short_url", shortUrl}}).Decode(&result)
 
-	replacement := result
-	replacement.Hits += 1
-	replacement.LastAccessed = time.Now().Unix()
-	filter := bson.M{"short_url": result.ShortUrl}
-	updResult, err := urlTbl.ReplaceOne(ctx, filter, &replacement)
+	models := make([]mongo.WriteModel, 0, len(counts))
+	for shortUrl, count := range counts {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"short_url": shortUrl}).
+			SetUpdate(bson.M{
+				"$inc": bson.M{"hits": count.Hits},
+				"$max": bson.M{"last_accessed": count.LastAccessed},
+			}))
+	}
+
+	// Unordered, so that one failing update does not hold back the others
+	res, err := urlTbl.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
 	if err != nil {
-		log.Printf("Unable to add new URL entry. Err = %v", err)
+		log.Printf("Unable to update hit counts. Err = %v", err)
 		return err
 	}
-	log.Printf("Successfully updated document %+v", updResult)
-
+	log.Printf("Updated hit counts of %d short URLs", res.ModifiedCount)
 	return nil
 }
+
+func (ms *MongoUrlStore) CountUrlEntries(ctx context.Context, workspace string) (int64, error) {
+	urlTbl := ms.c.Database(ms.name).Collection(ms.collection)
+	return urlTbl.CountDocuments(ctx, bson.M{"workspace": workspaceFilter(workspace)})
+}
@@ -16,6 +16,6 @@ func WithDatabase(db string) UrlStoreOption {
 
 func WithTable(tbl string) UrlStoreOption {
 	return func(store *MongoUrlStore) {
-		store.name = tbl
+		store.collection = tbl
 	}
 }
@@ -0,0 +1,148 @@
+package dal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestStores opens the memory and bolt stores, and those of the databases configured
+// for the integration tests, see url_store_integration_test.go
+func openTestStores(t *testing.T) map[string]UrlStore {
+	t.Helper()
+
+	db, err := OpenBolt(filepath.Join(t.TempDir(), "gately.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	stores := openDatabaseStores(t)
+	stores["memory"] = NewMemoryUrlStore()
+	stores["bolt"] = NewBoltUrlStore(db)
+	return stores
+}
+
+func TestUpdateUrlHitCountConcurrently(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range openTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			shortUrl := fmt.Sprintf("hits-%d", time.Now().UnixNano())
+			require.NoError(t, store.AddUrlEntry(ctx, &UrlMappingEntry{
+				ShortUrl:  shortUrl,
+				LongUrl:   "https://example.com/" + shortUrl,
+				Hits:      1,
+				CreatedTs: time.Now().Unix(),
+				DedupeKey: DedupeKey(DefaultWorkspace, "", "https://example.com/"+shortUrl),
+			}))
+			t.Cleanup(func() { _ = store.DeleteUrlEntry(ctx, shortUrl, nil) })
+
+			const workers, hits = 16, 50
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < hits; i++ {
+						assert.NoError(t, store.UpdateUrlHitCount(ctx, shortUrl))
+					}
+				}()
+			}
+			wg.Wait()
+
+			entry, err := store.GetUrlEntry(ctx, shortUrl)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1+workers*hits), entry.Hits, "hits were lost")
+		})
+	}
+}
+
+func TestExpiredEntriesReleaseTheirLongUrl(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range openTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			longUrl := fmt.Sprintf("https://example.com/dedupe-%d", time.Now().UnixNano())
+			add := func(shortUrl string, expiresAt int64) error {
+				host, _ := SplitShortKey(shortUrl)
+				err := store.AddUrlEntry(ctx, &UrlMappingEntry{
+					ShortUrl:  shortUrl,
+					LongUrl:   longUrl,
+					CreatedTs: time.Now().Unix(),
+					ExpiresAt: expiresAt,
+					DedupeKey: DedupeKey(DefaultWorkspace, host, longUrl),
+				})
+				if err == nil {
+					t.Cleanup(func() { _ = store.DeleteUrlEntry(ctx, shortUrl, nil) })
+				}
+				return err
+			}
+			code := fmt.Sprintf("dedupe-%d", time.Now().UnixNano())
+
+			require.NoError(t, add(code+"-a", time.Now().Unix()+3600))
+			assert.ErrorIs(t, add(code+"-b", 0), ErrUrlEntryAlreadyExists)
+			// Custom domains deduplicate on their own
+			require.NoError(t, add(ShortKey("go.acme.com", code), 0))
+
+			expired := time.Now().Unix() - 1
+			_, err := store.UpdateUrlEntry(ctx, code+"-a", &UrlEntryUpdate{ExpiresAt: &expired})
+			require.NoError(t, err)
+			require.NoError(t, add(code+"-b", 0))
+
+			entry, err := store.GetUrlEntryByLongUrl(ctx, DefaultWorkspace, "", longUrl)
+			require.NoError(t, err)
+			assert.Equal(t, code+"-b", entry.ShortUrl)
+			entry, err = store.GetUrlEntryByLongUrl(ctx, DefaultWorkspace, "go.acme.com", longUrl)
+			require.NoError(t, err)
+			assert.Equal(t, ShortKey("go.acme.com", code), entry.ShortUrl)
+		})
+	}
+}
+
+func TestCountUrlEntries(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range openTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// Workspaces of their own, so that earlier runs against the same database do not count
+			teamA := fmt.Sprintf("team-a-%d", time.Now().UnixNano())
+			teamB := fmt.Sprintf("team-b-%d", time.Now().UnixNano())
+			add := func(workspace, shortUrl string, expiresAt int64) {
+				longUrl := "https://example.com/" + shortUrl
+				require.NoError(t, store.AddUrlEntry(ctx, &UrlMappingEntry{
+					ShortUrl:  shortUrl,
+					LongUrl:   longUrl,
+					CreatedTs: time.Now().Unix(),
+					ExpiresAt: expiresAt,
+					Workspace: workspace,
+					DedupeKey: DedupeKey(workspace, "", longUrl),
+				}))
+				t.Cleanup(func() { _ = store.DeleteUrlEntry(ctx, shortUrl, nil) })
+			}
+			add(teamA, teamA+"-1", 0)
+			add(teamA, teamA+"-2", 0)
+			add(teamA, teamA+"-3", 1)
+			add(teamB, teamB+"-1", 0)
+
+			count, err := store.CountUrlEntries(ctx, teamA)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), count)
+
+			require.NoError(t, store.DeleteUrlEntry(ctx, teamA+"-1", nil))
+			_, err = store.DeleteExpiredUrlEntries(ctx, 2)
+			require.NoError(t, err)
+			count, err = store.CountUrlEntries(ctx, teamA)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), count)
+
+			count, err = store.CountUrlEntries(ctx, teamB)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), count)
+		})
+	}
+}
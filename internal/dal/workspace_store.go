@@ -0,0 +1,148 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection that holds workspaces, next to the URL mappings
+const workspaceCollection = "workspaces"
+
+// DefaultWorkspace holds the links created without a workspace,
+// e.g. before workspaces existed or with authentication disabled
+const DefaultWorkspace = ""
+
+// DedupePolicy decides what happens when a long url is shortened again within a workspace
+type DedupePolicy string
+
+const (
+	// The second request fails, as the long url is already mapped
+	DedupeReject DedupePolicy = "reject"
+	// The second request gets the existing mapping back
+	DedupeReturnExisting DedupePolicy = "return-existing"
+	// Every request gets its own short url, e.g. one per campaign
+	DedupeAllowDuplicates DedupePolicy = "allow-duplicates"
+)
+
+// Valid reports whether p is one of the known policies
+func (p DedupePolicy) Valid() bool {
+	switch p {
+	case DedupeReject, DedupeReturnExisting, DedupeAllowDuplicates:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrWorkspaceNotFound      = errors.New("Workspace does not exist")
+	ErrWorkspaceAlreadyExists = errors.New("The workspace already exists")
+)
+
+// Workspace is a namespace of links shared by a team.
+// Metrics and quotas are per workspace, and long urls are deduplicated within it.
+type Workspace struct {
+	Id   string `bson:"workspace_id" json:"id"`
+	Name string `bson:"name,omitempty" json:"name,omitempty"`
+	// Prepended to every short code created in the workspace, e.g. "acme-"
+	ShortCodePrefix string `bson:"short_code_prefix,omitempty" json:"short_code_prefix,omitempty"`
+	// Most links the workspace may have. Zero means no limit
+	MaxLinks int64 `bson:"max_links,omitempty" json:"max_links,omitempty"`
+	// How long urls that are shortened again are handled. Empty means the server default
+	DedupePolicy DedupePolicy `bson:"dedupe_policy,omitempty" json:"dedupe_policy,omitempty"`
+	CreatedTs    int64        `bson:"created_ts" json:"created_ts"`
+}
+
+type WorkspaceStore interface {
+	AddWorkspace(ctx context.Context, ws *Workspace) error
+	GetWorkspace(ctx context.Context, id string) (*Workspace, error)
+	ListWorkspaces(ctx context.Context) ([]*Workspace, error)
+	// UpdateWorkspace replaces the settings of an existing workspace
+	UpdateWorkspace(ctx context.Context, ws *Workspace) error
+}
+
+// sortWorkspaces orders workspaces by id
+func sortWorkspaces(workspaces []*Workspace) {
+	sort.Slice(workspaces, func(i, j int) bool {
+		return workspaces[i].Id < workspaces[j].Id
+	})
+}
+
+type MongoWorkspaceStore struct {
+	c    *mongo.Client
+	name string
+}
+
+func NewMongoWorkspaceStore(c *mongo.Client, db string) WorkspaceStore {
+	return &MongoWorkspaceStore{c: c, name: db}
+}
+
+func (ms *MongoWorkspaceStore) AddWorkspace(ctx context.Context, ws *Workspace) error {
+	wsTbl := ms.c.Database(ms.name).Collection(workspaceCollection)
+
+	// Upsert only if missing. Of two concurrent creates, both may try to insert,
+	// and the unique index on workspace_id fails the second one
+	res, err := wsTbl.UpdateOne(ctx, bson.M{"workspace_id": ws.Id},
+		bson.M{"$setOnInsert": ws}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrWorkspaceAlreadyExists
+	}
+	if err != nil {
+		log.Printf("Unable to add workspace %s. Err = %v", ws.Id, err)
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return ErrWorkspaceAlreadyExists
+	}
+	return nil
+}
+
+func (ms *MongoWorkspaceStore) GetWorkspace(ctx context.Context, id string) (*Workspace, error) {
+	wsTbl := ms.c.Database(ms.name).Collection(workspaceCollection)
+
+	var ws Workspace
+	err := wsTbl.FindOne(ctx, bson.M{"workspace_id": id}).Decode(&ws)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+func (ms *MongoWorkspaceStore) UpdateWorkspace(ctx context.Context, ws *Workspace) error {
+	wsTbl := ms.c.Database(ms.name).Collection(workspaceCollection)
+
+	res, err := wsTbl.ReplaceOne(ctx, bson.M{"workspace_id": ws.Id}, ws)
+	if err != nil {
+		log.Printf("Unable to update workspace %s. Err = %v", ws.Id, err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrWorkspaceNotFound
+	}
+	return nil
+}
+
+func (ms *MongoWorkspaceStore) ListWorkspaces(ctx context.Context) ([]*Workspace, error) {
+	wsTbl := ms.c.Database(ms.name).Collection(workspaceCollection)
+
+	cursor, err := wsTbl.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var workspaces []*Workspace
+	if err := cursor.All(ctx, &workspaces); err != nil {
+		return nil, err
+	}
+	sortWorkspaces(workspaces)
+	return workspaces, nil
+}
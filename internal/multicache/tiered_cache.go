@@ -1,6 +1,7 @@
 package multicache
 
 import (
+	"log"
 	"time"
 
 	"gately/internal/config"
@@ -10,7 +11,29 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
-func New(cfg config.AppConfig) *cache.ChainCache[string] {
+// EntryTTL bounds how long an entry is kept in either tier. Other instances do not hear of
+// updates and deletes, so it is also how long they may serve a stale entry.
+const EntryTTL = 5 * time.Second
+
+// NewRedisClient connects to the Redis tier configured in cfg.
+// It returns nil when no Redis host is configured.
+func NewRedisClient(cfg config.AppConfig) *redis.Client {
+	if cfg.RedisHost == "" {
+		return nil
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisHost, // host:port of the redis server
+		Password: cfg.RedisPass, // no password set for demo purposes
+		DB:       0,             // use default DB
+	})
+}
+
+// New builds the tiered cache. Without a Redis client only the in-memory layer is used
+func New(redisClient *redis.Client) *cache.ChainCache[string] {
+	return newChain(redisClient, EntryTTL)
+}
+
+func newChain(redisClient *redis.Client, ttl time.Duration) *cache.ChainCache[string] {
 	// Ristretto is our in-memory Layer-1 LRU multicache
 	// The least frequently accessed sites will be evicted first
 	lruCache, err := ristretto.NewCache(
@@ -25,15 +48,17 @@ func New(cfg config.AppConfig) *cache.ChainCache[string] {
 		panic(err)
 	}
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisHost, // host:port of the redis server
-		Password: cfg.RedisPass, // no password set for demo purposes
-		DB:       0,             // use default DB
-	})
+	ristrettoStore := store.NewRistretto(lruCache, store.WithExpiration(ttl))
+
+	if redisClient == nil {
+		// No Redis configured (e.g. embedded mode). Run with the in-memory layer only
+		log.Printf("No Redis host configured. Using the in-memory cache only")
+		return cache.NewChain[string](
+			cache.New[string](ristrettoStore),
+		)
+	}
 
-	// Initialize stores
-	ristrettoStore := store.NewRistretto(lruCache)
-	redisStore := store.NewRedis(redisClient, store.WithExpiration(5*time.Second))
+	redisStore := store.NewRedis(redisClient, store.WithExpiration(ttl))
 
 	// Initialize our tiered multicache
 	cacheManager := cache.NewChain[string](
@@ -0,0 +1,26 @@
+package multicache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryEntriesExpire(t *testing.T) {
+	ctx := context.Background()
+	chain := newChain(nil, 50*time.Millisecond)
+
+	require.NoError(t, chain.Set(ctx, "abc", "https://example.com"))
+	// Ristretto stores asynchronously
+	require.Eventually(t, func() bool {
+		_, err := chain.Get(ctx, "abc")
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		_, err := chain.Get(ctx, "abc")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+}
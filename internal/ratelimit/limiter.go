@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Requests per Window. A zero limit allows everything
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Enabled reports whether l limits anything at all
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Window > 0
+}
+
+// Result is the decision on one request, with what the RateLimit-* headers report
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Requests left in the current window
+	Remaining int
+	// Until the current window ends
+	Reset time.Duration
+	// How long a rejected client should wait. Zero when allowed
+	RetryAfter time.Duration
+}
+
+// Limiter counts requests per key with a sliding window. The count of the previous
+// window is weighted by how much of it still overlaps the sliding window, which
+// smooths out the bursts at window boundaries that fixed windows allow.
+type Limiter interface {
+	// Allow decides whether one more request for key is within limit, and counts it if so.
+	// Rejected requests are not counted, so that clients which keep retrying get through
+	// once the window has moved on.
+	Allow(ctx context.Context, key string, limit Limit) (*Result, error)
+}
+
+// decide evaluates the window counts. current already includes the request being decided.
+// elapsed is how far into the current window the request arrived.
+func decide(limit Limit, previous, current int64, elapsed time.Duration) *Result {
+	window := float64(limit.Window)
+	weight := 1 - float64(elapsed)/window
+	count := float64(previous)*weight + float64(current)
+
+	res := &Result{
+		Allowed: count <= float64(limit.Requests),
+		Limit:   limit.Requests,
+		Reset:   limit.Window - elapsed,
+	}
+	if res.Allowed {
+		res.Remaining = int(math.Floor(float64(limit.Requests) - count))
+		return res
+	}
+
+	// Wait until enough of the previous window has slid out, or for the next window
+	// when the current one alone is over the limit
+	res.RetryAfter = res.Reset
+	if previous > 0 && current < int64(limit.Requests) {
+		free := float64(int64(limit.Requests)-current) / float64(previous)
+		res.RetryAfter = time.Duration(window*(1-free)) - elapsed
+	}
+	if res.RetryAfter < time.Second {
+		res.RetryAfter = time.Second
+	}
+	return res
+}
+
+// windowOf returns the index of the window that now falls into and how far into it now is
+func windowOf(now time.Time, window time.Duration) (int64, time.Duration) {
+	nanos := now.UnixNano()
+	return nanos / int64(window), time.Duration(nanos % int64(window))
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecide(t *testing.T) {
+	limit := Limit{Requests: 10, Window: time.Minute}
+
+	tests := []struct {
+		name              string
+		previous, current int64
+		elapsed           time.Duration
+		expected          Result
+	}{
+		{
+			name: "first request", current: 1,
+			expected: Result{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Minute},
+		},
+		{
+			name: "last allowed request", current: 10, elapsed: 15 * time.Second,
+			expected: Result{Allowed: true, Limit: 10, Remaining: 0, Reset: 45 * time.Second},
+		},
+		{
+			// Only the next window helps when the current one alone is over the limit
+			name: "over the limit", current: 11, elapsed: 15 * time.Second,
+			expected: Result{Limit: 10, Reset: 45 * time.Second, RetryAfter: 45 * time.Second},
+		},
+		{
+			// Half of the previous window still overlaps: 10*0.5 + 1
+			name: "weighted previous window", previous: 10, current: 1, elapsed: 30 * time.Second,
+			expected: Result{Allowed: true, Limit: 10, Remaining: 4, Reset: 30 * time.Second},
+		},
+		{
+			// 5 of 10 are left for the previous window once three quarters of it slid out
+			name: "previous window sliding out", previous: 20, current: 5, elapsed: 30 * time.Second,
+			expected: Result{Limit: 10, Reset: 30 * time.Second, RetryAfter: 15 * time.Second},
+		},
+		{
+			name: "previous window at the start", previous: 10, current: 5,
+			expected: Result{Limit: 10, Reset: time.Minute, RetryAfter: 30 * time.Second},
+		},
+		{
+			name: "retry after at least a second", previous: 10, current: 5, elapsed: 29500 * time.Millisecond,
+			expected: Result{Limit: 10, Reset: 30500 * time.Millisecond, RetryAfter: time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, &tt.expected, decide(limit, tt.previous, tt.current, tt.elapsed))
+		})
+	}
+}
+
+func TestLimitEnabled(t *testing.T) {
+	assert.True(t, Limit{Requests: 1, Window: time.Second}.Enabled())
+	assert.False(t, Limit{Requests: 0, Window: time.Second}.Enabled())
+	assert.False(t, Limit{Requests: 1}.Enabled())
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type windowCounts struct {
+	index    int64
+	current  int64
+	previous int64
+}
+
+// MemoryLimiter counts requests in process memory. Each replica enforces the
+// limits on its own, so it is meant for single instances and as a fallback.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	counts    map[string]*windowCounts
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter() Limiter {
+	return &MemoryLimiter{counts: make(map[string]*windowCounts), now: time.Now}
+}
+
+func (ml *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	now := ml.now()
+	index, elapsed := windowOf(now, limit.Window)
+
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.sweep(now, limit.Window)
+
+	wc, ok := ml.counts[key]
+	if !ok {
+		wc = &windowCounts{index: index}
+		ml.counts[key] = wc
+	}
+	switch {
+	case wc.index == index-1:
+		wc.previous, wc.current = wc.current, 0
+	case wc.index < index-1:
+		wc.previous, wc.current = 0, 0
+	}
+	wc.index = index
+
+	res := decide(limit, wc.previous, wc.current+1, elapsed)
+	if res.Allowed {
+		wc.current++
+	}
+	return res, nil
+}
+
+// sweep drops the keys that have not been seen for two windows,
+// as their counts no longer affect any decision
+func (ml *MemoryLimiter) sweep(now time.Time, window time.Duration) {
+	if now.Sub(ml.lastSweep) < window {
+		return
+	}
+	ml.lastSweep = now
+	index, _ := windowOf(now, window)
+	for key, wc := range ml.counts {
+		if wc.index < index-1 {
+			delete(ml.counts, key)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLimiter returns a limiter whose clock starts at the beginning of a window
+func newTestLimiter(window time.Duration) (*MemoryLimiter, *time.Time) {
+	now := time.Unix(0, 0).Add(1000 * window)
+	ml := NewMemoryLimiter().(*MemoryLimiter)
+	ml.now = func() time.Time { return now }
+	return ml, &now
+}
+
+func allow(t *testing.T, ml *MemoryLimiter, key string, limit Limit) *Result {
+	t.Helper()
+	res, err := ml.Allow(context.Background(), key, limit)
+	require.NoError(t, err)
+	return res
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	limit := Limit{Requests: 3, Window: time.Minute}
+	ml, now := newTestLimiter(limit.Window)
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		res := allow(t, ml, "a", limit)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, remaining, res.Remaining)
+	}
+	res := allow(t, ml, "a", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Minute, res.RetryAfter)
+
+	// Keys are counted apart
+	assert.True(t, allow(t, ml, "b", limit).Allowed)
+
+	// At the start of the next window, the previous one still counts in full
+	*now = now.Add(time.Minute)
+	assert.False(t, allow(t, ml, "a", limit).Allowed)
+
+	// Halfway, it counts 1.5. Had the rejected requests been counted, it would count 2.5
+	*now = now.Add(30 * time.Second)
+	res = allow(t, ml, "a", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// After two idle windows, nothing is left
+	*now = now.Add(2 * time.Minute)
+	assert.Equal(t, 2, allow(t, ml, "a", limit).Remaining)
+}
+
+func TestMemoryLimiterSweepsIdleKeys(t *testing.T) {
+	limit := Limit{Requests: 3, Window: time.Minute}
+	ml, now := newTestLimiter(limit.Window)
+
+	allow(t, ml, "a", limit)
+	allow(t, ml, "b", limit)
+	*now = now.Add(time.Minute)
+	allow(t, ml, "b", limit)
+	// a is in the previous window of b, so it is kept
+	assert.Len(t, ml.counts, 2)
+
+	*now = now.Add(time.Minute)
+	allow(t, ml, "b", limit)
+	assert.Len(t, ml.counts, 1)
+	assert.Contains(t, ml.counts, "b")
+}
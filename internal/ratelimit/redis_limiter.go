@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	keyPrefix = "gately:rl"
+	// Least time between two log lines about counting locally, so that an outage does not flood the log
+	fallbackLogInterval = time.Minute
+)
+
+// RedisLimiter keeps the window counts in Redis, so that the limits hold across replicas.
+// While Redis is unreachable, requests are counted in process memory instead.
+type RedisLimiter struct {
+	client   *redis.Client
+	fallback Limiter
+	// Requests counted locally since the last log line about it, and when that was in unix nanos
+	fallbacks       atomic.Int64
+	lastFallbackLog atomic.Int64
+}
+
+func NewRedisLimiter(client *redis.Client) Limiter {
+	return &RedisLimiter{client: client, fallback: NewMemoryLimiter()}
+}
+
+func windowKey(key string, index int64) string {
+	return fmt.Sprintf("%s:%s:%d", keyPrefix, key, index)
+}
+
+func (rl *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	index, elapsed := windowOf(time.Now(), limit.Window)
+
+	var current *redis.IntCmd
+	var previous *redis.StringCmd
+	_, err := rl.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		currentKey := windowKey(key, index)
+		current = pipe.Incr(ctx, currentKey)
+		// Kept while it is the previous window of the next one
+		pipe.Expire(ctx, currentKey, 2*limit.Window)
+		previous = pipe.Get(ctx, windowKey(key, index-1))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		rl.logFallback(err)
+		return rl.fallback.Allow(ctx, key, limit)
+	}
+
+	prev, err := previous.Int64()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	res := decide(limit, prev, current.Val(), elapsed)
+	if !res.Allowed {
+		// Take the rejected request back out. Concurrent requests may briefly see it counted
+		if err := rl.client.Decr(ctx, windowKey(key, index)).Err(); err != nil {
+			log.Printf("Unable to uncount rejected request. Err=%v", err)
+		}
+	}
+	return res, nil
+}
+
+// logFallback logs that requests are counted locally, at most once per fallbackLogInterval
+func (rl *RedisLimiter) logFallback(err error) {
+	fallbacks := rl.fallbacks.Add(1)
+	now := time.Now().UnixNano()
+	last := rl.lastFallbackLog.Load()
+	if now-last < int64(fallbackLogInterval) || !rl.lastFallbackLog.CompareAndSwap(last, now) {
+		return
+	}
+	rl.fallbacks.Add(-fallbacks)
+	log.Printf("Unable to count requests in Redis, counted %d locally. Err=%v", fallbacks, err)
+}
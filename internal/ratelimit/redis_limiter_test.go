@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisLimiterFallsBackQuietly(t *testing.T) {
+	// Nothing listens on the port, so every request is counted locally
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer func() { _ = client.Close() }()
+	rl := NewRedisLimiter(client)
+
+	output := &bytes.Buffer{}
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(output)
+
+	limit := Limit{Requests: 3, Window: time.Hour}
+	var allowed int
+	for i := 0; i < 5; i++ {
+		res, err := rl.Allow(context.Background(), "a", limit)
+		require.NoError(t, err)
+		if res.Allowed {
+			allowed++
+		}
+	}
+	assert.Equal(t, 3, allowed)
+	assert.Equal(t, 1, strings.Count(output.String(), "counted 1 locally"), output.String())
+	assert.Equal(t, 1, strings.Count(output.String(), "\n"), output.String())
+}
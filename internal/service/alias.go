@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+var (
+	ErrInvalidAlias  = errors.New("Invalid alias")
+	ErrReservedAlias = errors.New("The alias is reserved")
+	ErrAliasTaken    = errors.New("The alias is already taken")
+)
+
+// Aliases start with a letter or digit and may contain '-' and '_' after that
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Path segments that are routed by the server itself or kept for future use.
+// A short code must never shadow one of them.
+var reservedAliases = map[string]bool{
+	"admin":   true,
+	"api":     true,
+	"assets":  true,
+	"health":  true,
+	"healthz": true,
+	"login":   true,
+	"logout":  true,
+	"metrics": true,
+	"readyz":  true,
+	"static":  true,
+	"swagger": true,
+}
+
+// isReserved reports whether code collides with a reserved path. Case is ignored
+// so that e.g. "API" cannot be used to confuse readers either.
+func isReserved(code string) bool {
+	return reservedAliases[strings.ToLower(code)]
+}
+
+// CheckAlias validates a user supplied vanity short code. The short code is prefix+alias,
+// with the short code prefix of the workspace, and must not be reserved either.
+func CheckAlias(prefix, alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("Alias must be between %d and %d characters long. Err=%w", minAliasLength, maxAliasLength, ErrInvalidAlias)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("Alias may only contain letters, digits, '-' and '_'. Err=%w", ErrInvalidAlias)
+	}
+	if isReserved(prefix + alias) {
+		return fmt.Errorf("Alias %s is reserved. Err=%w", prefix+alias, ErrReservedAlias)
+	}
+	return nil
+}
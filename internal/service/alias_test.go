@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gately/internal/dal"
+	"gately/internal/multicache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAlias(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		alias  string
+		err    error
+	}{
+		{"valid", "", "launch-2024", nil},
+		{"valid with a prefix", "mk", "launch", nil},
+		{"too short", "", "ab", ErrInvalidAlias},
+		{"too long", "", strings.Repeat("a", maxAliasLength+1), ErrInvalidAlias},
+		{"invalid characters", "", "launch/2024", ErrInvalidAlias},
+		{"leading dash", "", "-launch", ErrInvalidAlias},
+		{"reserved", "", "metrics", ErrReservedAlias},
+		{"reserved in another case", "", "API", ErrReservedAlias},
+		{"reserved with the prefix", "ad", "min", ErrReservedAlias},
+		{"reserved prefix of a longer code", "api", "docs", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckAlias(tt.prefix, tt.alias)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCreateUrlMappingRejectsReservedPrefixedAlias(t *testing.T) {
+	workspaces := dal.NewMemoryWorkspaceStore()
+	ws, err := NewWorkspace("team-a", "team-a", "ad", 0, "")
+	require.NoError(t, err)
+	require.NoError(t, workspaces.AddWorkspace(context.Background(), ws))
+	uss := New(
+		WithMultiCache(multicache.New(nil)),
+		WithUrlStore(dal.NewMemoryUrlStore()),
+		WithWorkspaceStore(workspaces),
+	)
+	ctx := workspaceContext("team-a", "alice")
+
+	// ad+min would be served as /admin
+	_, _, err = uss.CreateUrlMapping(ctx, "https://example.com", MappingOptions{Alias: "min"})
+	assert.ErrorIs(t, err, ErrReservedAlias)
+
+	entry, _, err := uss.CreateUrlMapping(ctx, "https://example.com", MappingOptions{Alias: "mins"})
+	require.NoError(t, err)
+	assert.Equal(t, "admins", entry.ShortUrl)
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gately/internal/dal"
+)
+
+var ErrInvalidDedupePolicy = errors.New("Invalid dedupe policy")
+
+// CheckDedupePolicy validates a dedupe policy. Empty stands for the server default
+func CheckDedupePolicy(policy dal.DedupePolicy) error {
+	if policy == "" || policy.Valid() {
+		return nil
+	}
+	return fmt.Errorf("Dedupe policy %q must be one of %s, %s or %s. Err=%w", policy,
+		dal.DedupeReject, dal.DedupeReturnExisting, dal.DedupeAllowDuplicates, ErrInvalidDedupePolicy)
+}
+
+// dedupePolicyFor returns the dedupe policy of ws, or the server default if it sets none
+func (uss *UrlShorteningService) dedupePolicyFor(ws *dal.Workspace) dal.DedupePolicy {
+	if ws != nil && ws.DedupePolicy != "" {
+		return ws.DedupePolicy
+	}
+	return uss.defaultDedupePolicy
+}
+
+// existingMapping returns the mapping of longUrl that a create with opts may return
+// instead of a new one, or nil. The existing mapping keeps its own expiry and redirect
+// type. It must not have expired, and it must have the alias of opts, if any.
+func (uss *UrlShorteningService) existingMapping(ctx context.Context, longUrl, host, prefix string, opts MappingOptions) (*dal.UrlMappingEntry, error) {
+
+	entry, err := uss.store.GetUrlEntryByLongUrl(ctx, workspaceFrom(ctx), host, longUrl)
+	if errors.Is(err, dal.ErrUrlEntryNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Unable to look up the short URL of %s. Err=%v", longUrl, err)
+		return nil, err
+	}
+	// The store hands its dedupe key to the new mapping
+	if entry.IsExpired(time.Now().Unix()) {
+		log.Printf("Existing short URL %s for %s has expired", entry.ShortUrl, longUrl)
+		return nil, nil
+	}
+
+	if _, code := dal.SplitShortKey(entry.ShortUrl); opts.Alias != "" && code != prefix+opts.Alias {
+		log.Printf("Existing short URL %s for %s is not the one requested", entry.ShortUrl, longUrl)
+		return nil, nil
+	}
+	log.Printf("Returning existing short URL %s for %s", entry.ShortUrl, longUrl)
+	return entry, nil
+}
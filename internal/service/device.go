@@ -0,0 +1,45 @@
+package service
+
+import "strings"
+
+type DeviceClass string
+
+const (
+	DeviceDesktop DeviceClass = "desktop"
+	DeviceMobile  DeviceClass = "mobile"
+	DeviceTablet  DeviceClass = "tablet"
+	DeviceBot     DeviceClass = "bot"
+	DeviceUnknown DeviceClass = "unknown"
+)
+
+// User agent fragments of crawlers, link previews and HTTP libraries
+var botMarkers = []string{
+	"bot", "crawl", "spider", "slurp", "facebookexternalhit", "preview",
+	"curl", "wget", "python-requests", "go-http-client", "okhttp", "headless",
+}
+
+// ClassifyDevice guesses the kind of device from a User-Agent header.
+// It is a heuristic over well known markers, not a full user agent parser.
+func ClassifyDevice(userAgent string) DeviceClass {
+	if userAgent == "" {
+		return DeviceUnknown
+	}
+	ua := strings.ToLower(userAgent)
+
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return DeviceBot
+		}
+	}
+	switch {
+	// Android tablets leave "mobile" out of their user agent
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"),
+		strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		return DeviceTablet
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"),
+		strings.Contains(ua, "windows phone"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
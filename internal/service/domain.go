@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gately/internal/dal"
+)
+
+const (
+	// Short urls on a custom domain are https unless the domain says otherwise
+	defaultDomainScheme = "https"
+
+	// How long the redirect path trusts its copy of the domain registry.
+	// A newly added domain starts resolving within this interval.
+	domainRefreshInterval = time.Minute
+)
+
+var (
+	ErrInvalidDomain = errors.New("Invalid domain")
+	ErrUnknownDomain = errors.New("The domain is not registered for the workspace")
+)
+
+var hostPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// NewDomain validates a custom domain for workspace
+func NewDomain(host, workspace, scheme string) (*dal.Domain, error) {
+	host = strings.ToLower(host)
+	if len(host) > 253 || !hostPattern.MatchString(host) {
+		return nil, fmt.Errorf("%q is not a fully qualified host name. Err=%w", host, ErrInvalidDomain)
+	}
+	if scheme != "" && scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("The scheme must be http or https. Err=%w", ErrInvalidDomain)
+	}
+	return &dal.Domain{
+		Host:      host,
+		Workspace: workspace,
+		Scheme:    scheme,
+		CreatedTs: time.Now().Unix(),
+	}, nil
+}
+
+// domainRegistry is the copy of the registered domains that redirects are resolved with.
+// It is reloaded at most once per domainRefreshInterval, so that the redirect path
+// does not query the store for the host of every request.
+type domainRegistry struct {
+	store dal.DomainStore
+	// Redirects read the current copy without locking
+	current atomic.Pointer[domainSnapshot]
+	// Held while the copy is reloaded, so that only one request queries the store
+	reload sync.Mutex
+	// Clock of the refresh interval, replaced in tests
+	now func() time.Time
+}
+
+// domainSnapshot is one copy of the registered domains, keyed by their host
+type domainSnapshot struct {
+	hosts    map[string]*dal.Domain
+	loadedAt time.Time
+}
+
+func newDomainRegistry(store dal.DomainStore) *domainRegistry {
+	return &domainRegistry{store: store, now: time.Now}
+}
+
+func (r *domainRegistry) lookup(ctx context.Context, host string) (*dal.Domain, bool) {
+	snapshot := r.current.Load()
+	if snapshot == nil || r.now().Sub(snapshot.loadedAt) > domainRefreshInterval {
+		snapshot = r.refresh(ctx, snapshot)
+	}
+	domain, ok := snapshot.hosts[host]
+	return domain, ok
+}
+
+// refresh reloads the copy of the domains, unless another request already does.
+// Requests keep resolving with the stale copy meanwhile. Only the first requests
+// after a start, when there is no copy yet, wait for it.
+func (r *domainRegistry) refresh(ctx context.Context, stale *domainSnapshot) *domainSnapshot {
+	if stale == nil {
+		r.reload.Lock()
+	} else if !r.reload.TryLock() {
+		return stale
+	}
+	defer r.reload.Unlock()
+
+	// Another request may have reloaded it in the meantime
+	if current := r.current.Load(); current != nil && current != stale {
+		return current
+	}
+
+	next := &domainSnapshot{hosts: map[string]*dal.Domain{}, loadedAt: r.now()}
+	domains, err := r.store.ListDomains(ctx)
+	if err != nil {
+		// Keep resolving with the previous copy until the store is back
+		log.Printf("Unable to reload the domain registry. Err=%v", err)
+		if stale != nil {
+			next.hosts = stale.hosts
+		}
+	}
+	for _, domain := range domains {
+		next.hosts[domain.Host] = domain
+	}
+	r.current.Store(next)
+	return next
+}
+
+// domainFor checks that the principal of ctx may create links on host
+func (uss *UrlShorteningService) domainFor(ctx context.Context, host string) (*dal.Domain, error) {
+
+	if uss.domains == nil {
+		return nil, fmt.Errorf("Custom domains are not configured. Err=%w", ErrUnknownDomain)
+	}
+	domain, err := uss.domains.store.GetDomain(ctx, strings.ToLower(host))
+	if errors.Is(err, dal.ErrDomainNotFound) {
+		return nil, fmt.Errorf("%s is not registered. Err=%w", host, ErrUnknownDomain)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Domains of other workspaces are reported as unknown, like their links
+	if domain.Workspace != workspaceFrom(ctx) {
+		log.Printf("Domain %s is not in workspace %q", host, workspaceFrom(ctx))
+		return nil, fmt.Errorf("%s is not registered. Err=%w", host, ErrUnknownDomain)
+	}
+	return domain, nil
+}
+
+// ShortUrlFor resolves the code requested from host to the key of its link.
+// Hosts that are not registered serve the links of the default domain.
+func (uss *UrlShorteningService) ShortUrlFor(ctx context.Context, host, code string) string {
+
+	if uss.domains == nil || host == "" {
+		return code
+	}
+	host = strings.ToLower(host)
+	if _, ok := uss.domains.lookup(ctx, host); ok {
+		return dal.ShortKey(host, code)
+	}
+	// The Host header carries the port when it is not the default one
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		if _, ok := uss.domains.lookup(ctx, name); ok {
+			return dal.ShortKey(name, code)
+		}
+	}
+	return code
+}
+
+// ShortLink is the full short url of the link stored as shortUrl.
+// Links of the default domain are served from defaultBase, e.g. https://gate.ly
+func (uss *UrlShorteningService) ShortLink(ctx context.Context, shortUrl, defaultBase string) string {
+
+	host, code := dal.SplitShortKey(shortUrl)
+	if host == "" {
+		return strings.TrimSuffix(defaultBase, "/") + "/" + code
+	}
+
+	scheme := defaultDomainScheme
+	if uss.domains != nil {
+		if domain, ok := uss.domains.lookup(ctx, host); ok && domain.Scheme != "" {
+			scheme = domain.Scheme
+		}
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, host, code)
+}
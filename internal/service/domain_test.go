@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gately/internal/dal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDomainStore counts the reloads of the registry, and fails or holds them on demand
+type countingDomainStore struct {
+	dal.DomainStore
+	lists atomic.Int64
+	fail  atomic.Bool
+	// Reloads wait for it when set
+	release chan struct{}
+}
+
+func (s *countingDomainStore) ListDomains(ctx context.Context) ([]*dal.Domain, error) {
+	s.lists.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	if s.fail.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return s.DomainStore.ListDomains(ctx)
+}
+
+func newTestRegistry(t *testing.T, hosts ...string) (*domainRegistry, *countingDomainStore, *time.Time) {
+	t.Helper()
+	store := &countingDomainStore{DomainStore: dal.NewMemoryDomainStore()}
+	for _, host := range hosts {
+		addDomain(t, store, host)
+	}
+	now := time.Unix(1700000000, 0)
+	registry := newDomainRegistry(store)
+	registry.now = func() time.Time { return now }
+	return registry, store, &now
+}
+
+func addDomain(t *testing.T, store dal.DomainStore, host string) {
+	t.Helper()
+	domain, err := NewDomain(host, "team-a", "")
+	require.NoError(t, err)
+	require.NoError(t, store.AddDomain(context.Background(), domain))
+}
+
+func TestDomainRegistryReloads(t *testing.T) {
+	ctx := context.Background()
+	registry, store, now := newTestRegistry(t, "go.acme.com")
+
+	domain, ok := registry.lookup(ctx, "go.acme.com")
+	require.True(t, ok)
+	assert.Equal(t, "team-a", domain.Workspace)
+	_, ok = registry.lookup(ctx, "links.acme.io")
+	assert.False(t, ok)
+	assert.Equal(t, int64(1), store.lists.Load())
+
+	// A new domain starts resolving once the copy is older than the refresh interval
+	addDomain(t, store, "links.acme.io")
+	*now = now.Add(domainRefreshInterval)
+	_, ok = registry.lookup(ctx, "links.acme.io")
+	assert.False(t, ok)
+
+	*now = now.Add(time.Second)
+	_, ok = registry.lookup(ctx, "links.acme.io")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), store.lists.Load())
+
+	// While the store fails, the previous copy is used, and not reloaded for every request
+	store.fail.Store(true)
+	*now = now.Add(2 * domainRefreshInterval)
+	for i := 0; i < 3; i++ {
+		_, ok = registry.lookup(ctx, "go.acme.com")
+		assert.True(t, ok)
+	}
+	assert.Equal(t, int64(3), store.lists.Load())
+}
+
+func TestDomainRegistryDoesNotBlockOnReload(t *testing.T) {
+	ctx := context.Background()
+	registry, store, now := newTestRegistry(t, "go.acme.com")
+	_, ok := registry.lookup(ctx, "go.acme.com")
+	require.True(t, ok)
+
+	// One request reloads, and is held in the store
+	store.release = make(chan struct{})
+	*now = now.Add(2 * domainRefreshInterval)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		registry.lookup(ctx, "go.acme.com")
+	}()
+	require.Eventually(t, func() bool { return store.lists.Load() == 2 }, time.Second, time.Millisecond)
+
+	// The others resolve with the stale copy meanwhile, without queuing up behind it
+	for i := 0; i < 10; i++ {
+		_, ok := registry.lookup(ctx, "go.acme.com")
+		assert.True(t, ok)
+	}
+	assert.Equal(t, int64(2), store.lists.Load())
+
+	close(store.release)
+	wg.Wait()
+}
+
+func TestDomainRegistryLoadsOnceConcurrently(t *testing.T) {
+	ctx := context.Background()
+	registry, store, _ := newTestRegistry(t, "go.acme.com")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Requests before the first load wait for it
+			_, ok := registry.lookup(ctx, "go.acme.com")
+			assert.True(t, ok)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), store.lists.Load())
+}
+
+func TestShortUrlFor(t *testing.T) {
+	ctx := context.Background()
+	uss := New(WithDomainStore(dal.NewMemoryDomainStore()))
+	addDomain(t, uss.domains.store, "go.acme.com")
+
+	assert.Equal(t, dal.ShortKey("go.acme.com", "sale"), uss.ShortUrlFor(ctx, "go.acme.com", "sale"))
+	assert.Equal(t, dal.ShortKey("go.acme.com", "sale"), uss.ShortUrlFor(ctx, "GO.acme.com:8080", "sale"))
+	// Hosts that are not registered serve the default domain
+	assert.Equal(t, "sale", uss.ShortUrlFor(ctx, "localhost:8080", "sale"))
+	assert.Equal(t, "sale", uss.ShortUrlFor(ctx, "", "sale"))
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"gately/internal/dal"
+)
+
+var ErrInvalidVersion = errors.New("No such version")
+
+// UrlVersion is one destination of a short url and the time it was live.
+// Versions are numbered from 1, oldest first. The highest version is the current destination.
+type UrlVersion struct {
+	Version    int    `json:"version"`
+	LongUrl    string `json:"long_url"`
+	ActiveFrom int64  `json:"active_from"`
+	// Zero for the current destination
+	ActiveUntil int64 `json:"active_until,omitempty"`
+	// Who retargeted the short url away from this destination
+	ReplacedBy string `json:"replaced_by,omitempty"`
+	Current    bool   `json:"current,omitempty"`
+}
+
+// GetUrlHistory lists every destination a short url has had, oldest first
+func (uss *UrlShorteningService) GetUrlHistory(ctx context.Context, shortUrl string) ([]UrlVersion, error) {
+
+	entry, err := uss.entryFor(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
+	history, err := uss.store.GetUrlHistory(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]UrlVersion, 0, len(history)+1)
+	activeFrom := entry.CreatedTs
+	for i, dest := range history {
+		versions = append(versions, UrlVersion{
+			Version:     i + 1,
+			LongUrl:     dest.LongUrl,
+			ActiveFrom:  activeFrom,
+			ActiveUntil: dest.ReplacedTs,
+			ReplacedBy:  dest.Actor,
+		})
+		activeFrom = dest.ReplacedTs
+	}
+	versions = append(versions, UrlVersion{
+		Version:    len(history) + 1,
+		LongUrl:    entry.LongUrl,
+		ActiveFrom: activeFrom,
+		Current:    true,
+	})
+	return versions, nil
+}
+
+// RollbackUrlMapping retargets a short url to the destination it had at the given version.
+// The rollback itself is recorded in the history like any other update.
+func (uss *UrlShorteningService) RollbackUrlMapping(ctx context.Context, shortUrl string, version int, actor string) (*dal.UrlMappingEntry, error) {
+
+	versions, err := uss.GetUrlHistory(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
+	if version < 1 || version > len(versions) {
+		return nil, fmt.Errorf("%s has versions 1 to %d. Err=%w", shortUrl, len(versions), ErrInvalidVersion)
+	}
+
+	target := versions[version-1].LongUrl
+	log.Printf("Rolling back %s to version %d (%s)", shortUrl, version, target)
+	return uss.UpdateUrlMapping(ctx, shortUrl, &dal.UrlEntryUpdate{
+		LongUrl: &target,
+		Actor:   actor,
+	})
+}
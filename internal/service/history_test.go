@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gately/internal/dal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackUrlMapping(t *testing.T) {
+	ctx := context.Background()
+	uss, _, _ := newTestService(t)
+
+	entry, _, err := uss.CreateUrlMapping(ctx, "https://example.com/a", MappingOptions{})
+	require.NoError(t, err)
+	longUrl := "https://example.com/b"
+	_, err = uss.UpdateUrlMapping(ctx, entry.ShortUrl, &dal.UrlEntryUpdate{LongUrl: &longUrl, Actor: "alice"})
+	require.NoError(t, err)
+
+	// Redirects are served from the cache from now on
+	redirect, err := uss.RedirectUrl(ctx, entry.ShortUrl, Visit{})
+	require.NoError(t, err)
+	require.Equal(t, longUrl, redirect.LongUrl)
+	require.Eventually(t, func() bool {
+		_, err := uss.cache.Get(ctx, entry.ShortUrl)
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	rolledBack, err := uss.RollbackUrlMapping(ctx, entry.ShortUrl, 1, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", rolledBack.LongUrl)
+
+	redirect, err = uss.RedirectUrl(ctx, entry.ShortUrl, Visit{})
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", redirect.LongUrl)
+
+	versions, err := uss.GetUrlHistory(ctx, entry.ShortUrl)
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/b", "https://example.com/a"},
+		[]string{versions[0].LongUrl, versions[1].LongUrl, versions[2].LongUrl})
+	assert.Equal(t, "alice", versions[0].ReplacedBy)
+	assert.Equal(t, "bob", versions[1].ReplacedBy)
+	assert.Equal(t, entry.CreatedTs, versions[0].ActiveFrom)
+	assert.Equal(t, versions[0].ActiveUntil, versions[1].ActiveFrom)
+	assert.True(t, versions[2].Current)
+	assert.Zero(t, versions[2].ActiveUntil)
+	for i, version := range versions {
+		assert.Equal(t, i+1, version.Version)
+	}
+
+	for _, version := range []int{0, -1, 4} {
+		_, err = uss.RollbackUrlMapping(ctx, entry.ShortUrl, version, "bob")
+		assert.ErrorIs(t, err, ErrInvalidVersion, version)
+	}
+	_, err = uss.RollbackUrlMapping(ctx, "missing", 1, "bob")
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+
+	// Rolling back to the current destination changes nothing and records nothing
+	_, err = uss.RollbackUrlMapping(ctx, entry.ShortUrl, 3, "bob")
+	require.NoError(t, err)
+	versions, err = uss.GetUrlHistory(ctx, entry.ShortUrl)
+	require.NoError(t, err)
+	assert.Len(t, versions, 3)
+}
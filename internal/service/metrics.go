@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gately/internal/dal"
+)
+
+const (
+	DefaultMetricsLimit = 100
+	MaxMetricsLimit     = 1000
+)
+
+var (
+	ErrInvalidMetricsQuery = errors.New("Invalid metrics query")
+	ErrInvalidCursor       = errors.New("Invalid cursor")
+)
+
+// UrlMetrics is a URL mapping together with estimates of its unique visitors
+type UrlMetrics struct {
+	*dal.UrlMappingEntry
+	// Full short url, e.g. https://gate.ly/abc. Set by the API
+	ShortLink           string `json:"short_link,omitempty"`
+	UniqueVisitors      int64  `json:"unique_visitors"`
+	UniqueVisitorsToday int64  `json:"unique_visitors_today"`
+}
+
+// MetricsPage is one page of metrics. NextCursor is empty on the last page
+type MetricsPage struct {
+	Metrics    []*UrlMetrics `json:"metrics"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// EncodeMetricsCursor turns the position of an entry into an opaque token for clients
+func EncodeMetricsCursor(cursor *dal.MetricsCursor) string {
+	raw := fmt.Sprintf("%d:%s", cursor.Hits, cursor.ShortUrl)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeMetricsCursor parses a token made by EncodeMetricsCursor. Tokens that it cannot
+// have made, e.g. with negative hits or "+1" for 1, are rejected as well
+func DecodeMetricsCursor(token string) (*dal.MetricsCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	hits, shortUrl, ok := strings.Cut(string(raw), ":")
+	if !ok || shortUrl == "" {
+		return nil, ErrInvalidCursor
+	}
+	cursor := &dal.MetricsCursor{ShortUrl: shortUrl}
+	if cursor.Hits, err = strconv.ParseInt(hits, 10, 64); err != nil || cursor.Hits < 0 {
+		return nil, ErrInvalidCursor
+	}
+	if EncodeMetricsCursor(cursor) != token {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// GetUrlMetrics returns one page of the entries selected by query, in the workspace of ctx.
+// A zero limit means DefaultMetricsLimit.
+func (uss *UrlShorteningService) GetUrlMetrics(ctx context.Context, query dal.MetricsQuery) (*MetricsPage, error) {
+
+	query.Workspace = workspaceFrom(ctx)
+
+	if query.Start < 0 || query.End <= query.Start {
+		return nil, fmt.Errorf("start must be before end. Err=%w", ErrInvalidMetricsQuery)
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultMetricsLimit
+	}
+	if query.Limit < 0 || query.Limit > MaxMetricsLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d. Err=%w", MaxMetricsLimit, ErrInvalidMetricsQuery)
+	}
+
+	// Ask for one more entry than needed, to learn whether there is a next page
+	limit := query.Limit
+	query.Limit++
+
+	now := time.Now()
+	page := &MetricsPage{Metrics: make([]*UrlMetrics, 0, limit)}
+	err := uss.store.GetUrlMetrics(ctx, query, func(entry *dal.UrlMappingEntry) error {
+		if len(page.Metrics) == limit {
+			last := page.Metrics[limit-1]
+			page.NextCursor = EncodeMetricsCursor(&dal.MetricsCursor{Hits: last.Hits, ShortUrl: last.ShortUrl})
+			return nil
+		}
+		page.Metrics = append(page.Metrics, uss.urlMetrics(ctx, entry, now))
+		return nil
+	})
+	if err != nil {
+		log.Printf("Unable to get metrics. Err=%v", err)
+		return nil, err
+	}
+	return page, nil
+}
+
+// urlMetrics adds the unique visitor estimates to entry
+func (uss *UrlShorteningService) urlMetrics(ctx context.Context, entry *dal.UrlMappingEntry, now time.Time) *UrlMetrics {
+	metrics := &UrlMetrics{UrlMappingEntry: entry}
+	if uss.visitors == nil {
+		return metrics
+	}
+
+	var err error
+	// The estimates are best effort. Hits are still reported without them
+	if metrics.UniqueVisitors, err = uss.visitors.Count(ctx, entry.ShortUrl); err != nil {
+		log.Printf("Unable to count unique visitors of %s. Err=%v", entry.ShortUrl, err)
+	}
+	if metrics.UniqueVisitorsToday, err = uss.visitors.CountDays(ctx, entry.ShortUrl, now); err != nil {
+		log.Printf("Unable to count today's unique visitors of %s. Err=%v", entry.ShortUrl, err)
+	}
+	return metrics
+}
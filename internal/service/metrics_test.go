@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"gately/internal/dal"
+	"gately/internal/multicache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeMetricsCursor(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name   string
+		token  string
+		cursor *dal.MetricsCursor
+	}{
+		{"round trip", EncodeMetricsCursor(&dal.MetricsCursor{Hits: 42, ShortUrl: "abc"}), &dal.MetricsCursor{Hits: 42, ShortUrl: "abc"}},
+		{"no hits yet", encode("0:abc"), &dal.MetricsCursor{ShortUrl: "abc"}},
+		{"short url with a colon", encode("7:go.acme.com:abc"), &dal.MetricsCursor{Hits: 7, ShortUrl: "go.acme.com:abc"}},
+		{"empty", "", nil},
+		{"not base64", "!!!", nil},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("42:abcd")), nil},
+		{"standard base64", base64.RawStdEncoding.EncodeToString([]byte("1:ab?>")), nil},
+		{"no separator", encode("42abc"), nil},
+		{"no short url", encode("42:"), nil},
+		{"hits not a number", encode("many:abc"), nil},
+		{"negative hits", encode("-1:abc"), nil},
+		{"signed hits", encode("+1:abc"), nil},
+		{"leading zeros", encode("007:abc"), nil},
+		{"hits overflow", encode("9223372036854775808:abc"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := DecodeMetricsCursor(tt.token)
+			if tt.cursor == nil {
+				assert.ErrorIs(t, err, ErrInvalidCursor)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.cursor, cursor)
+		})
+	}
+}
+
+func TestGetUrlMetricsPages(t *testing.T) {
+	ctx := context.Background()
+	store := dal.NewMemoryUrlStore()
+	uss := New(WithMultiCache(multicache.New(nil)), WithUrlStore(store))
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, store.AddUrlEntry(ctx, &dal.UrlMappingEntry{
+			ShortUrl: fmt.Sprintf("url%d", i), LongUrl: fmt.Sprintf("https://example.com/%d", i),
+			Hits: int64(i), LastAccessed: 100, Workspace: dal.DefaultWorkspace}))
+	}
+	query := dal.MetricsQuery{Start: 0, End: 200}
+
+	for _, limit := range []int{-1, MaxMetricsLimit + 1} {
+		query.Limit = limit
+		_, err := uss.GetUrlMetrics(ctx, query)
+		assert.ErrorIs(t, err, ErrInvalidMetricsQuery, limit)
+	}
+	_, err := uss.GetUrlMetrics(ctx, dal.MetricsQuery{Start: 200, End: 100})
+	assert.ErrorIs(t, err, ErrInvalidMetricsQuery)
+
+	// Zero is the default limit, which takes every entry at once
+	query.Limit = 0
+	page, err := uss.GetUrlMetrics(ctx, query)
+	require.NoError(t, err)
+	assert.Len(t, page.Metrics, 4)
+	assert.Empty(t, page.NextCursor)
+
+	// A full last page has no next cursor, so that clients do not fetch an empty one
+	var shortUrls []string
+	query.Limit = 2
+	for pages := 1; ; pages++ {
+		require.LessOrEqual(t, pages, 2)
+		page, err := uss.GetUrlMetrics(ctx, query)
+		require.NoError(t, err)
+		require.Len(t, page.Metrics, 2)
+		for _, metrics := range page.Metrics {
+			shortUrls = append(shortUrls, metrics.ShortUrl)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.After, err = DecodeMetricsCursor(page.NextCursor)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"url4", "url3", "url2", "url1"}, shortUrls)
+
+	// A cursor past the last entry gives an empty page
+	query.After = &dal.MetricsCursor{Hits: 0, ShortUrl: "url0"}
+	page, err = uss.GetUrlMetrics(ctx, query)
+	require.NoError(t, err)
+	assert.Empty(t, page.Metrics)
+	assert.Empty(t, page.NextCursor)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"gately/internal/auth"
+	"gately/internal/dal"
+)
+
+var (
+	ErrNotOwner      = errors.New("The short URL belongs to someone else")
+	ErrQuotaExceeded = errors.New("The workspace has reached its link quota")
+)
+
+// ownerFrom is the owner recorded on links created with ctx.
+// Requests without a principal, e.g. when authentication is disabled, create unowned links.
+func ownerFrom(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.Owner
+	}
+	return ""
+}
+
+// workspaceFrom is the workspace that requests made with ctx are scoped to
+func workspaceFrom(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.Workspace
+	}
+	return dal.DefaultWorkspace
+}
+
+// workspaceFor returns the settings of the workspace of ctx.
+// The default workspace has none, so it is nil.
+func (uss *UrlShorteningService) workspaceFor(ctx context.Context) (*dal.Workspace, error) {
+
+	id := workspaceFrom(ctx)
+	if id == dal.DefaultWorkspace || uss.workspaces == nil {
+		return nil, nil
+	}
+	return uss.workspaces.GetWorkspace(ctx, id)
+}
+
+// checkQuota makes sure that ws may have another link. Concurrent creates
+// can overshoot the quota by a few links, which is fine for a soft limit.
+func (uss *UrlShorteningService) checkQuota(ctx context.Context, ws *dal.Workspace) error {
+
+	if ws == nil || ws.MaxLinks <= 0 {
+		return nil
+	}
+	count, err := uss.store.CountUrlEntries(ctx, ws.Id)
+	if err != nil {
+		return err
+	}
+	if count >= ws.MaxLinks {
+		log.Printf("Workspace %s has %d of %d links", ws.Id, count, ws.MaxLinks)
+		return fmt.Errorf("Workspace %s may have at most %d links. Err=%w", ws.Id, ws.MaxLinks, ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// entryFor fetches shortUrl on behalf of the principal of ctx.
+// Links of other workspaces are reported as not found, so that their existence does not leak.
+func (uss *UrlShorteningService) entryFor(ctx context.Context, shortUrl string) (*dal.UrlMappingEntry, error) {
+
+	entry, err := uss.store.GetUrlEntry(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Workspace != workspaceFrom(ctx) {
+		log.Printf("%s is not in workspace %q", shortUrl, workspaceFrom(ctx))
+		return nil, dal.ErrUrlEntryNotFound
+	}
+	return entry, nil
+}
+
+// checkOwner makes sure that the principal of ctx may change shortUrl, and returns its entry.
+// Updates and deletes are made conditional on the entry seen here, see checkedCondition.
+func (uss *UrlShorteningService) checkOwner(ctx context.Context, shortUrl string) (*dal.UrlMappingEntry, error) {
+
+	entry, err := uss.entryFor(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := auth.FromContext(ctx)
+	if ok && !p.CanManage(entry.Owner) {
+		log.Printf("Key %s of %s may not change %s", p.KeyId, p.Owner, shortUrl)
+		return nil, fmt.Errorf("%s is owned by %q. Err=%w", shortUrl, entry.Owner, ErrNotOwner)
+	}
+	return entry, nil
+}
+
+// checkedCondition pins a change to the owner and workspace of the entry returned by checkOwner
+func checkedCondition(checked *dal.UrlMappingEntry) dal.UrlEntryCondition {
+	return dal.UrlEntryCondition{Owner: &checked.Owner, Workspace: &checked.Workspace}
+}
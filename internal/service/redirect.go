@@ -0,0 +1,74 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gately/internal/dal"
+)
+
+var ErrInvalidRedirectType = errors.New("Invalid redirect type")
+
+// Redirect is where a short url sends its visitors, and how
+type Redirect struct {
+	LongUrl string
+	// HTTP status of the redirect. 301 and 308 are permanent, 302 and 307 temporary
+	Status int
+	// Unix time from which the short URL stops redirecting. Zero means never
+	ExpiresAt int64
+}
+
+// Permanent reports whether clients may remember the redirect
+func (r *Redirect) Permanent() bool {
+	return r.Status == http.StatusMovedPermanently || r.Status == http.StatusPermanentRedirect
+}
+
+// CheckRedirectType validates the redirect type of a link. Zero stands for the server default
+func CheckRedirectType(status int) error {
+	switch status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	}
+	return fmt.Errorf("Redirect type must be one of 301, 302, 307 or 308. Err=%w", ErrInvalidRedirectType)
+}
+
+// cachedRedirect is what the cache holds per short url.
+// The redirect type is kept as stored, so that a new server default applies right away.
+type cachedRedirect struct {
+	LongUrl      string `json:"u"`
+	RedirectType int    `json:"t,omitempty"`
+	ExpiresAt    int64  `json:"e,omitempty"`
+}
+
+// isExpired mirrors dal.UrlMappingEntry.IsExpired
+func (c *cachedRedirect) isExpired(now int64) bool {
+	return c.ExpiresAt > 0 && now >= c.ExpiresAt
+}
+
+func encodeCachedRedirect(entry *dal.UrlMappingEntry) string {
+	raw, _ := json.Marshal(cachedRedirect{LongUrl: entry.LongUrl, RedirectType: entry.RedirectType, ExpiresAt: entry.ExpiresAt})
+	return string(raw)
+}
+
+// decodeCachedRedirect reads a cached value. Older versions cached the bare long url
+func decodeCachedRedirect(value string) (*cachedRedirect, error) {
+	if !strings.HasPrefix(value, "{") {
+		return &cachedRedirect{LongUrl: value}, nil
+	}
+	cached := &cachedRedirect{}
+	if err := json.Unmarshal([]byte(value), cached); err != nil {
+		return nil, err
+	}
+	return cached, nil
+}
+
+// redirectFor resolves the redirect type of a link against the server default
+func (uss *UrlShorteningService) redirectFor(longUrl string, redirectType int, expiresAt int64) *Redirect {
+	if redirectType == 0 {
+		redirectType = uss.defaultRedirectType
+	}
+	return &Redirect{LongUrl: longUrl, Status: redirectType, ExpiresAt: expiresAt}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"gately/internal/dal"
+	"gately/internal/multicache"
+	gocache "github.com/eko/gocache/v3/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedRedirectRoundTrip(t *testing.T) {
+	tests := []*dal.UrlMappingEntry{
+		{LongUrl: "https://example.com/a?b=c"},
+		{LongUrl: "https://example.com", RedirectType: http.StatusMovedPermanently, ExpiresAt: 1700000000},
+	}
+	for _, entry := range tests {
+		cached, err := decodeCachedRedirect(encodeCachedRedirect(entry))
+		require.NoError(t, err)
+		assert.Equal(t, &cachedRedirect{LongUrl: entry.LongUrl, RedirectType: entry.RedirectType, ExpiresAt: entry.ExpiresAt}, cached)
+	}
+}
+
+func TestDecodeCachedRedirect(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		cached *cachedRedirect
+	}{
+		// Older versions cached the bare long url
+		{"bare long url", "https://example.com/a?b=c", &cachedRedirect{LongUrl: "https://example.com/a?b=c"}},
+		{"long url only", `{"u":"https://example.com"}`, &cachedRedirect{LongUrl: "https://example.com"}},
+		{"all fields", `{"u":"https://example.com","t":308,"e":1700000000}`,
+			&cachedRedirect{LongUrl: "https://example.com", RedirectType: 308, ExpiresAt: 1700000000}},
+		{"unknown fields", `{"u":"https://example.com","x":1}`, &cachedRedirect{LongUrl: "https://example.com"}},
+		{"truncated", `{"u":"https://exa`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cached, err := decodeCachedRedirect(tt.value)
+			if tt.cached == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.cached, cached)
+		})
+	}
+}
+
+// setCached puts value into the cache. The in-memory tier applies sets asynchronously
+func setCached(t *testing.T, cache *gocache.ChainCache[string], key, value string) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, cache.Set(ctx, key, value))
+	require.Eventually(t, func() bool {
+		cached, err := cache.Get(ctx, key)
+		return err == nil && cached == value
+	}, time.Second, time.Millisecond)
+}
+
+func TestRedirectUrlReadsOlderCacheValues(t *testing.T) {
+	ctx := context.Background()
+	cache := multicache.New(nil)
+	uss := New(
+		WithMultiCache(cache),
+		WithUrlStore(dal.NewMemoryUrlStore()),
+		WithDefaultRedirectType(http.StatusTemporaryRedirect),
+	)
+
+	// A bare long url, as cached before redirect types, redirects with the server default
+	setCached(t, cache, "legacy", "https://example.com/legacy")
+	redirect, err := uss.RedirectUrl(ctx, "legacy", Visit{})
+	require.NoError(t, err)
+	assert.Equal(t, &Redirect{LongUrl: "https://example.com/legacy", Status: http.StatusTemporaryRedirect}, redirect)
+
+	// An unreadable value falls through to the store
+	setCached(t, cache, "broken", `{"u":`)
+	_, err = uss.RedirectUrl(ctx, "broken", Visit{})
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// Base62Alphabet is the default alphabet for generated short codes
+	Base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	DefaultShortCodeLength = 7
+	maxShortCodeLength     = 32
+	minAlphabetLength      = 16
+)
+
+var ErrInvalidShortCodeConfig = errors.New("Invalid short code generator configuration")
+
+// ShortCodeGenerator produces the code that identifies a short URL.
+// Generated codes may collide with existing ones, callers are expected to retry.
+type ShortCodeGenerator interface {
+	Generate() (string, error)
+}
+
+func checkAlphabet(alphabet string) error {
+	if len(alphabet) < minAlphabetLength {
+		return fmt.Errorf("Alphabet needs at least %d characters. Err=%w", minAlphabetLength, ErrInvalidShortCodeConfig)
+	}
+	seen := make(map[rune]bool)
+	for _, r := range alphabet {
+		// Codes are used as a URL path segment, so only unreserved characters are allowed
+		if !strings.ContainsRune(Base62Alphabet+"-_", r) {
+			return fmt.Errorf("Alphabet character %q is not URL safe. Err=%w", r, ErrInvalidShortCodeConfig)
+		}
+		if seen[r] {
+			return fmt.Errorf("Alphabet character %q is repeated. Err=%w", r, ErrInvalidShortCodeConfig)
+		}
+		seen[r] = true
+	}
+	return nil
+}
+
+func checkLength(length int) error {
+	if length <= 0 || length > maxShortCodeLength {
+		return fmt.Errorf("Short code length must be between 1 and %d. Err=%w", maxShortCodeLength, ErrInvalidShortCodeConfig)
+	}
+	return nil
+}
+
+// encode writes n in the positional system given by alphabet
+func encode(n uint64, alphabet string) string {
+	base := uint64(len(alphabet))
+	if n == 0 {
+		return alphabet[:1]
+	}
+	var out []byte
+	for n > 0 {
+		out = append(out, alphabet[n%base])
+		n /= base
+	}
+	// Most significant digit first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// minValueForLength is the smallest number whose encoding has the given length
+func minValueForLength(length int, alphabet string) uint64 {
+	n := uint64(1)
+	for i := 1; i < length; i++ {
+		n *= uint64(len(alphabet))
+	}
+	return n
+}
+
+// randomCounterSeed picks a random start for a counter among the numbers whose encoding
+// has the given length. Replicas, and restarts with the clock set back, start far apart
+// instead of replaying each other's codes. The upper half of the range is left out, so
+// that the counter does not soon outgrow the length.
+func randomCounterSeed(length int, alphabet string) (uint64, error) {
+	floor := minValueForLength(length, alphabet)
+	factor := uint64(len(alphabet) - 1)
+	span := floor * factor
+	if span/factor != floor {
+		span = math.MaxUint64 - floor
+	}
+	n, err := rand.Int(rand.Reader, new(big.Int).SetUint64(span/2))
+	if err != nil {
+		return 0, err
+	}
+	return floor + n.Uint64(), nil
+}
+
+// RandomCodeGenerator picks every character uniformly at random
+type RandomCodeGenerator struct {
+	alphabet string
+	length   int
+}
+
+func NewRandomCodeGenerator(alphabet string, length int) (ShortCodeGenerator, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	if err := checkLength(length); err != nil {
+		return nil, err
+	}
+	return &RandomCodeGenerator{alphabet: alphabet, length: length}, nil
+}
+
+func (g *RandomCodeGenerator) Generate() (string, error) {
+	max := big.NewInt(int64(len(g.alphabet)))
+	code := make([]byte, g.length)
+	for i := range code {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = g.alphabet[idx.Int64()]
+	}
+	return string(code), nil
+}
+
+// CounterCodeGenerator encodes a monotonically increasing counter.
+// The counter starts at a random number, see randomCounterSeed.
+type CounterCodeGenerator struct {
+	alphabet string
+	counter  uint64
+}
+
+func NewCounterCodeGenerator(alphabet string, minLength int) (ShortCodeGenerator, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	if err := checkLength(minLength); err != nil {
+		return nil, err
+	}
+	seed, err := randomCounterSeed(minLength, alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return &CounterCodeGenerator{alphabet: alphabet, counter: seed}, nil
+}
+
+func (g *CounterCodeGenerator) Generate() (string, error) {
+	return encode(atomic.AddUint64(&g.counter, 1), g.alphabet), nil
+}
+
+// HashidsCodeGenerator encodes a counter like hashids does.
+// Codes are short and unique, but unlike CounterCodeGenerator consecutive codes
+// look unrelated, so they cannot be enumerated without knowing the salt.
+type HashidsCodeGenerator struct {
+	alphabet string
+	salt     string
+	// Added to every counter value so that codes have at least the minimum length
+	offset  uint64
+	counter uint64
+}
+
+func NewHashidsCodeGenerator(alphabet, salt string, minLength int) (ShortCodeGenerator, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	if err := checkLength(minLength); err != nil {
+		return nil, err
+	}
+	alphabet = consistentShuffle(alphabet, salt)
+	// One character of every code is the lottery character
+	offset := minValueForLength(minLength-1, alphabet)
+	seed, err := randomCounterSeed(minLength-1, alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return &HashidsCodeGenerator{
+		alphabet: alphabet,
+		salt:     salt,
+		offset:   offset,
+		// The counter starts at a random number, see randomCounterSeed
+		counter: seed - offset,
+	}, nil
+}
+
+func (g *HashidsCodeGenerator) Generate() (string, error) {
+	n := atomic.AddUint64(&g.counter, 1) + g.offset
+
+	// The lottery character picks the alphabet permutation for this number
+	lottery := g.alphabet[n%uint64(len(g.alphabet))]
+	alphabet := consistentShuffle(g.alphabet, string(lottery)+g.salt)
+	return string(lottery) + encode(n, alphabet), nil
+}
+
+// consistentShuffle permutes alphabet deterministically based on salt.
+// It is the shuffle used by hashids.
+func consistentShuffle(alphabet, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+	out := []byte(alphabet)
+	for i, v, p := len(out)-1, 0, 0; i > 0; i, v = i-1, v+1 {
+		v %= len(salt)
+		integer := int(salt[v])
+		p += integer
+		j := (integer + v + p) % i
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
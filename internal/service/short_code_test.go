@@ -0,0 +1,72 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortCodeGenerators(t *testing.T) {
+	const alphabet, length, codes = Base62Alphabet, 5, 10000
+
+	tests := []struct {
+		name string
+		new  func() (ShortCodeGenerator, error)
+		// Random codes have exactly the length, and may repeat as the store catches collisions.
+		// Counters may outgrow the minimum length, but never repeat
+		random bool
+	}{
+		{name: "random", new: func() (ShortCodeGenerator, error) { return NewRandomCodeGenerator(alphabet, length) }, random: true},
+		{name: "counter", new: func() (ShortCodeGenerator, error) { return NewCounterCodeGenerator(alphabet, length) }},
+		{name: "hashids", new: func() (ShortCodeGenerator, error) { return NewHashidsCodeGenerator(alphabet, "salt", length) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator, err := tt.new()
+			require.NoError(t, err)
+
+			seen := make(map[string]bool, codes)
+			for i := 0; i < codes; i++ {
+				code, err := generator.Generate()
+				require.NoError(t, err)
+
+				if tt.random {
+					assert.Len(t, code, length)
+				} else {
+					assert.GreaterOrEqual(t, len(code), length, code)
+				}
+				for _, r := range code {
+					require.True(t, strings.ContainsRune(alphabet, r), "%q is not in the alphabet", code)
+				}
+				require.False(t, seen[code] && !tt.random, "%q was generated twice", code)
+				seen[code] = true
+			}
+
+			// A second generator, like one of another replica started at the same time, starts elsewhere
+			other, err := tt.new()
+			require.NoError(t, err)
+			code, err := other.Generate()
+			require.NoError(t, err)
+			assert.False(t, seen[code], "%q was generated by both generators", code)
+		})
+	}
+}
+
+func TestShortCodeGeneratorConfig(t *testing.T) {
+	_, err := NewRandomCodeGenerator("abc", DefaultShortCodeLength)
+	assert.ErrorIs(t, err, ErrInvalidShortCodeConfig, "short alphabet")
+
+	_, err = NewRandomCodeGenerator(Base62Alphabet[:20]+"/", DefaultShortCodeLength)
+	assert.ErrorIs(t, err, ErrInvalidShortCodeConfig, "unsafe character")
+
+	_, err = NewCounterCodeGenerator(Base62Alphabet+"a", DefaultShortCodeLength)
+	assert.ErrorIs(t, err, ErrInvalidShortCodeConfig, "repeated character")
+
+	_, err = NewHashidsCodeGenerator(Base62Alphabet, "salt", 0)
+	assert.ErrorIs(t, err, ErrInvalidShortCodeConfig, "zero length")
+
+	_, err = NewRandomCodeGenerator(Base62Alphabet, maxShortCodeLength+1)
+	assert.ErrorIs(t, err, ErrInvalidShortCodeConfig, "too long")
+}
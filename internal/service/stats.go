@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gately/internal/dal"
+)
+
+type Granularity string
+
+const (
+	GranularityHour Granularity = "hour"
+	GranularityDay  Granularity = "day"
+	GranularityWeek Granularity = "week"
+
+	// Keeps a single response, and the zero filled buckets, bounded
+	maxStatsBuckets = 2000
+	// Keeps the clicks that a single request reads bounded
+	maxStatsRange = 366 * 24 * 3600
+
+	// Referrer domain of clicks without a Referer header
+	directReferrer = "direct"
+)
+
+var (
+	ErrInvalidGranularity = errors.New("Granularity must be hour, day or week")
+	ErrInvalidStatsRange  = errors.New("Invalid time range")
+	ErrStatsUnavailable   = errors.New("Click events are not recorded")
+)
+
+// StatsBucket is the number of clicks from Start until the next bucket starts
+type StatsBucket struct {
+	Start  int64 `json:"start"`
+	Clicks int64 `json:"clicks"`
+	// Estimated, for day and week buckets only. Visitors are kept per day for
+	// uniques.DayRetention, older buckets report none
+	UniqueVisitors *int64 `json:"unique_visitors,omitempty"`
+}
+
+// StatsCount is the number of clicks that share a referrer domain or device class
+type StatsCount struct {
+	Key    string `json:"key"`
+	Clicks int64  `json:"clicks"`
+}
+
+// UrlStats are the clicks on a short url between From (inclusive) and To (exclusive).
+// Buckets are aligned to UTC and weeks start on Monday. Empty buckets are included.
+type UrlStats struct {
+	ShortUrl    string        `json:"short_url"`
+	From        int64         `json:"from"`
+	To          int64         `json:"to"`
+	Granularity Granularity   `json:"granularity"`
+	Total       int64         `json:"total"`
+	Buckets     []StatsBucket `json:"buckets"`
+	Referrers   []StatsCount  `json:"referrers"`
+	Devices     []StatsCount  `json:"devices"`
+}
+
+// seconds is the length of a bucket
+func (g Granularity) seconds() int64 {
+	switch g {
+	case GranularityHour:
+		return 3600
+	case GranularityDay:
+		return 24 * 3600
+	case GranularityWeek:
+		return 7 * 24 * 3600
+	default:
+		return 0
+	}
+}
+
+// bucketStart returns the start of the bucket that contains ts
+func (g Granularity) bucketStart(ts int64) int64 {
+	size := g.seconds()
+	// The unix epoch is a Thursday. Shift by four days so that weeks start on Monday
+	var offset int64
+	if g == GranularityWeek {
+		offset = 4 * 24 * 3600
+	}
+	shifted := ts - offset
+	start := shifted - shifted%size
+	if shifted < 0 && shifted%size != 0 {
+		start -= size
+	}
+	return start + offset
+}
+
+// GetUrlStats counts the clicks on a short url per time bucket, referrer domain and device class
+func (uss *UrlShorteningService) GetUrlStats(ctx context.Context, shortUrl string, from, to int64, granularity Granularity) (*UrlStats, error) {
+
+	size := granularity.seconds()
+	if size == 0 {
+		return nil, fmt.Errorf("Unknown granularity %q. Err=%w", granularity, ErrInvalidGranularity)
+	}
+	if from < 0 || to <= from {
+		return nil, fmt.Errorf("from must be before to. Err=%w", ErrInvalidStatsRange)
+	}
+	if to-from > maxStatsRange {
+		return nil, fmt.Errorf("The range may span at most 366 days. Err=%w", ErrInvalidStatsRange)
+	}
+	first := granularity.bucketStart(from)
+	if (to-first+size-1)/size > maxStatsBuckets {
+		return nil, fmt.Errorf("At most %d %s buckets can be requested. Err=%w", maxStatsBuckets, granularity, ErrInvalidStatsRange)
+	}
+	if uss.clickStore == nil {
+		return nil, ErrStatsUnavailable
+	}
+
+	// Clicks of an earlier link with the same short url may still be stored, e.g. of one
+	// purged after it expired. Only the clicks since this link was created are its own
+	entry, err := uss.entryFor(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
+	since := from
+	if entry.CreatedTs > since {
+		since = entry.CreatedTs
+	}
+
+	stats := &UrlStats{
+		ShortUrl:    shortUrl,
+		From:        from,
+		To:          to,
+		Granularity: granularity,
+	}
+	for start := first; start < to; start += size {
+		stats.Buckets = append(stats.Buckets, StatsBucket{Start: start})
+	}
+
+	// Clicks are aggregated as they are read, so only the counts are held in memory
+	referrers := make(map[string]int64)
+	devices := make(map[string]int64)
+	err = uss.clickStore.StreamClickEvents(ctx, shortUrl, since, to, func(e *dal.ClickEvent) error {
+		stats.Total++
+		stats.Buckets[(granularity.bucketStart(e.Ts)-first)/size].Clicks++
+		referrers[referrerDomain(e.Referrer)]++
+		devices[string(ClassifyDevice(e.UserAgent))]++
+		return nil
+	})
+	if err != nil {
+		log.Printf("Unable to get click events for %s. Err=%v", shortUrl, err)
+		return nil, err
+	}
+	stats.Referrers = sortedCounts(referrers)
+	stats.Devices = sortedCounts(devices)
+
+	if uss.visitors != nil && granularity != GranularityHour {
+		uss.countBucketVisitors(ctx, shortUrl, stats.Buckets, size, since)
+	}
+	return stats, nil
+}
+
+// countBucketVisitors estimates the unique visitors of every bucket from the per day
+// sketches. Days that ended before since are left out.
+func (uss *UrlShorteningService) countBucketVisitors(ctx context.Context, shortUrl string, buckets []StatsBucket, size, since int64) {
+	day := GranularityDay.seconds()
+	periods := make([][]time.Time, len(buckets))
+	for i := range buckets {
+		for ts := buckets[i].Start; ts < buckets[i].Start+size; ts += day {
+			if ts+day > since {
+				periods[i] = append(periods[i], time.Unix(ts, 0))
+			}
+		}
+	}
+
+	visitors, err := uss.visitors.CountPeriods(ctx, shortUrl, periods...)
+	if err != nil {
+		// Best effort, the click counts are still returned
+		log.Printf("Unable to count unique visitors of %s. Err=%v", shortUrl, err)
+		return
+	}
+	for i := range buckets {
+		buckets[i].UniqueVisitors = &visitors[i]
+	}
+}
+
+// referrerDomain reduces a Referer header to its host, so that clicks from
+// different pages of the same site are counted together
+func referrerDomain(referrer string) string {
+	if referrer == "" {
+		return directReferrer
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// sortedCounts orders counts by clicks, most first, then by key
+func sortedCounts(counts map[string]int64) []StatsCount {
+	results := make([]StatsCount, 0, len(counts))
+	for key, clicks := range counts {
+		results = append(results, StatsCount{Key: key, Clicks: clicks})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Clicks != results[j].Clicks {
+			return results[i].Clicks > results[j].Clicks
+		}
+		return results[i].Key < results[j].Key
+	})
+	return results
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gately/internal/dal"
+	"gately/internal/multicache"
+	"gately/internal/uniques"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func unix(t *testing.T, value string) int64 {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339, value)
+	require.NoError(t, err)
+	return ts.Unix()
+}
+
+func TestBucketStart(t *testing.T) {
+	tests := []struct {
+		name        string
+		granularity Granularity
+		ts, start   string
+	}{
+		{"hour", GranularityHour, "2024-01-03T10:59:59Z", "2024-01-03T10:00:00Z"},
+		{"hour boundary", GranularityHour, "2024-01-03T10:00:00Z", "2024-01-03T10:00:00Z"},
+		{"day", GranularityDay, "2024-01-03T23:59:59Z", "2024-01-03T00:00:00Z"},
+		// Buckets are aligned to UTC, whatever the zone the time was given in
+		{"day in another zone", GranularityDay, "2024-01-03T23:30:00-05:00", "2024-01-04T00:00:00Z"},
+		{"week from a wednesday", GranularityWeek, "2024-01-03T12:00:00Z", "2024-01-01T00:00:00Z"},
+		{"week from a monday", GranularityWeek, "2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z"},
+		{"week from a sunday", GranularityWeek, "2024-01-07T23:59:59Z", "2024-01-01T00:00:00Z"},
+		// The epoch is a Thursday, its week started on the Monday before
+		{"week of the epoch", GranularityWeek, "1970-01-01T00:00:00Z", "1969-12-29T00:00:00Z"},
+		{"day before the epoch", GranularityDay, "1969-12-31T12:00:00Z", "1969-12-31T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.granularity.bucketStart(unix(t, tt.ts))
+			assert.Equal(t, unix(t, tt.start), start, time.Unix(start, 0).UTC().String())
+		})
+	}
+}
+
+func TestClassifyDevice(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		device    DeviceClass
+	}{
+		{"", DeviceUnknown},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", DeviceBot},
+		{"curl/8.4.0", DeviceBot},
+		{"Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", DeviceTablet},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 Chrome/118.0 Safari/537.36", DeviceTablet},
+		{"Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 Chrome/118.0 Mobile Safari/537.36", DeviceMobile},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15", DeviceMobile},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/118.0 Safari/537.36", DeviceDesktop},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.device, ClassifyDevice(tt.userAgent), tt.userAgent)
+	}
+}
+
+func TestReferrerDomain(t *testing.T) {
+	tests := []struct {
+		referrer, domain string
+	}{
+		{"", directReferrer},
+		{"https://www.Example.com/some/page?q=1", "example.com"},
+		{"https://news.example.com/", "news.example.com"},
+		{"http://example.com:8080/", "example.com"},
+		{"not a url", "unknown"},
+		{"://broken", "unknown"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.domain, referrerDomain(tt.referrer), tt.referrer)
+	}
+}
+
+func TestGetUrlStats(t *testing.T) {
+	ctx := context.Background()
+	store := dal.NewMemoryUrlStore()
+	clickStore := dal.NewMemoryClickStore()
+	uss := New(
+		WithMultiCache(multicache.New(nil)),
+		WithUrlStore(store),
+		WithClickStore(clickStore),
+	)
+	// Only clicks since the link was created are counted, so it must predate them
+	monday := unix(t, "2024-01-01T00:00:00Z")
+	entry := &dal.UrlMappingEntry{ShortUrl: "abc123", LongUrl: "https://example.com", CreatedTs: monday}
+	require.NoError(t, store.AddUrlEntry(ctx, entry))
+
+	day := GranularityDay.seconds()
+	require.NoError(t, clickStore.AddClickEvents(ctx, []*dal.ClickEvent{
+		{ShortUrl: entry.ShortUrl, Ts: monday + 10, Referrer: "https://www.example.org/a", UserAgent: "curl/8.4.0"},
+		{ShortUrl: entry.ShortUrl, Ts: monday + 20, Referrer: "https://example.org/b"},
+		{ShortUrl: entry.ShortUrl, Ts: monday + 2*day},
+		// Outside of the range
+		{ShortUrl: entry.ShortUrl, Ts: monday + 3*day},
+	}))
+
+	stats, err := uss.GetUrlStats(ctx, entry.ShortUrl, monday, monday+3*day, GranularityDay)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Total)
+	assert.Equal(t, []StatsBucket{
+		{Start: monday, Clicks: 2},
+		{Start: monday + day},
+		{Start: monday + 2*day, Clicks: 1},
+	}, stats.Buckets)
+	assert.Equal(t, []StatsCount{{Key: "example.org", Clicks: 2}, {Key: directReferrer, Clicks: 1}}, stats.Referrers)
+	assert.Equal(t, []StatsCount{{Key: string(DeviceUnknown), Clicks: 2}, {Key: string(DeviceBot), Clicks: 1}}, stats.Devices)
+
+	_, err = uss.GetUrlStats(ctx, entry.ShortUrl, monday, monday+400*day, GranularityWeek)
+	assert.ErrorIs(t, err, ErrInvalidStatsRange)
+	_, err = uss.GetUrlStats(ctx, entry.ShortUrl, monday, monday, GranularityDay)
+	assert.ErrorIs(t, err, ErrInvalidStatsRange)
+	_, err = uss.GetUrlStats(ctx, entry.ShortUrl, monday, monday+day, "month")
+	assert.ErrorIs(t, err, ErrInvalidGranularity)
+}
+
+func TestGetUrlStatsOfReusedShortUrl(t *testing.T) {
+	workspaces := dal.NewMemoryWorkspaceStore()
+	for _, id := range []string{"team-a", "team-b"} {
+		ws, err := NewWorkspace(id, id, "", 0, "")
+		require.NoError(t, err)
+		require.NoError(t, workspaces.AddWorkspace(context.Background(), ws))
+	}
+	clickStore := dal.NewMemoryClickStore()
+	visitors := uniques.NewMemoryCounter()
+	uss := New(
+		WithMultiCache(multicache.New(nil)),
+		WithUrlStore(dal.NewMemoryUrlStore()),
+		WithClickStore(clickStore),
+		WithUniqueCounter(visitors),
+		WithWorkspaceStore(workspaces),
+	)
+	teamA := workspaceContext("team-a", "alice")
+	teamB := workspaceContext("team-b", "bob")
+
+	now := time.Now()
+	day := GranularityDay.seconds()
+	from, to := now.Unix()-day, now.Unix()+day
+
+	entry, _, err := uss.CreateUrlMapping(teamA, "https://example.com", MappingOptions{Alias: "launch"})
+	require.NoError(t, err)
+	require.NoError(t, clickStore.AddClickEvents(context.Background(), []*dal.ClickEvent{
+		{ShortUrl: entry.ShortUrl, Ts: now.Unix(), Referrer: "https://example.org/a"},
+	}))
+	require.NoError(t, visitors.Add(context.Background(), entry.ShortUrl, now, "fp-1", "fp-2"))
+
+	stats, err := uss.GetUrlStats(teamA, entry.ShortUrl, from, to, GranularityDay)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Total)
+
+	// team-b takes the alias over once team-a deleted its link
+	require.NoError(t, uss.DeleteUrlMapping(teamA, entry.ShortUrl))
+	other, created, err := uss.CreateUrlMapping(teamB, "https://example.net", MappingOptions{Alias: "launch"})
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, entry.ShortUrl, other.ShortUrl)
+
+	// A click left over from before the link was created is not counted either
+	require.NoError(t, clickStore.AddClickEvents(context.Background(), []*dal.ClickEvent{
+		{ShortUrl: other.ShortUrl, Ts: other.CreatedTs - 60},
+	}))
+
+	stats, err = uss.GetUrlStats(teamB, other.ShortUrl, from, to, GranularityDay)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Total)
+	assert.Empty(t, stats.Referrers)
+	assert.Empty(t, stats.Devices)
+	for _, bucket := range stats.Buckets {
+		assert.Zero(t, bucket.Clicks)
+		require.NotNil(t, bucket.UniqueVisitors)
+		assert.Zero(t, *bucket.UniqueVisitors)
+	}
+}
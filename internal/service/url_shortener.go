@@ -2,104 +2,310 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"net/url"
-	"strings"
+	"net/http"
 	"time"
 
+	"gately/internal/canonical"
+	"gately/internal/clicks"
 	"gately/internal/dal"
+	"gately/internal/multicache"
+	"gately/internal/uniques"
 	"github.com/eko/gocache/v3/cache"
-	"github.com/google/uuid"
+	"github.com/eko/gocache/v3/store"
 )
 
 const (
-	appPrefix = "gate.ly"
+	// How many times a freshly generated short code may collide before giving up
+	maxShortCodeAttempts = 5
+
+	// Temporary, so that clients keep coming back and every visit is counted
+	DefaultRedirectType = http.StatusFound
+)
+
+var (
+	ErrShortCodeExhausted = errors.New("Unable to generate a unique short code")
+	ErrInvalidExpiry      = errors.New("The expiry must be in the future")
+	ErrEmptyUpdate        = errors.New("Nothing to update")
 )
 
+// MappingOptions are the optional settings of a new URL mapping
+type MappingOptions struct {
+	// Vanity short code requested by the client. A code is generated when empty
+	Alias string
+	// Unix time from which the short URL stops redirecting. Zero means never
+	ExpiresAt int64
+	// HTTP status of the redirects. Zero means the server default
+	RedirectType int
+	// Custom domain the short url is served from. Empty means the default domain
+	Domain string
+}
+
 type UrlShortener interface {
-	CreateUrlMapping(ctx context.Context, url string) (string, error)
+	// CreateUrlMapping returns the new mapping, whose short url ShortLink turns into a link.
+	// Under the return-existing dedupe policy it may return an existing mapping instead,
+	// which is reported by created being false.
+	CreateUrlMapping(ctx context.Context, url string, opts MappingOptions) (entry *dal.UrlMappingEntry, created bool, err error)
+	UpdateUrlMapping(ctx context.Context, shortUrl string, update *dal.UrlEntryUpdate) (*dal.UrlMappingEntry, error)
+	GetUrlHistory(ctx context.Context, shortUrl string) ([]UrlVersion, error)
+	RollbackUrlMapping(ctx context.Context, shortUrl string, version int, actor string) (*dal.UrlMappingEntry, error)
 	DeleteUrlMapping(ctx context.Context, url string) error
-	RedirectUrl(ctx context.Context, shortUrl string) (string, error)
-	CheckAndSanitizeUrl(longUrl string) (string, bool)
-	GetUrlMetrics(ctx context.Context, start, end int64, asc bool) ([]*dal.UrlMappingEntry, error)
+	RedirectUrl(ctx context.Context, shortUrl string, visit Visit) (*Redirect, error)
+	CanonicalizeUrl(longUrl string) (string, error)
+	ShortUrlFor(ctx context.Context, host, code string) string
+	ShortLink(ctx context.Context, shortUrl, defaultBase string) string
+	GetUrlMetrics(ctx context.Context, query dal.MetricsQuery) (*MetricsPage, error)
+	GetUrlStats(ctx context.Context, shortUrl string, from, to int64, granularity Granularity) (*UrlStats, error)
 }
 
 type UrlShorteningService struct {
 	UrlShortener
 	cache *cache.ChainCache[string]
 	store dal.UrlStore
+	// Source of the per link analytics
+	clickStore dal.ClickStore
+	visitors   uniques.Counter
+	generator  ShortCodeGenerator
+	clicks     *clicks.Pipeline
+	// Settings of the workspaces, such as short code prefixes and quotas
+	workspaces dal.WorkspaceStore
+	// Custom domains that links are created on and redirects are resolved with
+	domains *domainRegistry
+	// Brings long urls into the form they are stored and deduplicated in
+	canonicalizer *canonical.Canonicalizer
+	// Key for hashing client IPs in click events
+	ipSalt []byte
+	// Redirect status of links that do not set their own
+	defaultRedirectType int
+	// How long urls that are already shortened are treated in workspaces without a policy
+	defaultDedupePolicy dal.DedupePolicy
 }
 
 func New(opts ...Option) *UrlShorteningService {
 
-	service := &UrlShorteningService{}
+	// Random base62 codes unless a generator is injected
+	generator, _ := NewRandomCodeGenerator(Base62Alphabet, DefaultShortCodeLength)
+	service := &UrlShorteningService{
+		generator:           generator,
+		ipSalt:              newIpSalt(),
+		defaultRedirectType: DefaultRedirectType,
+		defaultDedupePolicy: dal.DedupeReject,
+		// www.example.com and example.com are one long url unless configured otherwise
+		canonicalizer: canonical.New(canonical.WithoutWwwPrefix()),
+	}
 	for _, opt := range opts {
 		opt(service)
 	}
 	return service
 }
 
-func (uss *UrlShorteningService) GetUrlMetrics(ctx context.Context, start, end int64, asc bool) ([]*dal.UrlMappingEntry, error) {
+// CanonicalizeUrl validates a long url and brings it into its canonical form,
+// so that spellings of the same URL are deduplicated
+func (uss *UrlShorteningService) CanonicalizeUrl(longUrl string) (string, error) {
 
-	return uss.store.GetUrlMetrics(ctx, start, end, asc)
+	canonicalUrl, err := uss.canonicalizer.Canonicalize(longUrl)
+	if err != nil {
+		log.Printf("Rejecting long URL %q. Err=%v", longUrl, err)
+		return "", err
+	}
+	return canonicalUrl, nil
 }
 
-func (uss *UrlShorteningService) CheckAndSanitizeUrl(longUrl string) (string, bool) {
+func (uss *UrlShorteningService) CreateUrlMapping(ctx context.Context, longUrl string, opts MappingOptions) (*dal.UrlMappingEntry, bool, error) {
+
+	if opts.ExpiresAt != 0 && opts.ExpiresAt <= time.Now().Unix() {
+		log.Printf("Rejecting expiry %d for %s", opts.ExpiresAt, longUrl)
+		return nil, false, ErrInvalidExpiry
+	}
+	if err := CheckRedirectType(opts.RedirectType); err != nil {
+		return nil, false, err
+	}
+
+	ws, err := uss.workspaceFor(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	// Short codes of a workspace with a prefix, aliases included, all start with it
+	prefix := ""
+	if ws != nil {
+		prefix = ws.ShortCodePrefix
+	}
+	host := ""
+	if opts.Domain != "" {
+		domain, err := uss.domainFor(ctx, opts.Domain)
+		if err != nil {
+			return nil, false, err
+		}
+		host = domain.Host
+	}
+	if opts.Alias != "" {
+		if err := CheckAlias(prefix, opts.Alias); err != nil {
+			log.Printf("Rejecting alias %s. Err=%v", opts.Alias, err)
+			return nil, false, err
+		}
+	}
+
+	policy := uss.dedupePolicyFor(ws)
+	if policy == dal.DedupeReturnExisting {
+		// Before the quota, so that retries succeed in a full workspace
+		existing, err := uss.existingMapping(ctx, longUrl, host, prefix, opts)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing != nil {
+			return existing, false, nil
+		}
+	}
+	if err := uss.checkQuota(ctx, ws); err != nil {
+		return nil, false, err
+	}
 
-	_, err := url.Parse(longUrl)
+	entry, err := uss.createUrlEntry(ctx, longUrl, host, prefix, policy, opts)
+	if errors.Is(err, dal.ErrUrlEntryAlreadyExists) && policy == dal.DedupeReturnExisting {
+		// Another create of the same long url got there first
+		existing, lookupErr := uss.existingMapping(ctx, longUrl, host, prefix, opts)
+		if lookupErr != nil {
+			return nil, false, lookupErr
+		}
+		if existing != nil {
+			return existing, false, nil
+		}
+	}
 	if err != nil {
-		log.Printf("CheckUrl returning false. Err=%w", err)
-		return "", false
+		return nil, false, err
 	}
+	return entry, true, nil
+}
 
-	// Remove "www" to maintain uniformity
-	// This will avoid duplicate entries for www.apple.com and apple.com
-	longUrl = strings.Replace(longUrl, "www.", "", 1)
+// createUrlEntry stores a new mapping of longUrl under the requested alias, or a generated short code
+func (uss *UrlShorteningService) createUrlEntry(ctx context.Context, longUrl, host, prefix string, policy dal.DedupePolicy, opts MappingOptions) (*dal.UrlMappingEntry, error) {
 
-	// Remove the trailing slash. Again, to eliminate duplicates
-	longUrl = strings.TrimSuffix(longUrl, "/")
-	if strings.HasPrefix(longUrl, "https") {
-		return longUrl, true
+	dedupeKey := ""
+	if policy != dal.DedupeAllowDuplicates {
+		dedupeKey = dal.DedupeKey(workspaceFrom(ctx), host, longUrl)
 	}
-	if strings.HasPrefix(longUrl, "http") {
-		return longUrl, true
+
+	if opts.Alias != "" {
+		// Aliases only need to be unique on their own domain
+		alias := dal.ShortKey(host, prefix+opts.Alias)
+		entry, err := uss.addUrlEntry(ctx, longUrl, alias, dedupeKey, opts)
+		if err == dal.ErrShortUrlAlreadyExists {
+			log.Printf("Alias %s is already taken", alias)
+			return nil, fmt.Errorf("Alias %s is already taken. Err=%w", alias, ErrAliasTaken)
+		}
+		return entry, err
 	}
 
-	// default to https if no protocol is specified in the incoming URL
+	for attempt := 1; attempt <= maxShortCodeAttempts; attempt++ {
+		code, err := uss.generator.Generate()
+		if err != nil {
+			log.Printf("Unable to generate a short code. Err=%v", err)
+			return nil, err
+		}
+		code = prefix + code
+		shortUrl := dal.ShortKey(host, code)
+
+		// Skip codes that are reserved or known to be taken. The store still rejects
+		// a collision that races with this check, which is retried as well
+		if isReserved(code) || uss.store.CheckIfUrlExists(ctx, shortUrl, false) {
+			log.Printf("Short code %s collided on attempt %d", shortUrl, attempt)
+			continue
+		}
 
-	return "https://" + longUrl, true
-}
+		entry, err := uss.addUrlEntry(ctx, longUrl, shortUrl, dedupeKey, opts)
+		if err == dal.ErrShortUrlAlreadyExists {
+			log.Printf("Short code %s collided on attempt %d", shortUrl, attempt)
+			continue
+		}
+		return entry, err
+	}
 
-func (uss *UrlShorteningService) CreateUrlMapping(ctx context.Context, longUrl string) (string, error) {
+	log.Printf("Giving up on %s after %d short code collisions", longUrl, maxShortCodeAttempts)
+	return nil, ErrShortCodeExhausted
+}
 
-	shortUrl := uuid.New()
+// addUrlEntry stores a new mapping of shortUrl to longUrl.
+// dal.ErrShortUrlAlreadyExists is returned unwrapped so that callers can retry.
+func (uss *UrlShorteningService) addUrlEntry(ctx context.Context, longUrl, shortUrl, dedupeKey string, opts MappingOptions) (*dal.UrlMappingEntry, error) {
 
-	err := uss.store.AddUrlEntry(ctx, &dal.UrlMappingEntry{
+	entry := &dal.UrlMappingEntry{
 		LongUrl:      longUrl,
-		ShortUrl:     shortUrl.String(),
+		ShortUrl:     shortUrl,
 		Hits:         1,
 		CreatedTs:    time.Now().Unix(),
 		LastAccessed: time.Now().Unix(),
-	})
+		ExpiresAt:    opts.ExpiresAt,
+		RedirectType: opts.RedirectType,
+		Owner:        ownerFrom(ctx),
+		Workspace:    workspaceFrom(ctx),
+		DedupeKey:    dedupeKey,
+	}
+	err := uss.store.AddUrlEntry(ctx, entry)
+
+	switch err {
+	case nil:
+		return entry, nil
+	case dal.ErrShortUrlAlreadyExists:
+		return nil, err
+	case dal.ErrUrlEntryAlreadyExists:
+		log.Printf("A URL already exists for %s", longUrl)
+		return nil, fmt.Errorf("A URL already exists. Err=%w", err)
+	default:
+		log.Printf("Unable to add URL mapping into the UrlStore")
+		return nil, err
+	}
+}
 
-	if err != nil {
-		switch err {
-		case dal.ErrUrlEntryAlreadyExists:
-			log.Printf("A URL already exists for %s", longUrl)
-			return "", fmt.Errorf("A URL already exists. Err=%w", err)
-		default:
-			log.Printf("Unable to add URL mapping into the UrlStore")
-			return "", err
+// UpdateUrlMapping retargets a short url or changes its expiry.
+// The long url in update is expected to be sanitized already.
+func (uss *UrlShorteningService) UpdateUrlMapping(ctx context.Context, shortUrl string, update *dal.UrlEntryUpdate) (*dal.UrlMappingEntry, error) {
+
+	if update.LongUrl == nil && update.ExpiresAt == nil && update.RedirectType == nil {
+		return nil, ErrEmptyUpdate
+	}
+	if update.RedirectType != nil {
+		if err := CheckRedirectType(*update.RedirectType); err != nil {
+			return nil, err
 		}
 	}
+	if update.ExpiresAt != nil && *update.ExpiresAt != 0 && *update.ExpiresAt <= time.Now().Unix() {
+		log.Printf("Rejecting expiry %d for %s", *update.ExpiresAt, shortUrl)
+		return nil, ErrInvalidExpiry
+	}
+	checked, err := uss.checkOwner(ctx, shortUrl)
+	if err != nil {
+		return nil, err
+	}
 
-	// Return the newly created short url
-	return fmt.Sprintf("%s/%s", appPrefix, shortUrl.String()), nil
+	// The link may have been deleted and created again by someone else in the meantime
+	conditional := *update
+	conditional.UrlEntryCondition = checkedCondition(checked)
+	entry, err := uss.store.UpdateUrlEntry(ctx, shortUrl, &conditional)
+	if err != nil {
+		log.Printf("Unable to update URL mapping for %s. Err=%v", shortUrl, err)
+		return nil, err
+	}
+
+	// Drop the cached destination from both tiers so that redirects pick up the change
+	if err := uss.cache.Delete(ctx, shortUrl); err != nil {
+		log.Printf("Clearing cached URL entry failed for %s. Err=%v", shortUrl, err)
+	}
+	return entry, nil
 }
 
 func (uss *UrlShorteningService) DeleteUrlMapping(ctx context.Context, shortUrl string) error {
 
+	checked, err := uss.checkOwner(ctx, shortUrl)
+	if errors.Is(err, dal.ErrUrlEntryNotFound) {
+		// Deleting a missing entry is not an error
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
 	cached, err := uss.cache.Get(ctx, shortUrl)
 
 	if err == nil {
@@ -107,41 +313,122 @@ func (uss *UrlShorteningService) DeleteUrlMapping(ctx context.Context, shortUrl
 		err = uss.cache.Delete(ctx, shortUrl)
 		if err != nil {
 			// If for some reason, we are unable to delete the cached entry, Just log.
-			// The stale entry will be gone in 3 mins
+			// The stale entry will be gone once it expires, see multicache.EntryTTL
 			log.Printf("Clearing cached URL entry failed for %s. Cached=%s", shortUrl, cached)
 		}
 	}
-	return uss.store.DeleteUrlEntry(ctx, shortUrl)
-}
-
-func (uss *UrlShorteningService) RedirectUrl(ctx context.Context, shortUrl string) (string, error) {
-
-	// Update metrics when a redirect is successful
-	// This will run even if the redirect is rendered from the cache
-	defer func(ctx context.Context, c dal.UrlStore, shortUrl string) {
-		err := c.UpdateUrlHitCount(ctx, shortUrl)
+	// The link may have been deleted and created again by someone else in the meantime
+	cond := checkedCondition(checked)
+	err = uss.store.DeleteUrlEntry(ctx, shortUrl, &cond)
+	if errors.Is(err, dal.ErrUrlEntryNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			log.Printf("Unable to update hit count for %s", shortUrl)
+	// The short url may be taken again, so the clicks and visitors of this link must go with it.
+	// Failing that is only logged, stats are clamped to the creation of the link anyway
+	if uss.clickStore != nil {
+		if err := uss.clickStore.DeleteClickEvents(ctx, shortUrl); err != nil {
+			log.Printf("Unable to delete click events of %s. Err=%v", shortUrl, err)
+		}
+	}
+	if uss.visitors != nil {
+		if err := uss.visitors.Delete(ctx, shortUrl); err != nil {
+			log.Printf("Unable to delete unique visitors of %s. Err=%v", shortUrl, err)
 		}
-	}(ctx, uss.store, shortUrl)
+	}
+	return nil
+}
 
-	cached, err := uss.cache.Get(ctx, shortUrl)
+func (uss *UrlShorteningService) RedirectUrl(ctx context.Context, shortUrl string, visit Visit) (*Redirect, error) {
 
+	value, err := uss.cache.Get(ctx, shortUrl)
 	if err == nil {
-		log.Printf("Cached URL entry found for %s. Cached=%s", shortUrl, cached)
+		cached, err := decodeCachedRedirect(value)
+		if err == nil {
+			log.Printf("Cached URL entry found for %s. Cached=%s", shortUrl, value)
+			// The cache TTL is set by whichever instance cached the entry, whose clock may be behind
+			if cached.isExpired(time.Now().Unix()) {
+				log.Printf("Short URL %s expired at %d", shortUrl, cached.ExpiresAt)
+				return nil, dal.ErrUrlEntryExpired
+			}
+			uss.recordHit(ctx, shortUrl, visit)
+
+			return uss.redirectFor(cached.LongUrl, cached.RedirectType, cached.ExpiresAt), nil
+		}
+		log.Printf("Ignoring unreadable cached URL entry for %s. Err=%v", shortUrl, err)
+	}
 
-		return cached, nil
+	entry, err := uss.store.GetUrlEntry(ctx, shortUrl)
+	if err != nil {
+		log.Printf("Unable to get Long URL %v", err)
+		return nil, err
 	}
 
-	mapped, err := uss.store.GetMappedUrl(ctx, shortUrl)
-	log.Printf("Short URL %s --> Long URL %s", shortUrl, mapped)
+	now := time.Now()
+	if entry.IsExpired(now.Unix()) {
+		log.Printf("Short URL %s expired at %d", shortUrl, entry.ExpiresAt)
+		return nil, dal.ErrUrlEntryExpired
+	}
+	log.Printf("Short URL %s --> Long URL %s", shortUrl, entry.LongUrl)
 
-	_ = uss.cache.Set(ctx, shortUrl, mapped)
+	_ = uss.cache.Set(ctx, shortUrl, encodeCachedRedirect(entry), cacheOptions(entry, now)...)
+	uss.recordHit(ctx, shortUrl, visit)
 
-	if err != nil || mapped == "" {
-		log.Printf("Unable to get Long URL %v", err)
-		return "", err
+	return uss.redirectFor(entry.LongUrl, entry.RedirectType, entry.ExpiresAt), nil
+}
+
+// recordHit counts a successful redirect. With a click pipeline the hit, and the
+// click event, is written in the background. Otherwise only the hit count is
+// updated, right away.
+func (uss *UrlShorteningService) recordHit(ctx context.Context, shortUrl string, visit Visit) {
+	if uss.clicks != nil {
+		uss.clicks.Record(uss.clickEvent(shortUrl, visit))
+		return
+	}
+	if err := uss.store.UpdateUrlHitCount(ctx, shortUrl); err != nil {
+		log.Printf("Unable to update hit count for %s", shortUrl)
+	}
+}
+
+// cacheOptions caps how long an expiring entry may be cached, so that
+// neither cache tier keeps redirecting once the link has expired.
+// Other entries are kept for the default multicache.EntryTTL.
+func cacheOptions(entry *dal.UrlMappingEntry, now time.Time) []store.Option {
+	if entry.ExpiresAt == 0 {
+		return nil
+	}
+	ttl := time.Unix(entry.ExpiresAt, 0).Sub(now)
+	if ttl > multicache.EntryTTL {
+		ttl = multicache.EntryTTL
+	}
+	return []store.Option{store.WithExpiration(ttl)}
+}
+
+// RunExpirySweeper purges links that expired more than retention ago, once every interval.
+// Links that expired within the retention window keep answering 410 Gone.
+// It blocks until ctx is done.
+func (uss *UrlShorteningService) RunExpirySweeper(ctx context.Context, interval, retention time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := time.Now().Add(-retention).Unix()
+			deleted, err := uss.store.DeleteExpiredUrlEntries(ctx, before)
+			if err != nil {
+				log.Printf("Unable to purge expired URL entries. Err=%v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Purged %d URL entries that expired before %d", deleted, before)
+			}
+		}
 	}
-	return mapped, nil
 }
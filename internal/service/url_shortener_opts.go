@@ -1,7 +1,10 @@
 package service
 
 import (
+	"gately/internal/canonical"
+	"gately/internal/clicks"
 	"gately/internal/dal"
+	"gately/internal/uniques"
 	"github.com/eko/gocache/v3/cache"
 )
 
@@ -18,3 +21,80 @@ func WithUrlStore(store dal.UrlStore) Option {
 		service.store = store
 	}
 }
+
+// WithClickStore is where the per link analytics are read from
+func WithClickStore(store dal.ClickStore) Option {
+	return func(service *UrlShorteningService) {
+		service.clickStore = store
+	}
+}
+
+// WithUniqueCounter adds unique visitor estimates to the metrics and stats
+func WithUniqueCounter(counter uniques.Counter) Option {
+	return func(service *UrlShorteningService) {
+		service.visitors = counter
+	}
+}
+
+// WithWorkspaceStore applies the short code prefix and quota of the caller's workspace
+func WithWorkspaceStore(store dal.WorkspaceStore) Option {
+	return func(service *UrlShorteningService) {
+		service.workspaces = store
+	}
+}
+
+// WithDomainStore lets links be created on, and redirected from, custom domains
+func WithDomainStore(store dal.DomainStore) Option {
+	return func(service *UrlShorteningService) {
+		service.domains = newDomainRegistry(store)
+	}
+}
+
+// WithCanonicalizer sets how long urls are validated and canonicalized
+func WithCanonicalizer(canonicalizer *canonical.Canonicalizer) Option {
+	return func(service *UrlShorteningService) {
+		service.canonicalizer = canonicalizer
+	}
+}
+
+func WithShortCodeGenerator(generator ShortCodeGenerator) Option {
+	return func(service *UrlShorteningService) {
+		service.generator = generator
+	}
+}
+
+// WithClickPipeline moves hit counting off the redirect path
+func WithClickPipeline(pipeline *clicks.Pipeline) Option {
+	return func(service *UrlShorteningService) {
+		service.clicks = pipeline
+	}
+}
+
+// WithDefaultRedirectType sets the redirect status of links that do not set their own
+func WithDefaultRedirectType(status int) Option {
+	return func(service *UrlShorteningService) {
+		if status != 0 {
+			service.defaultRedirectType = status
+		}
+	}
+}
+
+// WithDedupePolicy sets how long urls that are already shortened are treated
+// in workspaces that do not set their own policy
+func WithDedupePolicy(policy dal.DedupePolicy) Option {
+	return func(service *UrlShorteningService) {
+		if policy != "" {
+			service.defaultDedupePolicy = policy
+		}
+	}
+}
+
+// WithIpHashSalt keys the hash of client IPs in click events.
+// A stable salt keeps the hashes comparable across restarts and replicas.
+func WithIpHashSalt(salt string) Option {
+	return func(service *UrlShorteningService) {
+		if salt != "" {
+			service.ipSalt = []byte(salt)
+		}
+	}
+}
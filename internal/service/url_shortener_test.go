@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gately/internal/auth"
+	"gately/internal/clicks"
+	"gately/internal/dal"
+	"gately/internal/multicache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(t *testing.T) (*UrlShorteningService, dal.UrlStore, dal.ClickStore) {
+	t.Helper()
+
+	store := dal.NewMemoryUrlStore()
+	clickStore := dal.NewMemoryClickStore()
+	// No Redis host, so only the in-memory cache tier is used
+	uss := New(
+		WithMultiCache(multicache.New(nil)),
+		WithUrlStore(store),
+		WithClickPipeline(clicks.New(clicks.WithUrlStore(store), clicks.WithClickStore(clickStore))),
+	)
+	return uss, store, clickStore
+}
+
+func TestRedirectUrlNotFound(t *testing.T) {
+	uss, _, _ := newTestService(t)
+
+	_, err := uss.RedirectUrl(context.Background(), "missing", Visit{})
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+}
+
+// failingLongUrlStore cannot look up long urls
+type failingLongUrlStore struct {
+	dal.UrlStore
+}
+
+func (s *failingLongUrlStore) GetUrlEntryByLongUrl(ctx context.Context, workspace, host, longUrl string) (*dal.UrlMappingEntry, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestCreateUrlMappingDedupePolicies(t *testing.T) {
+	ctx := context.Background()
+	const longUrl = "https://example.com"
+
+	tests := []struct {
+		policy dal.DedupePolicy
+		// Whether the second create of longUrl makes a new mapping, or returns the first
+		created, existing bool
+	}{
+		{policy: dal.DedupeReject},
+		{policy: dal.DedupeReturnExisting, existing: true},
+		{policy: dal.DedupeAllowDuplicates, created: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			store := dal.NewMemoryUrlStore()
+			domains := dal.NewMemoryDomainStore()
+			domain, err := NewDomain("go.acme.com", dal.DefaultWorkspace, "")
+			require.NoError(t, err)
+			require.NoError(t, domains.AddDomain(ctx, domain))
+			uss := New(
+				WithMultiCache(multicache.New(nil)),
+				WithUrlStore(store),
+				WithDomainStore(domains),
+				WithDedupePolicy(tt.policy),
+			)
+			first, created, err := uss.CreateUrlMapping(ctx, longUrl, MappingOptions{})
+			require.NoError(t, err)
+			require.True(t, created)
+
+			// Each domain has its own link to the long url
+			onDomain, created, err := uss.CreateUrlMapping(ctx, longUrl, MappingOptions{Domain: "go.acme.com"})
+			require.NoError(t, err)
+			assert.True(t, created)
+			again, created, err := uss.CreateUrlMapping(ctx, longUrl, MappingOptions{Domain: "go.acme.com"})
+			switch {
+			case tt.existing:
+				require.NoError(t, err)
+				assert.False(t, created)
+				assert.Equal(t, onDomain.ShortUrl, again.ShortUrl)
+			case tt.created:
+				require.NoError(t, err)
+				assert.True(t, created)
+			default:
+				assert.ErrorIs(t, err, dal.ErrUrlEntryAlreadyExists)
+			}
+
+			second, created, err := uss.CreateUrlMapping(ctx, longUrl, MappingOptions{})
+			if !tt.created && !tt.existing {
+				assert.ErrorIs(t, err, dal.ErrUrlEntryAlreadyExists)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.created, created)
+				if tt.existing {
+					assert.Equal(t, first.ShortUrl, second.ShortUrl)
+				} else {
+					assert.NotEqual(t, first.ShortUrl, second.ShortUrl)
+				}
+			}
+
+			// An existing mapping under another alias is not what was asked for
+			_, _, err = uss.CreateUrlMapping(ctx, longUrl, MappingOptions{Alias: "other"})
+			if tt.created {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, dal.ErrUrlEntryAlreadyExists)
+			}
+
+			// An expired mapping no longer holds on to its long url
+			expired := time.Now().Unix() - 1
+			_, err = store.UpdateUrlEntry(ctx, first.ShortUrl, &dal.UrlEntryUpdate{ExpiresAt: &expired})
+			require.NoError(t, err)
+			renewed, created, err := uss.CreateUrlMapping(ctx, longUrl, MappingOptions{})
+			require.NoError(t, err)
+			assert.True(t, created)
+			assert.NotEqual(t, first.ShortUrl, renewed.ShortUrl)
+		})
+	}
+
+	t.Run("store error", func(t *testing.T) {
+		uss := New(
+			WithMultiCache(multicache.New(nil)),
+			WithUrlStore(&failingLongUrlStore{UrlStore: dal.NewMemoryUrlStore()}),
+			WithDedupePolicy(dal.DedupeReturnExisting),
+		)
+		_, _, err := uss.CreateUrlMapping(ctx, longUrl, MappingOptions{})
+		assert.EqualError(t, err, "connection refused")
+	})
+}
+
+func TestUpdateUrlMappingChecksOwner(t *testing.T) {
+	uss, store, _ := newTestService(t)
+	alice := auth.NewContext(context.Background(), &auth.Principal{KeyId: "k1", Owner: "alice", Workspace: dal.DefaultWorkspace})
+	bob := auth.NewContext(context.Background(), &auth.Principal{KeyId: "k2", Owner: "bob", Workspace: dal.DefaultWorkspace})
+	admin := auth.NewContext(context.Background(), &auth.Principal{KeyId: "k3", Owner: "ops", Admin: true, Workspace: dal.DefaultWorkspace})
+
+	entry, _, err := uss.CreateUrlMapping(alice, "https://example.com", MappingOptions{})
+	require.NoError(t, err)
+
+	longUrl := "https://example.com/bob"
+	_, err = uss.UpdateUrlMapping(bob, entry.ShortUrl, &dal.UrlEntryUpdate{LongUrl: &longUrl})
+	assert.ErrorIs(t, err, ErrNotOwner)
+	assert.ErrorIs(t, uss.DeleteUrlMapping(bob, entry.ShortUrl), ErrNotOwner)
+
+	for _, ctx := range []context.Context{alice, admin} {
+		longUrl := "https://example.com/" + ownerFrom(ctx)
+		updated, err := uss.UpdateUrlMapping(ctx, entry.ShortUrl, &dal.UrlEntryUpdate{LongUrl: &longUrl})
+		require.NoError(t, err)
+		assert.Equal(t, longUrl, updated.LongUrl)
+		assert.Equal(t, "alice", updated.Owner)
+	}
+
+	// Updates and deletes are conditional on the owner and workspace that were checked
+	otherOwner, otherWorkspace := "bob", "team-b"
+	_, err = store.UpdateUrlEntry(context.Background(), entry.ShortUrl, &dal.UrlEntryUpdate{
+		LongUrl: &longUrl, UrlEntryCondition: dal.UrlEntryCondition{Owner: &otherOwner}})
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+	_, err = store.UpdateUrlEntry(context.Background(), entry.ShortUrl, &dal.UrlEntryUpdate{
+		LongUrl: &longUrl, UrlEntryCondition: dal.UrlEntryCondition{Workspace: &otherWorkspace}})
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+	err = store.DeleteUrlEntry(context.Background(), entry.ShortUrl, &dal.UrlEntryCondition{Workspace: &otherWorkspace})
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+	_, err = store.GetUrlEntry(context.Background(), entry.ShortUrl)
+	assert.NoError(t, err)
+}
+
+func TestCreateUrlMappingRejectsPastExpiry(t *testing.T) {
+	uss, _, _ := newTestService(t)
+
+	for _, expiresAt := range []int64{time.Now().Unix() - 1, time.Now().Unix(), -1} {
+		_, _, err := uss.CreateUrlMapping(context.Background(), "https://example.com", MappingOptions{ExpiresAt: expiresAt})
+		assert.ErrorIs(t, err, ErrInvalidExpiry, expiresAt)
+	}
+	longUrl := "https://example.com"
+	entry, _, err := uss.CreateUrlMapping(context.Background(), longUrl, MappingOptions{})
+	require.NoError(t, err)
+	past := time.Now().Unix() - 1
+	_, err = uss.UpdateUrlMapping(context.Background(), entry.ShortUrl, &dal.UrlEntryUpdate{ExpiresAt: &past})
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+}
+
+func TestRedirectUrlOfExpiredCacheEntry(t *testing.T) {
+	ctx := context.Background()
+	cache := multicache.New(nil)
+	uss := New(WithMultiCache(cache), WithUrlStore(dal.NewMemoryUrlStore()))
+
+	// Cached by an instance whose clock is behind, so it outlives the expiry
+	expired := &dal.UrlMappingEntry{LongUrl: "https://example.com", ExpiresAt: time.Now().Unix() - 1}
+	setCached(t, cache, "abc", encodeCachedRedirect(expired))
+
+	_, err := uss.RedirectUrl(ctx, "abc", Visit{})
+	assert.ErrorIs(t, err, dal.ErrUrlEntryExpired)
+}
+
+func TestRunExpirySweeper(t *testing.T) {
+	uss, store, _ := newTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now().Unix()
+	for shortUrl, expiresAt := range map[string]int64{"old": now - 7200, "recent": now - 60, "live": now + 3600, "never": 0} {
+		require.NoError(t, store.AddUrlEntry(ctx, &dal.UrlMappingEntry{
+			ShortUrl: shortUrl, LongUrl: "https://example.com/" + shortUrl, ExpiresAt: expiresAt}))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		uss.RunExpirySweeper(ctx, time.Millisecond, time.Hour)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		_, err := store.GetUrlEntry(ctx, "old")
+		return errors.Is(err, dal.ErrUrlEntryNotFound)
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	// Within the retention an expired link is still known, and answers 410 Gone
+	_, err := uss.RedirectUrl(context.Background(), "recent", Visit{})
+	assert.ErrorIs(t, err, dal.ErrUrlEntryExpired)
+	for _, shortUrl := range []string{"live", "never"} {
+		_, err := uss.RedirectUrl(context.Background(), shortUrl, Visit{})
+		assert.NoError(t, err, shortUrl)
+	}
+	_, err = uss.RedirectUrl(context.Background(), "old", Visit{})
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gately/internal/dal"
+)
+
+const (
+	// Header values are client controlled, so only this much of them is kept
+	maxReferrerLength       = 2048
+	maxUserAgentLength      = 512
+	maxAcceptLanguageLength = 128
+
+	// Bytes of the HMAC kept as the IP hash
+	ipHashLength = 16
+)
+
+// Visit describes the client behind a redirect
+type Visit struct {
+	Referrer       string
+	UserAgent      string
+	AcceptLanguage string
+	Ip             string
+}
+
+// newIpSalt returns a random salt, used when none is configured.
+// IP hashes then only match within the lifetime of the process.
+func newIpSalt() []byte {
+	salt := make([]byte, 32)
+	_, _ = rand.Read(salt)
+	return salt
+}
+
+// hashIp returns a keyed hash of ip, so that clicks from the same client can be
+// correlated without storing the address itself
+func (uss *UrlShorteningService) hashIp(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, uss.ipSalt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:ipHashLength])
+}
+
+// truncate keeps at most n bytes of a header value. Invalid UTF-8 is replaced and
+// multi-byte characters are not cut, as stores such as PostgreSQL reject invalid text.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (uss *UrlShorteningService) clickEvent(shortUrl string, visit Visit) *dal.ClickEvent {
+	return &dal.ClickEvent{
+		ShortUrl:       shortUrl,
+		Ts:             time.Now().Unix(),
+		Referrer:       truncate(visit.Referrer, maxReferrerLength),
+		UserAgent:      truncate(visit.UserAgent, maxUserAgentLength),
+		AcceptLanguage: truncate(visit.AcceptLanguage, maxAcceptLanguageLength),
+		IpHash:         uss.hashIp(visit.Ip),
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		n    int
+		want string
+	}{
+		{name: "short", in: "Mozilla", n: 10, want: "Mozilla"},
+		{name: "exact", in: "Mozilla", n: 7, want: "Mozilla"},
+		{name: "ascii", in: "Mozilla", n: 3, want: "Moz"},
+		{name: "rune boundary", in: "aé", n: 3, want: "aé"},
+		{name: "inside a rune", in: "aéb", n: 2, want: "a"},
+		{name: "inside a 4 byte rune", in: "😀😀", n: 6, want: "😀"},
+		{name: "invalid utf8", in: "a\xffb", n: 10, want: "a�b"},
+		{name: "invalid utf8 cut", in: "a\xff", n: 2, want: "a"},
+		{name: "zero", in: "abc", n: 0, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.in, tt.n)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, utf8.ValidString(got))
+			assert.LessOrEqual(t, len(got), tt.n)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"gately/internal/dal"
+)
+
+// Short code prefixes are kept short, as every short url of the workspace carries them
+const maxShortCodePrefixLength = 16
+
+var ErrInvalidWorkspace = errors.New("Invalid workspace")
+
+var workspaceIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// NewWorkspace validates the settings of a new workspace
+func NewWorkspace(id, name, prefix string, maxLinks int64, policy dal.DedupePolicy) (*dal.Workspace, error) {
+	ws := &dal.Workspace{
+		Id:              id,
+		Name:            name,
+		ShortCodePrefix: prefix,
+		MaxLinks:        maxLinks,
+		DedupePolicy:    policy,
+		CreatedTs:       time.Now().Unix(),
+	}
+	if err := CheckWorkspace(ws); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// CheckWorkspace validates the settings of a workspace, e.g. after they were changed
+func CheckWorkspace(ws *dal.Workspace) error {
+	if !workspaceIdPattern.MatchString(ws.Id) {
+		return fmt.Errorf("Workspace ids are up to 32 lowercase letters, digits and '-'. Err=%w", ErrInvalidWorkspace)
+	}
+	if len(ws.ShortCodePrefix) > maxShortCodePrefixLength || (ws.ShortCodePrefix != "" && !aliasPattern.MatchString(ws.ShortCodePrefix)) {
+		return fmt.Errorf("Short code prefixes are up to %d letters, digits, '-' and '_'. Err=%w",
+			maxShortCodePrefixLength, ErrInvalidWorkspace)
+	}
+	if ws.MaxLinks < 0 {
+		return fmt.Errorf("The link quota cannot be negative. Err=%w", ErrInvalidWorkspace)
+	}
+	return CheckDedupePolicy(ws.DedupePolicy)
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"gately/internal/auth"
+	"gately/internal/dal"
+	"gately/internal/multicache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func workspaceContext(workspace, owner string) context.Context {
+	return auth.NewContext(context.Background(), &auth.Principal{KeyId: owner, Owner: owner, Workspace: workspace})
+}
+
+func TestWorkspaceIsolation(t *testing.T) {
+	workspaces := dal.NewMemoryWorkspaceStore()
+	for _, id := range []string{"team-a", "team-b"} {
+		ws, err := NewWorkspace(id, id, "", 0, "")
+		require.NoError(t, err)
+		require.NoError(t, workspaces.AddWorkspace(context.Background(), ws))
+	}
+	uss := New(
+		WithMultiCache(multicache.New(nil)),
+		WithUrlStore(dal.NewMemoryUrlStore()),
+		WithClickStore(dal.NewMemoryClickStore()),
+		WithWorkspaceStore(workspaces),
+	)
+	teamA := workspaceContext("team-a", "alice")
+	// An admin of another workspace may manage every link, but only of its own workspace
+	teamB := auth.NewContext(context.Background(), &auth.Principal{KeyId: "k2", Owner: "bob", Admin: true, Workspace: "team-b"})
+
+	entry, _, err := uss.CreateUrlMapping(teamA, "https://example.com", MappingOptions{})
+	require.NoError(t, err)
+
+	// The same long url is deduplicated per workspace, so team-b gets a link of its own
+	other, created, err := uss.CreateUrlMapping(teamB, "https://example.com", MappingOptions{})
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.NotEqual(t, entry.ShortUrl, other.ShortUrl)
+
+	longUrl := "https://example.com/b"
+	_, err = uss.UpdateUrlMapping(teamB, entry.ShortUrl, &dal.UrlEntryUpdate{LongUrl: &longUrl})
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+	_, err = uss.GetUrlHistory(teamB, entry.ShortUrl)
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+	_, err = uss.RollbackUrlMapping(teamB, entry.ShortUrl, 1, "bob")
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+	_, err = uss.GetUrlStats(teamB, entry.ShortUrl, 0, 3600, GranularityHour)
+	assert.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+
+	// Deleting a link of another workspace is a no-op, like deleting a missing one
+	require.NoError(t, uss.DeleteUrlMapping(teamB, entry.ShortUrl))
+	_, err = uss.GetUrlHistory(teamA, entry.ShortUrl)
+	assert.NoError(t, err)
+
+	page, err := uss.GetUrlMetrics(teamB, dal.MetricsQuery{Start: 0, End: math.MaxInt64})
+	require.NoError(t, err)
+	require.Len(t, page.Metrics, 1)
+	assert.Equal(t, other.ShortUrl, page.Metrics[0].ShortUrl)
+}
+
+func TestWorkspaceQuota(t *testing.T) {
+	ctx := context.Background()
+	workspaces := dal.NewMemoryWorkspaceStore()
+	for id, maxLinks := range map[string]int64{"team-a": 2, "team-b": 0} {
+		ws, err := NewWorkspace(id, id, "", maxLinks, "")
+		require.NoError(t, err)
+		require.NoError(t, workspaces.AddWorkspace(ctx, ws))
+	}
+	uss := New(
+		WithMultiCache(multicache.New(nil)),
+		WithUrlStore(dal.NewMemoryUrlStore()),
+		WithWorkspaceStore(workspaces),
+	)
+	teamA := workspaceContext("team-a", "alice")
+
+	first, _, err := uss.CreateUrlMapping(teamA, "https://example.com/1", MappingOptions{})
+	require.NoError(t, err)
+	_, _, err = uss.CreateUrlMapping(teamA, "https://example.com/2", MappingOptions{})
+	require.NoError(t, err)
+	_, _, err = uss.CreateUrlMapping(teamA, "https://example.com/3", MappingOptions{})
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// Links of other workspaces do not count
+	_, _, err = uss.CreateUrlMapping(workspaceContext("team-b", "bob"), "https://example.com/3", MappingOptions{})
+	require.NoError(t, err)
+
+	// Deleting a link makes room again
+	require.NoError(t, uss.DeleteUrlMapping(teamA, first.ShortUrl))
+	_, _, err = uss.CreateUrlMapping(teamA, "https://example.com/3", MappingOptions{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,133 @@
+package telemetry
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"gately/internal/clicks"
+	"github.com/eko/gocache/v3/cache"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gately"
+
+// Metrics holds the Prometheus collectors of the server.
+// They live in their own registry, so that only gately's metrics (and the
+// Go runtime and process metrics) are exposed.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requestDuration *prometheus.HistogramVec
+	storeDuration   *prometheus.HistogramVec
+	storeErrors     *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route and status",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_operation_duration_seconds",
+			Help:      "Latency of URL store operations",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "store_operation_errors_total",
+			Help:      "URL store operations that failed, not counting expected outcomes such as a missing entry",
+		}, []string{"operation"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestDuration,
+		m.storeDuration,
+		m.storeErrors,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware observes the latency of every request, labelled with the route pattern
+// rather than the path, so that short codes do not blow up the number of series
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				// Let the error handler write the response, so that its status is observed
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			m.requestDuration.
+				WithLabelValues(c.Request().Method, route, strconv.Itoa(c.Response().Status)).
+				Observe(time.Since(start).Seconds())
+			return nil
+		}
+	}
+}
+
+// RegisterCache exposes the hits and misses of every tier of the cache
+func (m *Metrics) RegisterCache(chain *cache.ChainCache[string]) {
+	m.registry.MustRegister(&cacheCollector{
+		chain: chain,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cache", "requests_total"),
+			"Cache lookups by tier (ristretto, redis) and result (hit, miss)",
+			[]string{"tier", "result"}, nil),
+	})
+}
+
+// RegisterClickPipeline exposes how far the click pipeline is behind
+func (m *Metrics) RegisterClickPipeline(pipeline *clicks.Pipeline) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "click_queue_depth",
+			Help:      "Clicks waiting to be aggregated",
+		}, func() float64 { return float64(pipeline.QueueDepth()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "clicks_dropped_total",
+			Help:      "Clicks that were never recorded because the queue was full",
+		}, func() float64 { return float64(pipeline.Dropped()) }),
+	)
+}
+
+// cacheCollector reads the statistics that gocache keeps per tier at scrape time
+type cacheCollector struct {
+	chain *cache.ChainCache[string]
+	desc  *prometheus.Desc
+}
+
+func (cc *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.desc
+}
+
+func (cc *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, tier := range cc.chain.GetCaches() {
+		codec := tier.GetCodec()
+		stats := codec.GetStats()
+		name := codec.GetStore().GetType()
+		ch <- prometheus.MustNewConstMetric(cc.desc, prometheus.CounterValue, float64(stats.Hits), name, "hit")
+		ch <- prometheus.MustNewConstMetric(cc.desc, prometheus.CounterValue, float64(stats.Miss), name, "miss")
+	}
+}
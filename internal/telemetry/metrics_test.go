@@ -0,0 +1,74 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gately/internal/dal"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingUrlStore fails every lookup, like a store that lost its database
+type failingUrlStore struct {
+	dal.UrlStore
+}
+
+func (fs failingUrlStore) GetMappedUrl(ctx context.Context, shortUrl string) (string, error) {
+	return "", errors.New("connection refused")
+}
+
+// scrape reads the metrics as Prometheus would
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestInstrumentUrlStore(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	store := m.InstrumentUrlStore(failingUrlStore{dal.NewMemoryUrlStore()})
+
+	require.NoError(t, store.AddUrlEntry(ctx, &dal.UrlMappingEntry{ShortUrl: "abc", LongUrl: "https://example.com"}))
+	_, err := store.GetUrlEntry(ctx, "missing")
+	require.ErrorIs(t, err, dal.ErrUrlEntryNotFound)
+	_, err = store.GetMappedUrl(ctx, "abc")
+	require.Error(t, err)
+
+	metrics := scrape(t, m)
+	for _, operation := range []string{"add_url_entry", "get_url_entry", "get_mapped_url"} {
+		assert.Contains(t, metrics, `gately_store_operation_duration_seconds_count{operation="`+operation+`"} 1`)
+	}
+	// A missing entry is an answer, not a failure
+	assert.NotContains(t, metrics, `gately_store_operation_errors_total{operation="get_url_entry"}`)
+	assert.Contains(t, metrics, `gately_store_operation_errors_total{operation="get_mapped_url"} 1`)
+}
+
+func TestMiddlewareObservesRoutes(t *testing.T) {
+	m := New()
+	e := echo.New()
+	e.Use(m.Middleware())
+	e.GET("/:urlId", func(c echo.Context) error {
+		if c.Param("urlId") == "missing" {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		return c.Redirect(http.StatusFound, "https://example.com")
+	})
+
+	for _, path := range []string{"/abc", "/def", "/missing"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Labelled with the route, not the short code
+	metrics := scrape(t, m)
+	assert.Contains(t, metrics, `gately_http_request_duration_seconds_count{method="GET",route="/:urlId",status="302"} 2`)
+	assert.Contains(t, metrics, `gately_http_request_duration_seconds_count{method="GET",route="/:urlId",status="404"} 1`)
+	assert.NotContains(t, metrics, "/abc")
+}
@@ -0,0 +1,103 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gately/internal/dal"
+)
+
+// instrumentedUrlStore times every operation of the wrapped UrlStore and counts its errors
+type instrumentedUrlStore struct {
+	store   dal.UrlStore
+	metrics *Metrics
+}
+
+// InstrumentUrlStore wraps store so that its latencies and errors are exported
+func (m *Metrics) InstrumentUrlStore(store dal.UrlStore) dal.UrlStore {
+	return &instrumentedUrlStore{store: store, metrics: m}
+}
+
+// isExpected reports whether err is an answer of the store rather than a failure
+func isExpected(err error) bool {
+	return err == nil ||
+		errors.Is(err, dal.ErrUrlEntryNotFound) ||
+		errors.Is(err, dal.ErrUrlEntryExpired) ||
+		errors.Is(err, dal.ErrUrlEntryAlreadyExists) ||
+		errors.Is(err, dal.ErrShortUrlAlreadyExists)
+}
+
+// observe is deferred with the start time of an operation and a pointer to its error
+func (is *instrumentedUrlStore) observe(operation string, start time.Time, err *error) {
+	is.metrics.storeDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil && !isExpected(*err) {
+		is.metrics.storeErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func (is *instrumentedUrlStore) AddUrlEntry(ctx context.Context, entry *dal.UrlMappingEntry) (err error) {
+	defer is.observe("add_url_entry", time.Now(), &err)
+	return is.store.AddUrlEntry(ctx, entry)
+}
+
+func (is *instrumentedUrlStore) GetMappedUrl(ctx context.Context, shortUrl string) (_ string, err error) {
+	defer is.observe("get_mapped_url", time.Now(), &err)
+	return is.store.GetMappedUrl(ctx, shortUrl)
+}
+
+func (is *instrumentedUrlStore) GetUrlEntry(ctx context.Context, shortUrl string) (_ *dal.UrlMappingEntry, err error) {
+	defer is.observe("get_url_entry", time.Now(), &err)
+	return is.store.GetUrlEntry(ctx, shortUrl)
+}
+
+func (is *instrumentedUrlStore) GetUrlEntryByLongUrl(ctx context.Context, workspace, host, longUrl string) (_ *dal.UrlMappingEntry, err error) {
+	defer is.observe("get_url_entry_by_long_url", time.Now(), &err)
+	return is.store.GetUrlEntryByLongUrl(ctx, workspace, host, longUrl)
+}
+
+func (is *instrumentedUrlStore) DeleteUrlEntry(ctx context.Context, shortUrl string, cond *dal.UrlEntryCondition) (err error) {
+	defer is.observe("delete_url_entry", time.Now(), &err)
+	return is.store.DeleteUrlEntry(ctx, shortUrl, cond)
+}
+
+func (is *instrumentedUrlStore) CheckIfUrlExists(ctx context.Context, url string, isLong bool) bool {
+	// Failures are reported as false by the store, so only the latency is known
+	defer is.observe("check_if_url_exists", time.Now(), nil)
+	return is.store.CheckIfUrlExists(ctx, url, isLong)
+}
+
+func (is *instrumentedUrlStore) UpdateUrlHitCount(ctx context.Context, shortUrl string) (err error) {
+	defer is.observe("update_url_hit_count", time.Now(), &err)
+	return is.store.UpdateUrlHitCount(ctx, shortUrl)
+}
+
+func (is *instrumentedUrlStore) UpdateUrlHitCounts(ctx context.Context, counts map[string]dal.HitCount) (err error) {
+	defer is.observe("update_url_hit_counts", time.Now(), &err)
+	return is.store.UpdateUrlHitCounts(ctx, counts)
+}
+
+func (is *instrumentedUrlStore) GetUrlMetrics(ctx context.Context, query dal.MetricsQuery, fn func(*dal.UrlMappingEntry) error) (err error) {
+	defer is.observe("get_url_metrics", time.Now(), &err)
+	return is.store.GetUrlMetrics(ctx, query, fn)
+}
+
+func (is *instrumentedUrlStore) UpdateUrlEntry(ctx context.Context, shortUrl string, update *dal.UrlEntryUpdate) (_ *dal.UrlMappingEntry, err error) {
+	defer is.observe("update_url_entry", time.Now(), &err)
+	return is.store.UpdateUrlEntry(ctx, shortUrl, update)
+}
+
+func (is *instrumentedUrlStore) GetUrlHistory(ctx context.Context, shortUrl string) (_ []dal.UrlDestination, err error) {
+	defer is.observe("get_url_history", time.Now(), &err)
+	return is.store.GetUrlHistory(ctx, shortUrl)
+}
+
+func (is *instrumentedUrlStore) DeleteExpiredUrlEntries(ctx context.Context, before int64) (_ int64, err error) {
+	defer is.observe("delete_expired_url_entries", time.Now(), &err)
+	return is.store.DeleteExpiredUrlEntries(ctx, before)
+}
+
+func (is *instrumentedUrlStore) CountUrlEntries(ctx context.Context, workspace string) (_ int64, err error) {
+	defer is.observe("count_url_entries", time.Now(), &err)
+	return is.store.CountUrlEntries(ctx, workspace)
+}
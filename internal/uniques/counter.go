@@ -0,0 +1,39 @@
+package uniques
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	keyPrefix = "gately:uv"
+	dayFormat = "20060102"
+
+	// How long the per day sketches are kept. The overall sketch is kept forever
+	DayRetention = 90 * 24 * time.Hour
+)
+
+// Counter estimates the number of unique visitors of short urls.
+// Visitors are identified by a fingerprint, which is counted once per day and once overall.
+type Counter interface {
+	// Add records visits of a short url on the day that contains ts
+	Add(ctx context.Context, shortUrl string, ts time.Time, fingerprints ...string) error
+	// Count estimates the unique visitors of a short url since it was created
+	Count(ctx context.Context, shortUrl string) (int64, error)
+	// CountDays estimates the unique visitors of a short url across the days that contain the given times
+	CountDays(ctx context.Context, shortUrl string, days ...time.Time) (int64, error)
+	// CountPeriods is CountDays for every period, each given by the days it spans, in one go
+	CountPeriods(ctx context.Context, shortUrl string, periods ...[]time.Time) ([]int64, error)
+	// Delete drops the sketches of a short url, for when the link is deleted
+	Delete(ctx context.Context, shortUrl string) error
+}
+
+func overallKey(shortUrl string) string {
+	return fmt.Sprintf("%s:%s", keyPrefix, shortUrl)
+}
+
+// dayKey names the sketch of a UTC day
+func dayKey(shortUrl string, day time.Time) string {
+	return fmt.Sprintf("%s:%s:%s", keyPrefix, shortUrl, day.UTC().Format(dayFormat))
+}
@@ -0,0 +1,75 @@
+package uniques
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Precision of the in-process sketches. 2^12 registers take 4 KiB and
+// estimate cardinalities with a standard error of about 1.6%
+const sketchPrecision = 12
+
+// Sketch is a HyperLogLog cardinality estimator. It is not safe for concurrent use.
+type Sketch struct {
+	registers []uint8
+}
+
+func NewSketch() *Sketch {
+	return &Sketch{registers: make([]uint8, 1<<sketchPrecision)}
+}
+
+// hash64 spreads the FNV-1a hash of s over all 64 bits (splitmix64 finalizer)
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Add records one element
+func (s *Sketch) Add(element string) {
+	x := hash64(element)
+	idx := x >> (64 - sketchPrecision)
+	// The remaining bits, with a sentinel so that the rank never exceeds 64-p+1
+	w := x<<sketchPrecision | 1<<(sketchPrecision-1)
+	rank := uint8(bits.LeadingZeros64(w) + 1)
+	if rank > s.registers[idx] {
+		s.registers[idx] = rank
+	}
+}
+
+// Merge folds other into s, so that s estimates the union of both
+func (s *Sketch) Merge(other *Sketch) {
+	for i, r := range other.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+}
+
+// Count estimates the number of distinct elements added
+func (s *Sketch) Count() int64 {
+	m := float64(len(s.registers))
+	var sum float64
+	var zeros int
+	for _, r := range s.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Linear counting is more accurate for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(estimate + 0.5)
+}
@@ -0,0 +1,59 @@
+package uniques
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sketchOf(from, to int) *Sketch {
+	s := NewSketch()
+	for i := from; i < to; i++ {
+		s.Add(fmt.Sprintf("visitor-%d", i))
+	}
+	return s
+}
+
+// assertEstimate allows three standard errors of the sketch precision
+func assertEstimate(t *testing.T, expected int, s *Sketch) {
+	t.Helper()
+	tolerance := 3 * 1.04 / math.Sqrt(float64(int(1)<<sketchPrecision)) * float64(expected)
+	assert.InDelta(t, expected, s.Count(), math.Max(tolerance, 1))
+}
+
+func TestSketchAccuracy(t *testing.T) {
+	m := 1 << sketchPrecision
+	// Linear counting is used up to 2.5m, the HyperLogLog estimate above it,
+	// so the sizes around 2.5m cover the switch between both
+	for _, n := range []int{0, 1, 10, 100, 1000, 5 * m / 2, 5*m/2 + 1, 3 * m, 10000, 100000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			assertEstimate(t, n, sketchOf(0, n))
+		})
+	}
+}
+
+func TestSketchIgnoresDuplicates(t *testing.T) {
+	s := sketchOf(0, 1000)
+	before := s.Count()
+	for i := 0; i < 1000; i++ {
+		s.Add(fmt.Sprintf("visitor-%d", i))
+	}
+	assert.Equal(t, before, s.Count())
+}
+
+func TestSketchMerge(t *testing.T) {
+	union := sketchOf(0, 6000)
+	union.Merge(sketchOf(4000, 10000))
+	assertEstimate(t, 10000, union)
+
+	// The union is the same as one sketch of all elements
+	assert.Equal(t, sketchOf(0, 10000).registers, union.registers)
+
+	// Merging is idempotent
+	before := union.Count()
+	union.Merge(union)
+	union.Merge(NewSketch())
+	assert.Equal(t, before, union.Count())
+}
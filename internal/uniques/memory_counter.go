@@ -0,0 +1,157 @@
+package uniques
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Bounds the memory of the in-process sketches to about 40 MiB
+const defaultMaxSketches = 10000
+
+// sketchRef identifies the overall sketch of a short url, or its sketch of one UTC day
+type sketchRef struct {
+	shortUrl string
+	// YYYYMMDD, which sorts like the date itself. Empty for the overall sketch
+	day string
+}
+
+func newDayRef(shortUrl string, ts time.Time) sketchRef {
+	return sketchRef{shortUrl: shortUrl, day: ts.UTC().Format(dayFormat)}
+}
+
+// sketchEntry is an element of the recency list
+type sketchEntry struct {
+	ref    sketchRef
+	sketch *Sketch
+}
+
+// MemoryCounter keeps the sketches in process memory, for when Redis is not configured.
+// Counts are per instance and do not survive a restart. At most maxSketches sketches
+// are kept, the least recently used ones are dropped to make room for new ones.
+type MemoryCounter struct {
+	mu          sync.Mutex
+	maxSketches int
+	sketches    map[sketchRef]*list.Element
+	// Most recently used first
+	recency *list.List
+	// Day of the last purge of expired day sketches
+	purgedDay string
+}
+
+func NewMemoryCounter() Counter {
+	return newMemoryCounter(defaultMaxSketches)
+}
+
+func newMemoryCounter(maxSketches int) *MemoryCounter {
+	return &MemoryCounter{
+		maxSketches: maxSketches,
+		sketches:    make(map[sketchRef]*list.Element),
+		recency:     list.New(),
+	}
+}
+
+func (mc *MemoryCounter) Add(ctx context.Context, shortUrl string, ts time.Time, fingerprints ...string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.purge(time.Now())
+
+	day := mc.sketch(newDayRef(shortUrl, ts), true)
+	overall := mc.sketch(sketchRef{shortUrl: shortUrl}, true)
+	for _, fp := range fingerprints {
+		day.Add(fp)
+		overall.Add(fp)
+	}
+	return nil
+}
+
+func (mc *MemoryCounter) Count(ctx context.Context, shortUrl string) (int64, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if s := mc.sketch(sketchRef{shortUrl: shortUrl}, false); s != nil {
+		return s.Count(), nil
+	}
+	return 0, nil
+}
+
+func (mc *MemoryCounter) CountDays(ctx context.Context, shortUrl string, days ...time.Time) (int64, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	return mc.countDays(shortUrl, days), nil
+}
+
+func (mc *MemoryCounter) CountPeriods(ctx context.Context, shortUrl string, periods ...[]time.Time) ([]int64, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	counts := make([]int64, len(periods))
+	for i, days := range periods {
+		counts[i] = mc.countDays(shortUrl, days)
+	}
+	return counts, nil
+}
+
+func (mc *MemoryCounter) Delete(ctx context.Context, shortUrl string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for ref, elem := range mc.sketches {
+		if ref.shortUrl == shortUrl {
+			mc.recency.Remove(elem)
+			delete(mc.sketches, ref)
+		}
+	}
+	return nil
+}
+
+func (mc *MemoryCounter) countDays(shortUrl string, days []time.Time) int64 {
+	union := NewSketch()
+	for _, day := range days {
+		if s := mc.sketch(newDayRef(shortUrl, day), false); s != nil {
+			union.Merge(s)
+		}
+	}
+	return union.Count()
+}
+
+// sketch returns the sketch of ref and marks it as used. A missing sketch is created
+// when create is set, which may drop the least recently used one. Otherwise it is nil.
+func (mc *MemoryCounter) sketch(ref sketchRef, create bool) *Sketch {
+	if elem, ok := mc.sketches[ref]; ok {
+		mc.recency.MoveToFront(elem)
+		return elem.Value.(*sketchEntry).sketch
+	}
+	if !create {
+		return nil
+	}
+
+	for mc.recency.Len() >= mc.maxSketches {
+		oldest := mc.recency.Back()
+		mc.recency.Remove(oldest)
+		delete(mc.sketches, oldest.Value.(*sketchEntry).ref)
+	}
+	s := NewSketch()
+	mc.sketches[ref] = mc.recency.PushFront(&sketchEntry{ref: ref, sketch: s})
+	return s
+}
+
+// purge drops day sketches older than DayRetention, at most once per day
+func (mc *MemoryCounter) purge(now time.Time) {
+	today := now.UTC().Format(dayFormat)
+	if today == mc.purgedDay {
+		return
+	}
+	mc.purgedDay = today
+
+	cutoff := now.Add(-DayRetention).UTC().Format(dayFormat)
+	for ref, elem := range mc.sketches {
+		if ref.day != "" && ref.day < cutoff {
+			mc.recency.Remove(elem)
+			delete(mc.sketches, ref)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package uniques
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCounterCounts(t *testing.T) {
+	ctx := context.Background()
+	mc := NewMemoryCounter()
+	monday := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tuesday := monday.Add(24 * time.Hour)
+
+	require.NoError(t, mc.Add(ctx, "a", monday, "v1", "v2"))
+	require.NoError(t, mc.Add(ctx, "a", tuesday, "v2", "v3"))
+	require.NoError(t, mc.Add(ctx, "b", monday, "v4"))
+
+	count, err := mc.Count(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	count, err = mc.CountDays(ctx, "a", monday)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	counts, err := mc.CountPeriods(ctx, "a", []time.Time{monday}, []time.Time{monday, tuesday}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 0}, counts)
+
+	count, err = mc.Count(ctx, "missing")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestMemoryCounterEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	// Every link on a single day takes two sketches, the day and the overall one
+	mc := newMemoryCounter(4)
+	now := time.Now()
+
+	require.NoError(t, mc.Add(ctx, "a", now, "v1"))
+	require.NoError(t, mc.Add(ctx, "b", now, "v1"))
+	// Reading a keeps it, so b is the least recently used
+	_, _ = mc.Count(ctx, "a")
+	_, _ = mc.CountDays(ctx, "a", now)
+	require.NoError(t, mc.Add(ctx, "c", now, "v1"))
+
+	assert.Len(t, mc.sketches, 4)
+	assert.Equal(t, mc.recency.Len(), len(mc.sketches))
+	for link, expected := range map[string]int64{"a": 1, "b": 0, "c": 1} {
+		count, err := mc.Count(ctx, link)
+		require.NoError(t, err)
+		assert.Equal(t, expected, count, link)
+	}
+}
+
+func TestMemoryCounterPurgesExpiredDays(t *testing.T) {
+	ctx := context.Background()
+	mc := newMemoryCounter(defaultMaxSketches)
+	old := time.Now().Add(-DayRetention - 48*time.Hour)
+
+	require.NoError(t, mc.Add(ctx, "a", old, "v1"))
+	// Expired days are purged once a day, so pretend that the last purge was yesterday
+	mc.purgedDay = ""
+	require.NoError(t, mc.Add(ctx, "a", time.Now(), "v2"))
+
+	count, err := mc.CountDays(ctx, "a", old)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	// The overall sketch is kept
+	count, err = mc.Count(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestMemoryCounterDeletes(t *testing.T) {
+	ctx := context.Background()
+	mc := newMemoryCounter(defaultMaxSketches)
+	now := time.Now()
+
+	require.NoError(t, mc.Add(ctx, "a", now, "v1"))
+	require.NoError(t, mc.Add(ctx, "a", now.Add(-24*time.Hour), "v2"))
+	require.NoError(t, mc.Add(ctx, "b", now, "v1"))
+	require.NoError(t, mc.Delete(ctx, "a"))
+
+	assert.Len(t, mc.sketches, 2)
+	assert.Equal(t, mc.recency.Len(), len(mc.sketches))
+	count, err := mc.Count(ctx, "a")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	count, err = mc.Count(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,91 @@
+package uniques
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisCounter keeps the sketches in Redis with PFADD and PFCOUNT,
+// so that every gately instance counts into the same sketches.
+type RedisCounter struct {
+	client *redis.Client
+}
+
+func NewRedisCounter(client *redis.Client) Counter {
+	return &RedisCounter{client: client}
+}
+
+func (rc *RedisCounter) Add(ctx context.Context, shortUrl string, ts time.Time, fingerprints ...string) error {
+	if len(fingerprints) == 0 {
+		return nil
+	}
+	elements := make([]interface{}, len(fingerprints))
+	for i, fp := range fingerprints {
+		elements[i] = fp
+	}
+
+	day := dayKey(shortUrl, ts)
+	_, err := rc.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.PFAdd(ctx, day, elements...)
+		pipe.Expire(ctx, day, DayRetention)
+		pipe.PFAdd(ctx, overallKey(shortUrl), elements...)
+		return nil
+	})
+	return err
+}
+
+func (rc *RedisCounter) Count(ctx context.Context, shortUrl string) (int64, error) {
+	return rc.client.PFCount(ctx, overallKey(shortUrl)).Result()
+}
+
+func (rc *RedisCounter) CountDays(ctx context.Context, shortUrl string, days ...time.Time) (int64, error) {
+	if len(days) == 0 {
+		return 0, nil
+	}
+	// PFCOUNT over several keys estimates the cardinality of their union
+	return rc.client.PFCount(ctx, dayKeys(shortUrl, days)...).Result()
+}
+
+// CountPeriods pipelines one PFCOUNT per period, so that it takes a single round trip
+func (rc *RedisCounter) CountPeriods(ctx context.Context, shortUrl string, periods ...[]time.Time) ([]int64, error) {
+	cmds := make([]*redis.IntCmd, len(periods))
+	_, err := rc.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, days := range periods {
+			if len(days) > 0 {
+				cmds[i] = pipe.PFCount(ctx, dayKeys(shortUrl, days)...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int64, len(periods))
+	for i, cmd := range cmds {
+		if cmd != nil {
+			counts[i] = cmd.Val()
+		}
+	}
+	return counts, nil
+}
+
+// Delete drops the overall sketch and the day sketches that have not expired yet
+func (rc *RedisCounter) Delete(ctx context.Context, shortUrl string) error {
+	now := time.Now()
+	keys := []string{overallKey(shortUrl)}
+	for ts := now.Add(-DayRetention); !ts.After(now); ts = ts.Add(24 * time.Hour) {
+		keys = append(keys, dayKey(shortUrl, ts))
+	}
+	return rc.client.Del(ctx, keys...).Err()
+}
+
+func dayKeys(shortUrl string, days []time.Time) []string {
+	keys := make([]string, len(days))
+	for i, day := range days {
+		keys[i] = dayKey(shortUrl, day)
+	}
+	return keys
+}
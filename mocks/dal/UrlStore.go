@@ -42,13 +42,55 @@ func (_m *UrlStore) CheckIfUrlExists(ctx context.Context, url string, isLong boo
 	return r0
 }
 
-// DeleteUrlEntry provides a mock function with given fields: ctx, shortUrl
-func (_m *UrlStore) DeleteUrlEntry(ctx context.Context, shortUrl string) error {
-	ret := _m.Called(ctx, shortUrl)
+// CountUrlEntries provides a mock function with given fields: ctx, workspace
+func (_m *UrlStore) CountUrlEntries(ctx context.Context, workspace string) (int64, error) {
+	ret := _m.Called(ctx, workspace)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, string) int64); ok {
+		r0 = rf(ctx, workspace)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, workspace)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteExpiredUrlEntries provides a mock function with given fields: ctx, before
+func (_m *UrlStore) DeleteExpiredUrlEntries(ctx context.Context, before int64) (int64, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, int64) int64); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteUrlEntry provides a mock function with given fields: ctx, shortUrl, cond
+func (_m *UrlStore) DeleteUrlEntry(ctx context.Context, shortUrl string, cond *dal.UrlEntryCondition) error {
+	ret := _m.Called(ctx, shortUrl, cond)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, shortUrl)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *dal.UrlEntryCondition) error); ok {
+		r0 = rf(ctx, shortUrl, cond)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -77,22 +119,105 @@ func (_m *UrlStore) GetMappedUrl(ctx context.Context, shortUrl string) (string,
 	return r0, r1
 }
 
-// GetUrlMetrics provides a mock function with given fields: ctx, start, end, asc
-func (_m *UrlStore) GetUrlMetrics(ctx context.Context, start int64, end int64, asc bool) ([]*dal.UrlMappingEntry, error) {
-	ret := _m.Called(ctx, start, end, asc)
+// GetUrlEntry provides a mock function with given fields: ctx, shortUrl
+func (_m *UrlStore) GetUrlEntry(ctx context.Context, shortUrl string) (*dal.UrlMappingEntry, error) {
+	ret := _m.Called(ctx, shortUrl)
+
+	var r0 *dal.UrlMappingEntry
+	if rf, ok := ret.Get(0).(func(context.Context, string) *dal.UrlMappingEntry); ok {
+		r0 = rf(ctx, shortUrl)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dal.UrlMappingEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, shortUrl)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUrlEntryByLongUrl provides a mock function with given fields: ctx, workspace, host, longUrl
+func (_m *UrlStore) GetUrlEntryByLongUrl(ctx context.Context, workspace string, host string, longUrl string) (*dal.UrlMappingEntry, error) {
+	ret := _m.Called(ctx, workspace, host, longUrl)
+
+	var r0 *dal.UrlMappingEntry
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *dal.UrlMappingEntry); ok {
+		r0 = rf(ctx, workspace, host, longUrl)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dal.UrlMappingEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, workspace, host, longUrl)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUrlHistory provides a mock function with given fields: ctx, shortUrl
+func (_m *UrlStore) GetUrlHistory(ctx context.Context, shortUrl string) ([]dal.UrlDestination, error) {
+	ret := _m.Called(ctx, shortUrl)
+
+	var r0 []dal.UrlDestination
+	if rf, ok := ret.Get(0).(func(context.Context, string) []dal.UrlDestination); ok {
+		r0 = rf(ctx, shortUrl)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]dal.UrlDestination)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, shortUrl)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUrlMetrics provides a mock function with given fields: ctx, query, fn
+func (_m *UrlStore) GetUrlMetrics(ctx context.Context, query dal.MetricsQuery, fn func(*dal.UrlMappingEntry) error) error {
+	ret := _m.Called(ctx, query, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, dal.MetricsQuery, func(*dal.UrlMappingEntry) error) error); ok {
+		r0 = rf(ctx, query, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateUrlEntry provides a mock function with given fields: ctx, shortUrl, update
+func (_m *UrlStore) UpdateUrlEntry(ctx context.Context, shortUrl string, update *dal.UrlEntryUpdate) (*dal.UrlMappingEntry, error) {
+	ret := _m.Called(ctx, shortUrl, update)
 
-	var r0 []*dal.UrlMappingEntry
-	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, bool) []*dal.UrlMappingEntry); ok {
-		r0 = rf(ctx, start, end, asc)
+	var r0 *dal.UrlMappingEntry
+	if rf, ok := ret.Get(0).(func(context.Context, string, *dal.UrlEntryUpdate) *dal.UrlMappingEntry); ok {
+		r0 = rf(ctx, shortUrl, update)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*dal.UrlMappingEntry)
+			r0 = ret.Get(0).(*dal.UrlMappingEntry)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, bool) error); ok {
-		r1 = rf(ctx, start, end, asc)
+	if rf, ok := ret.Get(1).(func(context.Context, string, *dal.UrlEntryUpdate) error); ok {
+		r1 = rf(ctx, shortUrl, update)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -114,6 +239,20 @@ func (_m *UrlStore) UpdateUrlHitCount(ctx context.Context, shortUrl string) erro
 	return r0
 }
 
+// UpdateUrlHitCounts provides a mock function with given fields: ctx, counts
+func (_m *UrlStore) UpdateUrlHitCounts(ctx context.Context, counts map[string]dal.HitCount) error {
+	ret := _m.Called(ctx, counts)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]dal.HitCount) error); ok {
+		r0 = rf(ctx, counts)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewUrlStore interface {
 	mock.TestingT
 	Cleanup(func())
@@ -5,6 +5,7 @@ package mocks
 import (
 	context "context"
 	dal "gately/internal/dal"
+	service "gately/internal/service"
 
 	mock "github.com/stretchr/testify/mock"
 )
@@ -14,8 +15,8 @@ type UrlShortener struct {
 	mock.Mock
 }
 
-// CheckAndSanitizeUrl provides a mock function with given fields: longUrl
-func (_m *UrlShortener) CheckAndSanitizeUrl(longUrl string) (string, bool) {
+// CanonicalizeUrl provides a mock function with given fields: longUrl
+func (_m *UrlShortener) CanonicalizeUrl(longUrl string) (string, error) {
 	ret := _m.Called(longUrl)
 
 	var r0 string
@@ -25,35 +26,44 @@ func (_m *UrlShortener) CheckAndSanitizeUrl(longUrl string) (string, bool) {
 		r0 = ret.Get(0).(string)
 	}
 
-	var r1 bool
-	if rf, ok := ret.Get(1).(func(string) bool); ok {
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
 		r1 = rf(longUrl)
 	} else {
-		r1 = ret.Get(1).(bool)
+		r1 = ret.Error(1)
 	}
 
 	return r0, r1
 }
 
-// CreateUrlMapping provides a mock function with given fields: ctx, url
-func (_m *UrlShortener) CreateUrlMapping(ctx context.Context, url string) (string, error) {
-	ret := _m.Called(ctx, url)
+// CreateUrlMapping provides a mock function with given fields: ctx, url, opts
+func (_m *UrlShortener) CreateUrlMapping(ctx context.Context, url string, opts service.MappingOptions) (*dal.UrlMappingEntry, bool, error) {
+	ret := _m.Called(ctx, url, opts)
 
-	var r0 string
-	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
-		r0 = rf(ctx, url)
+	var r0 *dal.UrlMappingEntry
+	if rf, ok := ret.Get(0).(func(context.Context, string, service.MappingOptions) *dal.UrlMappingEntry); ok {
+		r0 = rf(ctx, url, opts)
 	} else {
-		r0 = ret.Get(0).(string)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dal.UrlMappingEntry)
+		}
 	}
 
-	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, url)
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(context.Context, string, service.MappingOptions) bool); ok {
+		r1 = rf(ctx, url, opts)
 	} else {
-		r1 = ret.Error(1)
+		r1 = ret.Get(1).(bool)
 	}
 
-	return r0, r1
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, service.MappingOptions) error); ok {
+		r2 = rf(ctx, url, opts)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
 }
 
 // DeleteUrlMapping provides a mock function with given fields: ctx, url
@@ -70,22 +80,22 @@ func (_m *UrlShortener) DeleteUrlMapping(ctx context.Context, url string) error
 	return r0
 }
 
-// GetUrlMetrics provides a mock function with given fields: ctx, start, end, asc
-func (_m *UrlShortener) GetUrlMetrics(ctx context.Context, start int64, end int64, asc bool) ([]*dal.UrlMappingEntry, error) {
-	ret := _m.Called(ctx, start, end, asc)
+// GetUrlHistory provides a mock function with given fields: ctx, shortUrl
+func (_m *UrlShortener) GetUrlHistory(ctx context.Context, shortUrl string) ([]service.UrlVersion, error) {
+	ret := _m.Called(ctx, shortUrl)
 
-	var r0 []*dal.UrlMappingEntry
-	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, bool) []*dal.UrlMappingEntry); ok {
-		r0 = rf(ctx, start, end, asc)
+	var r0 []service.UrlVersion
+	if rf, ok := ret.Get(0).(func(context.Context, string) []service.UrlVersion); ok {
+		r0 = rf(ctx, shortUrl)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*dal.UrlMappingEntry)
+			r0 = ret.Get(0).([]service.UrlVersion)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, bool) error); ok {
-		r1 = rf(ctx, start, end, asc)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, shortUrl)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -93,20 +103,142 @@ func (_m *UrlShortener) GetUrlMetrics(ctx context.Context, start int64, end int6
 	return r0, r1
 }
 
-// RedirectUrl provides a mock function with given fields: ctx, shortUrl
-func (_m *UrlShortener) RedirectUrl(ctx context.Context, shortUrl string) (string, error) {
-	ret := _m.Called(ctx, shortUrl)
+// GetUrlMetrics provides a mock function with given fields: ctx, query
+func (_m *UrlShortener) GetUrlMetrics(ctx context.Context, query dal.MetricsQuery) (*service.MetricsPage, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 *service.MetricsPage
+	if rf, ok := ret.Get(0).(func(context.Context, dal.MetricsQuery) *service.MetricsPage); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.MetricsPage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, dal.MetricsQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUrlStats provides a mock function with given fields: ctx, shortUrl, from, to, granularity
+func (_m *UrlShortener) GetUrlStats(ctx context.Context, shortUrl string, from int64, to int64, granularity service.Granularity) (*service.UrlStats, error) {
+	ret := _m.Called(ctx, shortUrl, from, to, granularity)
+
+	var r0 *service.UrlStats
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64, service.Granularity) *service.UrlStats); ok {
+		r0 = rf(ctx, shortUrl, from, to, granularity)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.UrlStats)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int64, service.Granularity) error); ok {
+		r1 = rf(ctx, shortUrl, from, to, granularity)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RedirectUrl provides a mock function with given fields: ctx, shortUrl, visit
+func (_m *UrlShortener) RedirectUrl(ctx context.Context, shortUrl string, visit service.Visit) (*service.Redirect, error) {
+	ret := _m.Called(ctx, shortUrl, visit)
+
+	var r0 *service.Redirect
+	if rf, ok := ret.Get(0).(func(context.Context, string, service.Visit) *service.Redirect); ok {
+		r0 = rf(ctx, shortUrl, visit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*service.Redirect)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, service.Visit) error); ok {
+		r1 = rf(ctx, shortUrl, visit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RollbackUrlMapping provides a mock function with given fields: ctx, shortUrl, version, actor
+func (_m *UrlShortener) RollbackUrlMapping(ctx context.Context, shortUrl string, version int, actor string) (*dal.UrlMappingEntry, error) {
+	ret := _m.Called(ctx, shortUrl, version, actor)
+
+	var r0 *dal.UrlMappingEntry
+	if rf, ok := ret.Get(0).(func(context.Context, string, int, string) *dal.UrlMappingEntry); ok {
+		r0 = rf(ctx, shortUrl, version, actor)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dal.UrlMappingEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int, string) error); ok {
+		r1 = rf(ctx, shortUrl, version, actor)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ShortLink provides a mock function with given fields: ctx, shortUrl, defaultBase
+func (_m *UrlShortener) ShortLink(ctx context.Context, shortUrl string, defaultBase string) string {
+	ret := _m.Called(ctx, shortUrl, defaultBase)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
-		r0 = rf(ctx, shortUrl)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
+		r0 = rf(ctx, shortUrl, defaultBase)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
+	return r0
+}
+
+// ShortUrlFor provides a mock function with given fields: ctx, host, code
+func (_m *UrlShortener) ShortUrlFor(ctx context.Context, host string, code string) string {
+	ret := _m.Called(ctx, host, code)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
+		r0 = rf(ctx, host, code)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// UpdateUrlMapping provides a mock function with given fields: ctx, shortUrl, update
+func (_m *UrlShortener) UpdateUrlMapping(ctx context.Context, shortUrl string, update *dal.UrlEntryUpdate) (*dal.UrlMappingEntry, error) {
+	ret := _m.Called(ctx, shortUrl, update)
+
+	var r0 *dal.UrlMappingEntry
+	if rf, ok := ret.Get(0).(func(context.Context, string, *dal.UrlEntryUpdate) *dal.UrlMappingEntry); ok {
+		r0 = rf(ctx, shortUrl, update)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*dal.UrlMappingEntry)
+		}
+	}
+
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, shortUrl)
+	if rf, ok := ret.Get(1).(func(context.Context, string, *dal.UrlEntryUpdate) error); ok {
+		r1 = rf(ctx, shortUrl, update)
 	} else {
 		r1 = ret.Error(1)
 	}